@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	nethttp "net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/config"
+	"github.com/pzolo85/todo-app/back/pkg/client"
+)
+
+// newHTTPClient returns a client that also trusts the certificate in caFile, when set
+func newHTTPClient(caFile string) (*nethttp.Client, error) {
+	transport := nethttp.DefaultTransport.(*nethttp.Transport).Clone()
+	if caFile != "" {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate > %w", err)
+		}
+		roots.AppendCertsFromPEM(pem)
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+	return &nethttp.Client{Transport: transport, Timeout: time.Minute}, nil
+}
+
+// serverURL is the url of the server listening on Address and Port, and the
+// certificate to trust for it
+func serverURL(cfg *config.Config) (url string, caFile string) {
+	host := cfg.Address
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+
+	scheme := "http"
+	if cfg.TLSEnabled() {
+		// the server certificate is trusted as is, it is often self-signed
+		scheme, caFile = "https", cfg.TLSCert
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, strconv.Itoa(cfg.Port))), caFile
+}
+
+// dialServer returns an admin client of the server listening on Address and Port,
+// or nil when no server is running there. The commands use it instead of the db
+// while the server holds the lock on it.
+func dialServer(cfg *config.Config) (*client.Client, error) {
+	url, caFile := serverURL(cfg)
+	httpClient, err := newHTTPClient(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	c := client.New(url,
+		client.WithHTTPClient(httpClient),
+		client.WithUserAgent("todo-app-cli"),
+		// a stopped server is not waited for
+		client.WithRetries(0, 0, 0),
+		client.WithTokenSource(func(ctx context.Context) (string, error) {
+			return signAdminToken(cfg, "cli@localhost", time.Minute, "todo-app-cli")
+		}),
+	)
+
+	err = c.Healthz(context.Background())
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the server at %s > %w", url, err)
+	}
+
+	return c, nil
+}
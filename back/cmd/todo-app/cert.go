@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/certs"
+	"github.com/pzolo85/todo-app/back/internal/config"
+)
+
+func certGenerate(cfg *config.Config, args []string) error {
+	fs := newFlags("cert generate", "[cert] [key]", "Write a self-signed certificate for localhost and Address, valid for a year.\n"+
+		"The files default to ./cert.pem and ./key.pem.")
+	args, err := parseArgs(fs, args, 0, 2)
+	if err != nil {
+		return err
+	}
+
+	certPath, keyPath := "./cert.pem", "./key.pem"
+	if len(args) > 0 {
+		certPath = args[0]
+	}
+	if len(args) > 1 {
+		keyPath = args[1]
+	}
+
+	hosts := []string{"localhost", "127.0.0.1"}
+	if !slices.Contains(hosts, cfg.Address) {
+		hosts = append(hosts, cfg.Address)
+	}
+
+	err = certs.GenerateSelfSigned(certPath, keyPath, hosts, time.Hour*24*365)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "self-signed certificate written: %s %s (hosts %s)\n", certPath, keyPath, strings.Join(hosts, ","))
+	return nil
+}
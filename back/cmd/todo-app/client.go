@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/config"
+	"github.com/pzolo85/todo-app/back/pkg/client"
+
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+// session is the client config file, written by client login
+type session struct {
+	URL    string `yaml:"url"`
+	CACert string `yaml:"ca_cert,omitempty"`
+	Email  string `yaml:"email"`
+	Token  string `yaml:"token"`
+}
+
+// sessionResult is the json output of login and logout
+type sessionResult struct {
+	Result  string `json:"result"`
+	Email   string `json:"email,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Session string `json:"session"`
+}
+
+func sessionFlag(fs *flag.FlagSet) *string {
+	path := os.Getenv("HOME") + "/.todo-app-client.yaml"
+	return fs.String("session", path, "file holding the server url and the token of the client")
+}
+
+func readSession(path string) (*session, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("not logged in, run todo-app client login")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session > %w", err)
+	}
+
+	var s session
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to decode session %s > %w", path, err)
+	}
+	return &s, nil
+}
+
+// writeSession stores s in path, readable by the owner only as it holds the token
+func writeSession(path string, s *session) error {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode session > %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write session > %w", err)
+	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(path, 0600); err != nil {
+		return fmt.Errorf("failed to write session > %w", err)
+	}
+	return nil
+}
+
+// readPassword reads a line from stdin, without echo when it is a terminal
+func readPassword() (string, error) {
+	fmt.Fprintf(os.Stderr, "password: ")
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password > %w", err)
+		}
+		return string(password), nil
+	}
+
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		return "", fmt.Errorf("failed to read password > %w", err)
+	}
+	return strings.TrimRight(password, "\r\n"), nil
+}
+
+// client returns an API client that sends the token of the session
+func (s *session) client() (*client.Client, error) {
+	httpClient, err := newHTTPClient(s.CACert)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.New(s.URL,
+		client.WithHTTPClient(httpClient),
+		client.WithUserAgent("todo-app-cli"),
+		client.WithToken(s.Token),
+	), nil
+}
+
+func clientLogin(cfg *config.Config, args []string) error {
+	fs := newFlags("client login", "<email>", "Log in and keep the token in the session file. The password is read from stdin,\n"+
+		"without echo on a terminal, and sent as the hex SHA-256 of the salt followed by the password, or -hash is sent as is.")
+	path := sessionFlag(fs)
+	url := fs.String("url", cfg.BaseURL(), "url of the server")
+	caCert := fs.String("cacert", "", "certificate to trust, for self-signed servers")
+	salt := fs.String("salt", "", "salt of the password")
+	hash := fs.String("hash", "", "hash of the password, instead of reading it from stdin")
+	format := outputFlag(fs)
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+
+	if *hash == "" {
+		if *salt == "" {
+			return fmt.Errorf("-salt or -hash is required")
+		}
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+		*hash = client.HashPassword(*salt, password)
+	}
+
+	s := &session{URL: *url, CACert: *caCert, Email: args[0]}
+	c, err := s.client()
+	if err != nil {
+		return err
+	}
+
+	s.Token, err = c.Login(context.Background(), args[0], *hash)
+	if err != nil {
+		return err
+	}
+
+	if err := writeSession(*path, s); err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(sessionResult{Result: "logged in", Email: s.Email, URL: s.URL, Session: *path})
+	}
+	fmt.Fprintf(os.Stdout, "logged in as %s, session stored in %s\n", s.Email, *path)
+	return nil
+}
+
+func clientLogout(cfg *config.Config, args []string) error {
+	fs := newFlags("client logout", "", "Forget the session. The server has no logout, the token stays valid until\n"+
+		"an admin revokes the sessions of the user.")
+	path, format := clientFlags(fs)
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+
+	if err := os.Remove(*path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove session > %w", err)
+	}
+	if *format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(sessionResult{Result: "logged out", Session: *path})
+	}
+	fmt.Fprintln(os.Stdout, "logged out")
+	return nil
+}
+
+func clientWhoami(cfg *config.Config, args []string) error {
+	fs := newFlags("client whoami", "", "Show the account of the session.")
+	path, format := clientFlags(fs)
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+
+	s, c, err := openSession(*path)
+	if err != nil {
+		return err
+	}
+
+	u, err := c.Info(context.Background())
+	if err != nil {
+		return err
+	}
+
+	info := u.Summary()
+	if *format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(info)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "email:\t%s\n", info.Email)
+	fmt.Fprintf(w, "role:\t%s\n", info.Role)
+	fmt.Fprintf(w, "server:\t%s\n", s.URL)
+	fmt.Fprintf(w, "sessions:\t%d\n", info.Sessions)
+	fmt.Fprintf(w, "created:\t%s\n", info.CreatedAt.Format(time.DateTime))
+	if info.DeleteAt != nil {
+		fmt.Fprintf(w, "deleted at:\t%s\n", info.DeleteAt.Format(time.DateTime))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pzolo85/todo-app/back/internal/testutil"
+	"github.com/pzolo85/todo-app/back/pkg/client"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.yaml")
+
+	_, err := readSession(path)
+	assert.ErrorContains(t, err, "not logged in")
+
+	s := &session{URL: "https://localhost:8080", Email: "jon@test.com", Token: "token"}
+	assert.Nil(t, writeSession(path, s))
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	read, err := readSession(path)
+	assert.Nil(t, err)
+	assert.Equal(t, s, read)
+
+	// the mode of an existing file is fixed
+	assert.Nil(t, os.Chmod(path, 0644))
+	assert.Nil(t, writeSession(path, s))
+	info, err = os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	assert.Nil(t, os.WriteFile(path, []byte("url: [\n"), 0600))
+	_, err = readSession(path)
+	assert.ErrorContains(t, err, "failed to decode session")
+}
+
+// withStdin runs f with stdin reading input
+func withStdin(t *testing.T, input string, f func()) {
+	path := filepath.Join(t.TempDir(), "stdin")
+	assert.Nil(t, os.WriteFile(path, []byte(input), 0600))
+	stdin, err := os.Open(path)
+	assert.Nil(t, err)
+	defer stdin.Close()
+
+	orig := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = orig }()
+	f()
+}
+
+func TestClient(t *testing.T) {
+	srv := testutil.NewServer(t)
+	cfg := newTestConfig(t)
+	path := filepath.Join(t.TempDir(), "session.yaml")
+
+	salt := "salt"
+	for _, email := range []string{"jon@test.com", "mary@test.com"} {
+		_, err := srv.AdminClient().AdminCreateUser(context.Background(), client.AdminCreateUserRequest{
+			Email:      email,
+			Salt:       salt,
+			HashedPass: client.HashPassword(salt, "secret"),
+			Verified:   true,
+		})
+		assert.Nil(t, err)
+	}
+
+	clientRun := func(args ...string) (int, string, string) {
+		var code int
+		stdout, stderr := capture(t, func() { code = run(cfg, commands, "todo-app", args) })
+		return code, stdout, stderr
+	}
+
+	t.Run("not logged in", func(t *testing.T) {
+		code, _, stderr := clientRun("client", "whoami", "-session", path)
+		assert.Equal(t, exitUsage, code)
+		assert.Contains(t, stderr, "not logged in")
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		var code int
+		withStdin(t, "nope\n", func() {
+			code, _, _ = clientRun("client", "login", "-session", path, "-url", srv.URL, "-salt", salt, "jon@test.com")
+		})
+		assert.Equal(t, exitUsage, code)
+		_, err := os.Stat(path)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("login", func(t *testing.T) {
+		var code int
+		var stdout string
+		withStdin(t, "secret\n", func() {
+			code, stdout, _ = clientRun("client", "login", "-session", path, "-url", srv.URL, "-salt", salt, "jon@test.com")
+		})
+		assert.Equal(t, exitOK, code)
+		assert.Contains(t, stdout, "logged in as jon@test.com")
+
+		s, err := readSession(path)
+		assert.Nil(t, err)
+		assert.Equal(t, srv.URL, s.URL)
+		assert.NotEmpty(t, s.Token)
+	})
+
+	t.Run("whoami", func(t *testing.T) {
+		code, stdout, _ := clientRun("client", "whoami", "-session", path, "-o", "json")
+		assert.Equal(t, exitOK, code)
+
+		var info client.Summary
+		assert.Nil(t, json.Unmarshal([]byte(stdout), &info))
+		assert.Equal(t, "jon@test.com", info.Email)
+		assert.Equal(t, "user", info.Role)
+		assert.Equal(t, 1, info.Sessions)
+
+		code, stdout, _ = clientRun("client", "whoami", "-session", path)
+		assert.Equal(t, exitOK, code)
+		assert.Contains(t, stdout, "server:    "+srv.URL)
+	})
+
+	var l client.List
+	t.Run("create", func(t *testing.T) {
+		code, stdout, _ := clientRun("client", "create", "-session", path, "-o", "json", "groceries")
+		assert.Equal(t, exitOK, code)
+		assert.Nil(t, json.Unmarshal([]byte(stdout), &l))
+		assert.Equal(t, "groceries", l.Name)
+		assert.Equal(t, "jon@test.com", l.Owner)
+	})
+
+	t.Run("add", func(t *testing.T) {
+		code, stdout, _ := clientRun("client", "add", "-session", path, "groceries", "milk")
+		assert.Equal(t, exitOK, code)
+		assert.Contains(t, stdout, "1  [ ]   milk")
+
+		// the list is also named by a prefix of its id
+		code, _, _ = clientRun("client", "add", "-session", path, shortID(l.ID), "eggs")
+		assert.Equal(t, exitOK, code)
+
+		code, _, stderr := clientRun("client", "add", "-session", path, "unknown", "eggs")
+		assert.Equal(t, exitUsage, code)
+		assert.Contains(t, stderr, `no list "unknown"`)
+	})
+
+	t.Run("check", func(t *testing.T) {
+		code, stdout, _ := clientRun("client", "check", "-session", path, "-o", "json", "groceries", "2")
+		assert.Equal(t, exitOK, code)
+		var got client.List
+		assert.Nil(t, json.Unmarshal([]byte(stdout), &got))
+		assert.False(t, got.Items[0].Done)
+		assert.True(t, got.Items[1].Done)
+
+		code, _, _ = clientRun("client", "check", "-session", path, "-undo", "groceries", got.Items[1].ID)
+		assert.Equal(t, exitOK, code)
+
+		code, _, stderr := clientRun("client", "check", "-session", path, "groceries", "3")
+		assert.Equal(t, exitUsage, code)
+		assert.Contains(t, stderr, "no item 3")
+	})
+
+	t.Run("share", func(t *testing.T) {
+		code, stdout, _ := clientRun("client", "share", "-session", path, "groceries", "mary@test.com")
+		assert.Equal(t, exitOK, code)
+		assert.Contains(t, stdout, "shared with mary@test.com")
+
+		code, _, stderr := clientRun("client", "share", "-session", path, "groceries", "jon@test.com")
+		assert.Equal(t, exitUsage, code)
+		assert.NotEmpty(t, stderr)
+	})
+
+	t.Run("lists", func(t *testing.T) {
+		code, stdout, _ := clientRun("client", "lists", "-session", path, "-o", "json")
+		assert.Equal(t, exitOK, code)
+		var out listsOutput
+		assert.Nil(t, json.Unmarshal([]byte(stdout), &out))
+		if assert.Len(t, out.Lists, 1) {
+			assert.Equal(t, l.ID, out.Lists[0].ID)
+			assert.Len(t, out.Lists[0].Items, 2)
+			assert.Equal(t, []string{"mary@test.com"}, out.Lists[0].SharedWith)
+		}
+
+		code, stdout, _ = clientRun("client", "lists", "-session", path)
+		assert.Equal(t, exitOK, code)
+		assert.Contains(t, stdout, shortID(l.ID)+"  groceries  0/2")
+	})
+
+	t.Run("show", func(t *testing.T) {
+		code, stdout, _ := clientRun("client", "show", "-session", path, "groceries")
+		assert.Equal(t, exitOK, code)
+		assert.Contains(t, stdout, "groceries ("+shortID(l.ID)+"), owner jon@test.com, shared with mary@test.com")
+		assert.Contains(t, stdout, "2  [ ]   eggs")
+	})
+
+	t.Run("tui needs a terminal", func(t *testing.T) {
+		var code int
+		var stderr string
+		withStdin(t, "q", func() {
+			code, _, stderr = clientRun("client", "tui", "-session", path)
+		})
+		assert.Equal(t, exitUsage, code)
+		assert.Contains(t, stderr, "needs a terminal")
+	})
+
+	t.Run("logout", func(t *testing.T) {
+		code, stdout, _ := clientRun("client", "logout", "-session", path, "-o", "json")
+		assert.Equal(t, exitOK, code)
+		var out sessionResult
+		assert.Nil(t, json.Unmarshal([]byte(stdout), &out))
+		assert.Equal(t, sessionResult{Result: "logged out", Session: path}, out)
+		_, err := os.Stat(path)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
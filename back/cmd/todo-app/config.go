@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pzolo85/todo-app/back/internal/config"
+)
+
+func configShow(cfg *config.Config, args []string) error {
+	fs := newFlags("config show", "", "Print the effective config with the secrets masked, in the config file format.")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	if config.ConfigFile != "" {
+		fmt.Fprintf(os.Stdout, "# loaded from %s\n", config.ConfigFile)
+	}
+	return cfg.WriteYAML(os.Stdout)
+}
+
+func configCheck(cfg *config.Config, args []string) error {
+	fs := newFlags("config check", "", "List every problem of the effective config, it exits with 1 when there is any.")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitCode(1)
+	}
+	fmt.Fprintln(os.Stdout, "config is valid")
+	return nil
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/backup"
+	"github.com/pzolo85/todo-app/back/internal/config"
+	"github.com/pzolo85/todo-app/back/internal/log"
+	"github.com/pzolo85/todo-app/back/internal/migrate"
+	"github.com/pzolo85/todo-app/back/internal/storage"
+)
+
+// openStore opens the configured db, it fails within a second when the server holds the lock
+func openStore(cfg *config.Config, readOnly bool) (storage.Store, error) {
+	store, err := storage.Open(cfg.DBBackend, cfg.DBPath, storage.Options{Timeout: time.Second, ReadOnly: readOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open db (is the server running?) > %w", err)
+	}
+	return store, nil
+}
+
+// stopped fails when a server is running, for the commands that need the db for themselves
+func stopped(cfg *config.Config) error {
+	srv, err := dialServer(cfg)
+	if err == nil && srv != nil {
+		url, _ := serverURL(cfg)
+		return fmt.Errorf("the server is running at %s, stop it first", url)
+	}
+	return nil
+}
+
+func dbBackup(cfg *config.Config, args []string) error {
+	fs := newFlags("db backup", "[file]", "Write a compressed archive of the db to file, by default to the working directory.\n"+
+		"While the server runs the archive is downloaded from /api/v1/admin/db/backup.")
+	args, err := parseArgs(fs, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	if err := validConfig(cfg); err != nil {
+		return err
+	}
+
+	path := backup.FileName(time.Now())
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	srv, err := dialServer(cfg)
+	if err != nil {
+		return err
+	}
+
+	if srv != nil {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create backup > %w", err)
+		}
+		defer f.Close()
+
+		if err := srv.Backup(context.Background(), f); err != nil {
+			os.Remove(path)
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("failed to write backup > %w", err)
+		}
+	} else {
+		store, err := openStore(cfg, true)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		if err := backup.WriteFile(backup.NewDefaultService(store), path); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stdout, "backup written: %s\n", path)
+	return nil
+}
+
+func dbRestore(cfg *config.Config, args []string) error {
+	fs := newFlags("db restore", "<file>", "Replace the db with the content of the archive, the server must be stopped.")
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if err := validConfig(cfg); err != nil {
+		return err
+	}
+	if err := stopped(cfg); err != nil {
+		return err
+	}
+
+	manifest, err := backup.Restore(args[0], cfg.DBBackend, cfg.DBPath, migrate.LatestVersion(migrate.Migrations))
+	if err != nil {
+		return fmt.Errorf("failed to restore db > %w", err)
+	}
+
+	fmt.Fprintf(os.Stdout, "db restored from backup created at %s (schema version %d)\n", manifest.CreatedAt, manifest.SchemaVersion)
+	return nil
+}
+
+func dbMigrate(cfg *config.Config, args []string) error {
+	fs := newFlags("db migrate", "[status|up|dry-run]", "Show or apply the schema migrations, the server must be stopped.\n\n"+
+		"  status   show the applied and pending migrations, the default\n"+
+		"  up       apply the pending migrations\n"+
+		"  dry-run  apply the pending migrations and roll them back")
+	args, err := parseArgs(fs, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	if err := validConfig(cfg); err != nil {
+		return err
+	}
+
+	cmd := "status"
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+	if cmd != "status" && cmd != "up" && cmd != "dry-run" {
+		fs.Usage()
+		return exitCode(exitUsage)
+	}
+
+	if err := stopped(cfg); err != nil {
+		return err
+	}
+
+	store, err := openStore(cfg, cmd == "status")
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	logger := log.NewDefaultService(cfg.Level, "migrate", "localhost")
+	migrator := migrate.NewDefaultService(store, logger, migrate.Migrations)
+
+	if cmd == "status" {
+		version, err := migrator.Version()
+		if err != nil {
+			return err
+		}
+		status, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stdout, "schema version: %d (latest %d)\n", version, migrator.Latest())
+		for _, s := range status {
+			state := "pending"
+			if s.Applied {
+				state = "applied"
+			}
+			fmt.Fprintf(os.Stdout, "%4d  %-8s %s\n", s.Version, state, s.Name)
+		}
+		return nil
+	}
+
+	dryRun := cmd == "dry-run"
+	applied, err := migrator.Up(dryRun)
+	if err != nil {
+		return fmt.Errorf("failed to migrate db > %w", err)
+	}
+
+	prefix := "applied"
+	if dryRun {
+		prefix = "would apply"
+	}
+	for _, m := range applied {
+		fmt.Fprintf(os.Stdout, "%s %d: %s\n", prefix, m.Version, m.Name)
+	}
+	if len(applied) == 0 {
+		fmt.Fprintf(os.Stdout, "schema is up to date\n")
+	}
+
+	// the user keys follow the configured email rules
+	rules := cfg.Emails().Rules()
+	if dryRun {
+		stored, err := migrator.EmailRules()
+		if err != nil {
+			return err
+		}
+		if stored != rules {
+			fmt.Fprintf(os.Stdout, "would canonicalize user emails: %s rules\n", rules)
+		}
+		return nil
+	}
+	changed, err := migrator.CanonicalizeEmails(cfg.Emails())
+	if err != nil {
+		return err
+	}
+	if changed {
+		fmt.Fprintf(os.Stdout, "canonicalized user emails: %s rules\n", rules)
+	}
+	return nil
+}
+
+func dbInspect(cfg *config.Config, args []string) error {
+	fs := newFlags("db inspect", "", "Show the backend, size, schema version and buckets of the db. It is opened read-only,\n"+
+		"the server must be stopped.")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if err := validConfig(cfg); err != nil {
+		return err
+	}
+
+	if err := stopped(cfg); err != nil {
+		return err
+	}
+
+	store, err := openStore(cfg, true)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var size int64
+	// sqlite keeps recent writes in the wal file
+	for _, path := range []string{cfg.DBPath, cfg.DBPath + "-wal"} {
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "path:\t%s\n", cfg.DBPath)
+	fmt.Fprintf(w, "backend:\t%s\n", store.Backend())
+	fmt.Fprintf(w, "size:\t%d bytes\n", size)
+
+	err = store.View(func(tx storage.Tx) error {
+		version, err := migrate.ReadVersion(tx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "schema version:\t%d (latest %d)\n\nBUCKET\tKEYS\n", version, migrate.LatestVersion(migrate.Migrations))
+
+		return tx.ForEachBucket(func(name []byte) error {
+			keys := 0
+			err := tx.ForEach(name, func(k, v []byte) error {
+				keys++
+				return nil
+			})
+			fmt.Fprintf(w, "%s\t%d\n", name, keys)
+			return err
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to inspect db > %w", err)
+	}
+
+	return w.Flush()
+}
+
+func dbConvert(cfg *config.Config, args []string) error {
+	fs := newFlags("db convert", "<backend>:<path> <backend>:<path>", "Copy every bucket from the first store to the second one, e.g.\n\n"+
+		"  todo-app db convert bolt:./db.bolt sqlite:./db.sqlite")
+	args, err := parseArgs(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	open := func(arg string, opts storage.Options) (storage.Store, error) {
+		backend, path, ok := strings.Cut(arg, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid store %q, expected <backend>:<path>", arg)
+		}
+		return storage.Open(backend, path, opts)
+	}
+
+	src, err := open(args[0], storage.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to open source db (is the server running?) > %w", err)
+	}
+	defer src.Close()
+
+	dst, err := open(args[1], storage.Options{Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("failed to open destination db > %w", err)
+	}
+	defer dst.Close()
+
+	if err := storage.Copy(dst, src); err != nil {
+		return fmt.Errorf("failed to convert db > %w", err)
+	}
+
+	fmt.Fprintf(os.Stdout, "db converted from %s to %s\n", args[0], args[1])
+	return nil
+}
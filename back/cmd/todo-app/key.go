@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/config"
+
+	"github.com/google/uuid"
+)
+
+func keyGenerate(cfg *config.Config, args []string) error {
+	fs := newFlags("key generate", "", "Write a new JWT signing key to the key file, see -key-path. The file must not exist.")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(config.KeyFile); err == nil {
+		return fmt.Errorf("key file %s exists, use todo-app key rotate to replace it", config.KeyFile)
+	}
+
+	if err := writeKey(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "new key generated: %s\n", config.KeyFile)
+	return nil
+}
+
+func keyRotate(cfg *config.Config, args []string) error {
+	fs := newFlags("key rotate", "", "Replace the JWT signing key, the old key file is kept with a .bak suffix.\n"+
+		"Every token signed with the old key is revoked once the server restarts.")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	backup := fmt.Sprintf("%s.%s.bak", config.KeyFile, time.Now().Format("20060102T150405"))
+	err := os.Rename(config.KeyFile, backup)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to back up key > %w", err)
+	}
+
+	if err := writeKey(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "new key generated: %s\n", config.KeyFile)
+	if err == nil {
+		fmt.Fprintf(os.Stdout, "old key moved to: %s\n", backup)
+	}
+	fmt.Fprintf(os.Stderr, "warning: restart the server to use the new key, every session and admin token is revoked\n")
+	return nil
+}
+
+// writeKey writes a random passphrase to the key file, readable only by its owner
+func writeKey() error {
+	key := uuid.NewString()
+	err := os.WriteFile(config.KeyFile, []byte(key), 0400)
+	if err != nil {
+		return fmt.Errorf("failed to generate key > %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pzolo85/todo-app/back/internal/config"
+	"github.com/pzolo85/todo-app/back/pkg/client"
+)
+
+// listsOutput is the json output of client lists
+type listsOutput struct {
+	Lists []client.List `json:"lists"`
+}
+
+// openSession returns the session in path and a client of it
+func openSession(path string) (*session, *client.Client, error) {
+	s, err := readSession(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := s.client()
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, c, nil
+}
+
+// findList returns the list named by ref: its id, its name or a prefix of its id
+func findList(ctx context.Context, c *client.Client, ref string) (*client.List, error) {
+	lists, err := c.Lists(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []client.List
+	for _, match := range []func(l client.List) bool{
+		func(l client.List) bool { return l.ID == ref },
+		func(l client.List) bool { return l.Name == ref },
+		func(l client.List) bool { return strings.HasPrefix(l.ID, ref) },
+	} {
+		for _, l := range lists {
+			if match(l) {
+				found = append(found, l)
+			}
+		}
+		if len(found) > 0 {
+			break
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("no list %q, see todo-app client lists", ref)
+	case 1:
+		return &found[0], nil
+	}
+	return nil, fmt.Errorf("%q names %d lists, use the id", ref, len(found))
+}
+
+// findItem returns the item of l named by ref: its number, its id or a prefix of its id
+func findItem(l *client.List, ref string) (*client.Item, error) {
+	if n, err := strconv.Atoi(ref); err == nil {
+		if n < 1 || n > len(l.Items) {
+			return nil, fmt.Errorf("no item %d, %s has %d", n, l.Name, len(l.Items))
+		}
+		return &l.Items[n-1], nil
+	}
+
+	var found []*client.Item
+	for i := range l.Items {
+		if l.Items[i].ID == ref {
+			return &l.Items[i], nil
+		}
+		if strings.HasPrefix(l.Items[i].ID, ref) {
+			found = append(found, &l.Items[i])
+		}
+	}
+	if len(found) != 1 {
+		return nil, fmt.Errorf("no single item %q in %s, use its number", ref, l.Name)
+	}
+	return found[0], nil
+}
+
+// shortID is the part of the id shown in tables, commands accept it as a prefix
+func shortID(id string) string {
+	return id[:min(len(id), 8)]
+}
+
+func doneCount(l client.List) int {
+	done := 0
+	for _, item := range l.Items {
+		if item.Done {
+			done++
+		}
+	}
+	return done
+}
+
+func printLists(format string, lists []client.List) error {
+	if format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(listsOutput{Lists: lists})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID\tNAME\tDONE\tOWNER\tSHARED WITH\n")
+	for _, l := range lists {
+		fmt.Fprintf(w, "%s\t%s\t%d/%d\t%s\t%s\n", shortID(l.ID), l.Name, doneCount(l), len(l.Items), l.Owner, strings.Join(l.SharedWith, ","))
+	}
+	return w.Flush()
+}
+
+func printList(format string, l *client.List) error {
+	if format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(l)
+	}
+
+	fmt.Fprintf(os.Stdout, "%s (%s), owner %s", l.Name, shortID(l.ID), l.Owner)
+	if len(l.SharedWith) > 0 {
+		fmt.Fprintf(os.Stdout, ", shared with %s", strings.Join(l.SharedWith, ", "))
+	}
+	fmt.Fprintln(os.Stdout)
+	if len(l.Items) == 0 {
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "#\tDONE\tITEM\n")
+	for i, item := range l.Items {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", i+1, checkbox(item.Done), item.Text)
+	}
+	return w.Flush()
+}
+
+func checkbox(done bool) string {
+	if done {
+		return "[x]"
+	}
+	return "[ ]"
+}
+
+// clientFlags adds the flags shared by the client commands
+func clientFlags(fs *flag.FlagSet) (path *string, format *string) {
+	return sessionFlag(fs), outputFlag(fs)
+}
+
+func clientLists(cfg *config.Config, args []string) error {
+	fs := newFlags("client lists", "", "Show the lists of the session, then the lists shared with it.")
+	path, format := clientFlags(fs)
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+
+	_, c, err := openSession(*path)
+	if err != nil {
+		return err
+	}
+	lists, err := c.Lists(context.Background())
+	if err != nil {
+		return err
+	}
+	return printLists(*format, lists)
+}
+
+func clientCreate(cfg *config.Config, args []string) error {
+	fs := newFlags("client create", "<name>", "Create a list.")
+	path, format := clientFlags(fs)
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+
+	_, c, err := openSession(*path)
+	if err != nil {
+		return err
+	}
+	l, err := c.CreateList(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+	return printList(*format, l)
+}
+
+func clientShow(cfg *config.Config, args []string) error {
+	fs := newFlags("client show", "<list>", "Show the items of a list. The list is named by its id, a prefix of it or its name.")
+	path, format := clientFlags(fs)
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+
+	_, c, err := openSession(*path)
+	if err != nil {
+		return err
+	}
+	l, err := findList(context.Background(), c, args[0])
+	if err != nil {
+		return err
+	}
+	return printList(*format, l)
+}
+
+func clientAdd(cfg *config.Config, args []string) error {
+	fs := newFlags("client add", "<list> <text>", "Add an item to a list.")
+	path, format := clientFlags(fs)
+	args, err := parseArgs(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	_, c, err := openSession(*path)
+	if err != nil {
+		return err
+	}
+	l, err := findList(ctx, c, args[0])
+	if err != nil {
+		return err
+	}
+	l, err = c.AddItem(ctx, l.ID, args[1])
+	if err != nil {
+		return err
+	}
+	return printList(*format, l)
+}
+
+func clientCheck(cfg *config.Config, args []string) error {
+	fs := newFlags("client check", "<list> <item>", "Check off an item of a list. The item is named by its number in client show or its id.")
+	path, format := clientFlags(fs)
+	undo := fs.Bool("undo", false, "uncheck the item")
+	args, err := parseArgs(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	_, c, err := openSession(*path)
+	if err != nil {
+		return err
+	}
+	l, err := findList(ctx, c, args[0])
+	if err != nil {
+		return err
+	}
+	item, err := findItem(l, args[1])
+	if err != nil {
+		return err
+	}
+	l, err = c.CheckItem(ctx, l.ID, item.ID, !*undo)
+	if err != nil {
+		return err
+	}
+	return printList(*format, l)
+}
+
+func clientShare(cfg *config.Config, args []string) error {
+	fs := newFlags("client share", "<list> <email>", "Share a list with another user, who can then add and check off items.\n"+
+		"Only the owner of a list can share it.")
+	path, format := clientFlags(fs)
+	args, err := parseArgs(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	_, c, err := openSession(*path)
+	if err != nil {
+		return err
+	}
+	l, err := findList(ctx, c, args[0])
+	if err != nil {
+		return err
+	}
+	l, err = c.ShareList(ctx, l.ID, args[1])
+	if err != nil {
+		return err
+	}
+	return printList(*format, l)
+}
@@ -0,0 +1,193 @@
+// Copyright 2024 pzolo85. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// todo-app
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pzolo85/todo-app/back/internal/config"
+)
+
+// command is a cli command, either a group of sub commands or a runnable one
+type command struct {
+	name    string
+	summary string
+	run     func(cfg *config.Config, args []string) error
+	sub     []*command
+}
+
+var commands = []*command{
+	{name: "serve", summary: "run the server", run: serveCmd},
+	{name: "key", summary: "manage the JWT signing key", sub: []*command{
+		{name: "generate", summary: "write a new key, the key file must not exist", run: keyGenerate},
+		{name: "rotate", summary: "replace the key, every token signed with the old one is revoked", run: keyRotate},
+	}},
+	{name: "token", summary: "sign tokens", sub: []*command{
+		{name: "sign", summary: "sign an admin token", run: tokenSign},
+	}},
+	{name: "user", summary: "manage users", sub: []*command{
+		{name: "add", summary: "create a user with a generated password", run: userAdd},
+		{name: "list", summary: "list the users", run: userList},
+		{name: "disable", summary: "mark the email address of a user as not verified", run: userDisable},
+		{name: "make-admin", summary: "give a user the admin role", run: userMakeAdmin},
+		{name: "demote", summary: "give an admin the user role", run: userDemote},
+		{name: "suspend", summary: "block the login of a user and revoke its sessions", run: userSuspend},
+		{name: "resume", summary: "lift the suspension of a user", run: userResume},
+		{name: "reset-password", summary: "replace the password of a user with a generated one", run: userResetPassword},
+		{name: "revoke-sessions", summary: "revoke every session of a user", run: userRevokeSessions},
+	}},
+	{name: "client", summary: "use the API as a user", sub: []*command{
+		{name: "login", summary: "log in and keep the token in the session file", run: clientLogin},
+		{name: "whoami", summary: "show the account of the session", run: clientWhoami},
+		{name: "logout", summary: "forget the session", run: clientLogout},
+		{name: "lists", summary: "show the lists of the session and the lists shared with it", run: clientLists},
+		{name: "create", summary: "create a list", run: clientCreate},
+		{name: "show", summary: "show the items of a list", run: clientShow},
+		{name: "add", summary: "add an item to a list", run: clientAdd},
+		{name: "check", summary: "check off an item of a list", run: clientCheck},
+		{name: "share", summary: "share a list with another user", run: clientShare},
+		{name: "tui", summary: "browse and edit the lists in the terminal", run: clientTUI},
+	}},
+	{name: "db", summary: "manage the database", sub: []*command{
+		{name: "backup", summary: "write a compressed archive of the db", run: dbBackup},
+		{name: "restore", summary: "replace the db with an archive", run: dbRestore},
+		{name: "migrate", summary: "show or apply the schema migrations", run: dbMigrate},
+		{name: "inspect", summary: "show the schema version, buckets and size of the db", run: dbInspect},
+		{name: "convert", summary: "copy every bucket from one store to another", run: dbConvert},
+	}},
+	{name: "config", summary: "show or check the effective config", sub: []*command{
+		{name: "show", summary: "print the config with the secrets masked, in the config file format", run: configShow},
+		{name: "check", summary: "list every problem of the config", run: configCheck},
+	}},
+	{name: "cert", summary: "manage TLS certificates", sub: []*command{
+		{name: "generate", summary: "write a self-signed certificate for Address, valid for a year", run: certGenerate},
+	}},
+}
+
+// exitCode is returned by commands that already reported the problem, to exit with the code
+type exitCode int
+
+func (c exitCode) Error() string {
+	return fmt.Sprintf("exit code %d", int(c))
+}
+
+// exit code of cli errors, see Serve for the others
+const exitUsage = 2
+
+func main() {
+	config.Commands = listCommands(commands, "")
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config > %s\n", err.Error())
+		os.Exit(exitUsage)
+	}
+
+	os.Exit(run(cfg, commands, "todo-app", flag.Args()))
+}
+
+// run finds the command named by args and runs it, it returns the exit code
+func run(cfg *config.Config, cmds []*command, path string, args []string) int {
+	if len(args) == 0 {
+		flag.Usage()
+		return exitUsage
+	}
+
+	name := args[0]
+	if name == "-h" || name == "-help" || name == "--help" || name == "help" {
+		showCommands(path, cmds)
+		return exitOK
+	}
+
+	for _, cmd := range cmds {
+		if cmd.name != name {
+			continue
+		}
+
+		path := path + " " + name
+		if cmd.run == nil {
+			if len(args) == 1 {
+				showCommands(path, cmd.sub)
+				return exitUsage
+			}
+			return run(cfg, cmd.sub, path, args[1:])
+		}
+
+		err := cmd.run(cfg, args[1:])
+		var code exitCode
+		switch {
+		case err == nil:
+			return exitOK
+		case errors.Is(err, flag.ErrHelp):
+			return exitOK
+		case errors.As(err, &code):
+			return int(code)
+		}
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return exitUsage
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command: %s\n", strings.TrimSpace(strings.TrimPrefix(path, "todo-app")+" "+name))
+	showCommands(path, cmds)
+	return exitUsage
+}
+
+func listCommands(cmds []*command, prefix string) string {
+	var b strings.Builder
+	for _, cmd := range cmds {
+		if cmd.run != nil {
+			fmt.Fprintf(&b, "   %-22s %s\n", prefix+cmd.name, cmd.summary)
+			continue
+		}
+		b.WriteString(listCommands(cmd.sub, prefix+cmd.name+" "))
+	}
+	return b.String()
+}
+
+func showCommands(path string, cmds []*command) {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags] [args]\n\nCommands:\n\n%s\nRun %s <command> -h for the help of a command.\n",
+		path, listCommands(cmds, ""), path)
+}
+
+// newFlags returns the flag set of a command, args describes the positional args
+// and -h prints the help built from summary and the flags.
+func newFlags(path string, args string, summary string) *flag.FlagSet {
+	fs := flag.NewFlagSet(path, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: todo-app %s [flags] %s\n\n%s\n", path, args, summary)
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintf(fs.Output(), "\nFlags:\n\n")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// parseArgs parses the flags of fs and checks the number of positional args left
+func parseArgs(fs *flag.FlagSet, args []string, min int, max int) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if fs.NArg() < min || fs.NArg() > max {
+		fs.Usage()
+		return nil, exitCode(exitUsage)
+	}
+	return fs.Args(), nil
+}
+
+// validConfig fails when the config has problems, see config check
+func validConfig(cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config, run todo-app config check for details > %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/auth"
+	"github.com/pzolo85/todo-app/back/internal/config"
+	"github.com/pzolo85/todo-app/back/internal/log"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+// capture returns what f writes to stdout and stderr
+func capture(t *testing.T, f func()) (string, string) {
+	dir := t.TempDir()
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	assert.Nil(t, err)
+	stderr, err := os.Create(filepath.Join(dir, "stderr"))
+	assert.Nil(t, err)
+
+	origOut, origErr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdout, stderr
+	defer func() { os.Stdout, os.Stderr = origOut, origErr }()
+	f()
+
+	stdout.Close()
+	stderr.Close()
+	out, err := os.ReadFile(stdout.Name())
+	assert.Nil(t, err)
+	errOut, err := os.ReadFile(stderr.Name())
+	assert.Nil(t, err)
+	return string(out), string(errOut)
+}
+
+func newTestConfig(t *testing.T) *config.Config {
+	cfg := config.Defaults()
+	cfg.Key = []byte("test-signing-key")
+	cfg.DBPath = filepath.Join(t.TempDir(), "todo.db")
+	return cfg
+}
+
+func TestParseArgs(t *testing.T) {
+	newFS := func() (*flag.FlagSet, *string) {
+		fs := newFlags("test", "<email>", "test command")
+		return fs, fs.String("e", "default", "email")
+	}
+
+	t.Run("flags and args", func(t *testing.T) {
+		fs, e := newFS()
+		args, err := parseArgs(fs, []string{"-e", "jon@test.com", "arg"}, 1, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"arg"}, args)
+		assert.Equal(t, "jon@test.com", *e)
+	})
+
+	t.Run("wrong number of args", func(t *testing.T) {
+		fs, _ := newFS()
+		_, stderr := capture(t, func() {
+			_, err := parseArgs(fs, []string{"a", "b"}, 0, 1)
+			assert.Equal(t, exitCode(exitUsage), err)
+		})
+		assert.Contains(t, stderr, "Usage: todo-app test [flags] <email>")
+	})
+
+	t.Run("help", func(t *testing.T) {
+		fs, _ := newFS()
+		_, stderr := capture(t, func() {
+			_, err := parseArgs(fs, []string{"-h"}, 0, 0)
+			assert.ErrorIs(t, err, flag.ErrHelp)
+		})
+		assert.Contains(t, stderr, "-e string")
+	})
+
+	t.Run("unknown flag", func(t *testing.T) {
+		fs, _ := newFS()
+		capture(t, func() {
+			_, err := parseArgs(fs, []string{"-x"}, 0, 0)
+			assert.NotNil(t, err)
+		})
+	})
+}
+
+func TestRun(t *testing.T) {
+	var got []string
+	cmds := []*command{
+		{name: "ok", run: func(cfg *config.Config, args []string) error {
+			got = args
+			return nil
+		}},
+		{name: "group", sub: []*command{
+			{name: "fail", run: func(cfg *config.Config, args []string) error { return errors.New("boom") }},
+			{name: "code", run: func(cfg *config.Config, args []string) error { return exitCode(3) }},
+			{name: "help", run: func(cfg *config.Config, args []string) error { return flag.ErrHelp }},
+		}},
+	}
+	cfg := config.Defaults()
+
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		stderr string
+	}{
+		{name: "no args", args: nil, code: exitUsage},
+		{name: "help", args: []string{"help"}, code: exitOK, stderr: "Commands:"},
+		{name: "unknown command", args: []string{"nope"}, code: exitUsage, stderr: "unknown command: nope"},
+		{name: "unknown sub command", args: []string{"group", "nope"}, code: exitUsage, stderr: "unknown command: group nope"},
+		{name: "group without sub command", args: []string{"group"}, code: exitUsage, stderr: "Usage: todo-app group <command>"},
+		{name: "runs the command", args: []string{"ok", "a", "b"}, code: exitOK},
+		{name: "error", args: []string{"group", "fail"}, code: exitUsage, stderr: "boom"},
+		{name: "exit code", args: []string{"group", "code"}, code: 3},
+		{name: "command help", args: []string{"group", "help"}, code: exitOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var code int
+			_, stderr := capture(t, func() { code = run(cfg, cmds, "todo-app", tt.args) })
+			assert.Equal(t, tt.code, code)
+			assert.Contains(t, stderr, tt.stderr)
+		})
+	}
+	assert.Equal(t, []string{"a", "b"}, got)
+}
+
+func TestCommands(t *testing.T) {
+	// every command of the list is runnable or has sub commands
+	var walk func(cmds []*command)
+	walk = func(cmds []*command) {
+		for _, cmd := range cmds {
+			assert.True(t, (cmd.run == nil) != (cmd.sub == nil), cmd.name)
+			assert.NotEmpty(t, cmd.summary, cmd.name)
+			walk(cmd.sub)
+		}
+	}
+	walk(commands)
+	assert.Contains(t, listCommands(commands, ""), "token sign")
+}
+
+func TestTokenSign(t *testing.T) {
+	cfg := newTestConfig(t)
+
+	var code int
+	stdout, _ := capture(t, func() {
+		code = run(cfg, commands, "todo-app", []string{"token", "sign", "-e", "Root@Test.com", "-d", "1h"})
+	})
+	assert.Equal(t, exitOK, code)
+
+	authSvc := auth.NewDefaultService(cfg.Key, jwt.SigningMethodHS256, cfg.TokenValidation(), log.NewDefaultService("error", "test", "localhost"))
+	c, err := authSvc.DecodeToken(context.Background(), stdout)
+	assert.Nil(t, err)
+	assert.Equal(t, "root@test.com", c.Email)
+	assert.True(t, c.IsAdmin)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), c.ExpiresAt, time.Minute)
+
+	t.Run("missing key", func(t *testing.T) {
+		cfg.Key = nil
+		_, stderr := capture(t, func() {
+			code = run(cfg, commands, "todo-app", []string{"token", "sign"})
+		})
+		assert.Equal(t, exitUsage, code)
+		assert.Contains(t, stderr, "signing key is missing")
+	})
+}
+
+func TestConfigCheck(t *testing.T) {
+	cfg := newTestConfig(t)
+
+	var code int
+	stdout, _ := capture(t, func() { code = run(cfg, commands, "todo-app", []string{"config", "check"}) })
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "config is valid\n", stdout)
+
+	cfg.Key = nil
+	cfg.Port = 0
+	_, stderr := capture(t, func() { code = run(cfg, commands, "todo-app", []string{"config", "check"}) })
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "key: jwt signing key is missing")
+	assert.Contains(t, stderr, "port: must be between 1 and 65535")
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/pzolo85/todo-app/back/internal/app"
+	"github.com/pzolo85/todo-app/back/internal/config"
+)
+
+func serveCmd(cfg *config.Config, args []string) error {
+	fs := newFlags("serve", "", "Run the server and the background jobs until SIGINT or SIGTERM.")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if err := validConfig(cfg); err != nil {
+		return err
+	}
+
+	svc, err := app.Load(cfg, app.Options{})
+	if err != nil {
+		return err
+	}
+
+	svc.Logger.Debug("config", "cfg", cfg.Masked())
+	if code := Serve(cfg, svc); code != exitOK {
+		return exitCode(code)
+	}
+	return nil
+}
+
+// exit codes of Serve
+const (
+	exitOK = iota
+	exitServerError
+	_ // 2 is used by cli errors
+	exitShutdownTimeout
+	exitDBCloseError
+)
+
+// Worker is a background job that runs until ctx is done
+type Worker interface {
+	Run(ctx context.Context)
+}
+
+// Serve runs the server and the background workers until SIGINT or SIGTERM.
+// In-flight requests and the exports they started are drained for up to
+// ShutdownTimeout, then the workers are stopped and the db is closed. It returns the exit code of the process.
+func Serve(cfg *config.Config, svc *app.Services) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	workers := map[string]Worker{"purge": svc.PurgeJob, "config_watcher": svc.ConfigWatcher}
+	if svc.BackupJob != nil {
+		workers["backup"] = svc.BackupJob
+	}
+	if svc.CertReloader != nil {
+		workers["cert_reloader"] = svc.CertReloader
+	}
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for name, w := range workers {
+		wg.Add(1)
+		svc.Workers.Set(name, true)
+		go func() {
+			defer wg.Done()
+			defer svc.Workers.Set(name, false)
+			w.Run(workerCtx)
+		}()
+	}
+
+	srvErr := make(chan error, 1)
+	go func() {
+		srvErr <- svc.Server.Start(cfg.Address, cfg.Port)
+	}()
+
+	code := exitOK
+	select {
+	case err := <-srvErr:
+		svc.Logger.Error("server crashed", "err", err)
+		code = exitServerError
+	case <-ctx.Done():
+		// a second signal kills the process
+		stop()
+		svc.Logger.Info("shutting down", "timeout", cfg.ShutdownTimeout)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := svc.Server.Shutdown(shutdownCtx); err != nil {
+		svc.Logger.Error("failed to drain requests", "err", err.Error())
+		code = max(code, exitShutdownTimeout)
+	}
+
+	// no request can start an export anymore
+	if err := svc.Exporter.Shutdown(shutdownCtx); err != nil {
+		svc.Logger.Error("exports did not finish in time", "err", err.Error())
+		code = max(code, exitShutdownTimeout)
+	}
+
+	stopWorkers()
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-shutdownCtx.Done():
+		svc.Logger.Error("background workers did not stop in time")
+		code = max(code, exitShutdownTimeout)
+	}
+
+	if err := svc.ShutdownTracer(shutdownCtx); err != nil {
+		svc.Logger.Error("failed to flush traces", "err", err.Error())
+	}
+
+	if err := svc.Store.Close(); err != nil {
+		svc.Logger.Error("failed to close db", "err", err.Error())
+		code = max(code, exitDBCloseError)
+	}
+
+	svc.Logger.Info("shutdown complete", "exit_code", code)
+	return code
+}
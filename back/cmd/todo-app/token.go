@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/auth"
+	"github.com/pzolo85/todo-app/back/internal/claim"
+	"github.com/pzolo85/todo-app/back/internal/config"
+	"github.com/pzolo85/todo-app/back/internal/log"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+)
+
+func tokenSign(cfg *config.Config, args []string) error {
+	fs := newFlags("token sign", "", "Sign a JWT with admin permissions and print it.")
+	duration := fs.Duration("d", time.Minute*15, "duration of the token")
+	email := fs.String("e", "admin@localhost", "email of the token")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	token, err := signAdminToken(cfg, *email, *duration, "todo-app")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "%s", token)
+	return nil
+}
+
+// signAdminToken signs a token with admin permissions using the configured key, no db is needed
+func signAdminToken(cfg *config.Config, email string, d time.Duration, userAgent string) (string, error) {
+	if len(cfg.Key) == 0 {
+		return "", fmt.Errorf("signing key is missing, run todo-app key generate")
+	}
+
+	email, err := cfg.Emails().Normalize(email)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	c := claim.UserClaim{
+		Email:     email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(d),
+		IsAdmin:   true,
+		ClaimID:   uuid.NewString(),
+		SourceIP:  "127.0.0.1",
+		UserAgent: userAgent,
+	}
+
+	authSvc := auth.NewDefaultService(cfg.Key, jwt.SigningMethodHS256, cfg.TokenValidation(), log.NewDefaultService(cfg.Level, "cli", "localhost"))
+	token, err := authSvc.GetJWT(context.Background(), &c)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate JWT token > %w", err)
+	}
+	return token, nil
+}
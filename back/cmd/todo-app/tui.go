@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/pzolo85/todo-app/back/internal/config"
+	"github.com/pzolo85/todo-app/back/pkg/client"
+
+	"golang.org/x/term"
+)
+
+// listAPI is the part of the client used by the tui
+type listAPI interface {
+	Lists(ctx context.Context) ([]client.List, error)
+	CreateList(ctx context.Context, name string) (*client.List, error)
+	AddItem(ctx context.Context, id string, text string) (*client.List, error)
+	CheckItem(ctx context.Context, id string, item string, done bool) (*client.List, error)
+	ShareList(ctx context.Context, id string, email string) (*client.List, error)
+}
+
+// keys that are not a printable rune, see readKey
+const (
+	keyUp        = "up"
+	keyDown      = "down"
+	keyLeft      = "left"
+	keyRight     = "right"
+	keyEnter     = "enter"
+	keyEsc       = "esc"
+	keyBackspace = "backspace"
+	keyCtrlC     = "ctrl-c"
+)
+
+// tui is the state of client tui. It shows the lists of the session, or the
+// items of the open one, and a prompt for the text of the actions that need it.
+type tui struct {
+	api   listAPI
+	email string
+
+	lists []client.List
+	// list is the selected list, item the selected item of the open list
+	list int
+	item int
+	open bool
+
+	// prompt asks for the input of submit, it is empty when there is no question
+	prompt string
+	input  []rune
+	submit func(ctx context.Context, text string) error
+
+	status string
+	quit   bool
+}
+
+func newTUI(api listAPI, email string) *tui {
+	return &tui{api: api, email: email}
+}
+
+// refresh reloads the lists and keeps the selection in range
+func (t *tui) refresh(ctx context.Context) error {
+	lists, err := t.api.Lists(ctx)
+	if err != nil {
+		return err
+	}
+	t.lists = lists
+	t.list = clamp(t.list, len(t.lists))
+	if t.open && len(t.lists) == 0 {
+		t.open = false
+	}
+	if t.open {
+		t.item = clamp(t.item, len(t.lists[t.list].Items))
+	}
+	return nil
+}
+
+func clamp(i int, n int) int {
+	return max(0, min(i, n-1))
+}
+
+// replace stores l, as answered by the server after a change
+func (t *tui) replace(l *client.List) {
+	for i := range t.lists {
+		if t.lists[i].ID == l.ID {
+			t.lists[i] = *l
+			return
+		}
+	}
+	t.lists = append(t.lists, *l)
+	t.list = len(t.lists) - 1
+}
+
+// ask shows prompt and runs submit with the text entered
+func (t *tui) ask(prompt string, submit func(ctx context.Context, text string) error) {
+	t.prompt = prompt
+	t.input = nil
+	t.submit = submit
+}
+
+// handle applies key, errors of the server are shown in the status line
+func (t *tui) handle(ctx context.Context, key string) {
+	if err := t.handleKey(ctx, key); err != nil {
+		t.status = err.Error()
+	}
+}
+
+func (t *tui) handleKey(ctx context.Context, key string) error {
+	if key == keyCtrlC {
+		t.quit = true
+		return nil
+	}
+	if t.prompt != "" {
+		return t.handleInput(ctx, key)
+	}
+
+	t.status = ""
+	switch key {
+	case "q":
+		t.quit = true
+		return nil
+	case "r":
+		return t.refresh(ctx)
+	}
+	if t.open {
+		return t.handleItems(ctx, key)
+	}
+	return t.handleLists(key)
+}
+
+func (t *tui) handleInput(ctx context.Context, key string) error {
+	switch key {
+	case keyEsc:
+		t.prompt = ""
+	case keyBackspace:
+		if len(t.input) > 0 {
+			t.input = t.input[:len(t.input)-1]
+		}
+	case keyEnter:
+		text := strings.TrimSpace(string(t.input))
+		t.prompt = ""
+		if text == "" {
+			return nil
+		}
+		return t.submit(ctx, text)
+	default:
+		if r := []rune(key); len(r) == 1 && unicode.IsPrint(r[0]) {
+			t.input = append(t.input, r[0])
+		}
+	}
+	return nil
+}
+
+func (t *tui) handleLists(key string) error {
+	switch key {
+	case keyUp, "k":
+		t.list = clamp(t.list-1, len(t.lists))
+	case keyDown, "j":
+		t.list = clamp(t.list+1, len(t.lists))
+	case keyEnter, keyRight, "l":
+		if len(t.lists) > 0 {
+			t.open = true
+			t.item = 0
+		}
+	case "n":
+		t.ask("new list", func(ctx context.Context, name string) error {
+			l, err := t.api.CreateList(ctx, name)
+			if err != nil {
+				return err
+			}
+			t.replace(l)
+			return nil
+		})
+	}
+	return nil
+}
+
+func (t *tui) handleItems(ctx context.Context, key string) error {
+	l := &t.lists[t.list]
+	// the prompts outlive l, a refresh replaces the lists
+	id := l.ID
+	switch key {
+	case keyUp, "k":
+		t.item = clamp(t.item-1, len(l.Items))
+	case keyDown, "j":
+		t.item = clamp(t.item+1, len(l.Items))
+	case keyEsc, keyLeft, keyBackspace, "h":
+		t.open = false
+	case " ", "x", keyEnter:
+		if len(l.Items) == 0 {
+			return nil
+		}
+		item := l.Items[t.item]
+		updated, err := t.api.CheckItem(ctx, l.ID, item.ID, !item.Done)
+		if err != nil {
+			return err
+		}
+		t.replace(updated)
+	case "a":
+		t.ask("new item", func(ctx context.Context, text string) error {
+			updated, err := t.api.AddItem(ctx, id, text)
+			if err != nil {
+				return err
+			}
+			t.replace(updated)
+			t.item = len(updated.Items) - 1
+			return nil
+		})
+	case "s":
+		t.ask("share with", func(ctx context.Context, email string) error {
+			updated, err := t.api.ShareList(ctx, id, email)
+			if err != nil {
+				return err
+			}
+			t.replace(updated)
+			t.status = "shared with " + email
+			return nil
+		})
+	}
+	return nil
+}
+
+// view renders the screen, lines end with \n
+func (t *tui) view() string {
+	var b strings.Builder
+	if t.open {
+		l := t.lists[t.list]
+		fmt.Fprintf(&b, "%s  (space check, a add, s share, esc back, r refresh, q quit)\n", l.Name)
+		fmt.Fprintf(&b, "owner %s", l.Owner)
+		if len(l.SharedWith) > 0 {
+			fmt.Fprintf(&b, ", shared with %s", strings.Join(l.SharedWith, ", "))
+		}
+		b.WriteString("\n\n")
+		if len(l.Items) == 0 {
+			b.WriteString("  no items yet\n")
+		}
+		for i, item := range l.Items {
+			fmt.Fprintf(&b, "%s %s %s\n", cursor(i == t.item), checkbox(item.Done), item.Text)
+		}
+	} else {
+		fmt.Fprintf(&b, "lists of %s  (enter open, n new, r refresh, q quit)\n\n", t.email)
+		if len(t.lists) == 0 {
+			b.WriteString("  no lists yet\n")
+		}
+		for i, l := range t.lists {
+			fmt.Fprintf(&b, "%s %s  %d/%d", cursor(i == t.list), l.Name, doneCount(l), len(l.Items))
+			if l.Owner != t.email {
+				fmt.Fprintf(&b, "  from %s", l.Owner)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	b.WriteString("\n")
+	if t.prompt != "" {
+		fmt.Fprintf(&b, "%s: %s\n", t.prompt, string(t.input))
+	} else if t.status != "" {
+		b.WriteString(t.status + "\n")
+	}
+	return b.String()
+}
+
+func cursor(selected bool) string {
+	if selected {
+		return ">"
+	}
+	return " "
+}
+
+// readKey reads a key pressed on a terminal in raw mode
+func readKey(r *bufio.Reader) (string, error) {
+	c, _, err := r.ReadRune()
+	if err != nil {
+		return "", err
+	}
+
+	switch c {
+	case 3:
+		return keyCtrlC, nil
+	case '\r', '\n':
+		return keyEnter, nil
+	case 127, '\b':
+		return keyBackspace, nil
+	case 27:
+		// a lone escape, or the start of the sequence of an arrow key
+		if r.Buffered() == 0 {
+			return keyEsc, nil
+		}
+		if next, _ := r.Peek(1); next[0] != '[' && next[0] != 'O' {
+			return keyEsc, nil
+		}
+		r.ReadByte()
+		code, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch code {
+		case 'A':
+			return keyUp, nil
+		case 'B':
+			return keyDown, nil
+		case 'C':
+			return keyRight, nil
+		case 'D':
+			return keyLeft, nil
+		}
+		return "", nil
+	}
+	return string(c), nil
+}
+
+// runTUI draws t on out and applies the keys read from in until t quits
+func runTUI(ctx context.Context, t *tui, in io.Reader, out io.Writer) error {
+	if err := t.refresh(ctx); err != nil {
+		return err
+	}
+
+	keys := bufio.NewReader(in)
+	for !t.quit {
+		// raw mode needs \r\n to start a line at the left
+		fmt.Fprint(out, "\x1b[H\x1b[2J"+strings.ReplaceAll(t.view(), "\n", "\r\n"))
+
+		key, err := readKey(keys)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read key > %w", err)
+		}
+		t.handle(ctx, key)
+	}
+	return nil
+}
+
+func clientTUI(cfg *config.Config, args []string) error {
+	fs := newFlags("client tui", "", "Browse and edit the lists of the session in the terminal.")
+	path := sessionFlag(fs)
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return fmt.Errorf("client tui needs a terminal, use the other client commands in scripts")
+	}
+
+	s, c, err := openSession(*path)
+	if err != nil {
+		return err
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("failed to set up the terminal > %w", err)
+	}
+	// the alternate screen keeps the shell history visible after quitting
+	fmt.Fprint(os.Stdout, "\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Fprint(os.Stdout, "\x1b[?25h\x1b[?1049l")
+		term.Restore(fd, state)
+	}()
+
+	return runTUI(context.Background(), newTUI(c, s.Email), os.Stdin, os.Stdout)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pzolo85/todo-app/back/pkg/client"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLists is a listAPI that keeps the lists in memory
+type fakeLists struct {
+	lists []client.List
+}
+
+func (f *fakeLists) get(id string) (*client.List, error) {
+	for i := range f.lists {
+		if f.lists[i].ID == id {
+			return &f.lists[i], nil
+		}
+	}
+	return nil, client.ErrListNotFound
+}
+
+func (f *fakeLists) Lists(ctx context.Context) ([]client.List, error) {
+	return append([]client.List(nil), f.lists...), nil
+}
+
+func (f *fakeLists) CreateList(ctx context.Context, name string) (*client.List, error) {
+	f.lists = append(f.lists, client.List{ID: fmt.Sprintf("list-%d", len(f.lists)+1), Name: name, Owner: "jon@test.com"})
+	l := f.lists[len(f.lists)-1]
+	return &l, nil
+}
+
+func (f *fakeLists) AddItem(ctx context.Context, id string, text string) (*client.List, error) {
+	l, err := f.get(id)
+	if err != nil {
+		return nil, err
+	}
+	l.Items = append(l.Items, client.Item{ID: fmt.Sprintf("item-%d", len(l.Items)+1), Text: text})
+	copied := *l
+	copied.Items = append([]client.Item(nil), l.Items...)
+	return &copied, nil
+}
+
+func (f *fakeLists) CheckItem(ctx context.Context, id string, item string, done bool) (*client.List, error) {
+	l, err := f.get(id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range l.Items {
+		if l.Items[i].ID == item {
+			l.Items[i].Done = done
+			copied := *l
+			copied.Items = append([]client.Item(nil), l.Items...)
+			return &copied, nil
+		}
+	}
+	return nil, client.ErrItemNotFound
+}
+
+func (f *fakeLists) ShareList(ctx context.Context, id string, email string) (*client.List, error) {
+	l, err := f.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if email == l.Owner {
+		return nil, client.ErrShareWithOwner
+	}
+	l.SharedWith = append(l.SharedWith, email)
+	copied := *l
+	return &copied, nil
+}
+
+func TestTUI(t *testing.T) {
+	ctx := context.Background()
+	api := &fakeLists{lists: []client.List{
+		{ID: "list-0", Name: "books", Owner: "mary@test.com", Items: []client.Item{{ID: "dune", Text: "dune", Done: true}}},
+	}}
+	ui := newTUI(api, "jon@test.com")
+	assert.Nil(t, ui.refresh(ctx))
+
+	typeText := func(text string) {
+		for _, r := range text {
+			ui.handle(ctx, string(r))
+		}
+		ui.handle(ctx, keyEnter)
+	}
+
+	t.Run("lists", func(t *testing.T) {
+		assert.Contains(t, ui.view(), "> books  1/1  from mary@test.com\n")
+	})
+
+	t.Run("create", func(t *testing.T) {
+		ui.handle(ctx, "n")
+		// keys go to the prompt, q does not quit
+		typeText("groqceries")
+		assert.False(t, ui.quit)
+		assert.Equal(t, "groqceries", api.lists[1].Name)
+		assert.Contains(t, ui.view(), "> groqceries  0/0\n")
+
+		ui.handle(ctx, "n")
+		ui.handle(ctx, "x")
+		ui.handle(ctx, keyBackspace)
+		ui.handle(ctx, keyEnter)
+		assert.Len(t, api.lists, 2)
+
+		ui.handle(ctx, "n")
+		ui.handle(ctx, "x")
+		ui.handle(ctx, keyEsc)
+		assert.Len(t, api.lists, 2)
+		assert.Empty(t, ui.prompt)
+	})
+
+	t.Run("items", func(t *testing.T) {
+		ui.handle(ctx, keyEnter)
+		assert.True(t, ui.open)
+		assert.Contains(t, ui.view(), "no items yet")
+
+		ui.handle(ctx, "a")
+		typeText("milk")
+		ui.handle(ctx, "a")
+		typeText("eggs")
+		assert.Equal(t, 1, ui.item)
+
+		ui.handle(ctx, keyUp)
+		ui.handle(ctx, " ")
+		assert.True(t, api.lists[1].Items[0].Done)
+		assert.Contains(t, ui.view(), "> [x] milk\n  [ ] eggs\n")
+
+		ui.handle(ctx, "x")
+		assert.False(t, api.lists[1].Items[0].Done)
+	})
+
+	t.Run("share", func(t *testing.T) {
+		ui.handle(ctx, "s")
+		typeText("jon@test.com")
+		assert.Equal(t, client.ErrShareWithOwner.Error(), ui.status)
+		assert.Contains(t, ui.view(), ui.status)
+
+		ui.handle(ctx, "s")
+		typeText("mary@test.com")
+		assert.Equal(t, "shared with mary@test.com", ui.status)
+		assert.Contains(t, ui.view(), "owner jon@test.com, shared with mary@test.com\n")
+	})
+
+	t.Run("refresh keeps the selection", func(t *testing.T) {
+		api.lists = api.lists[1:]
+		ui.handle(ctx, "r")
+		assert.True(t, ui.open)
+		assert.Equal(t, 0, ui.list)
+		assert.Contains(t, ui.view(), "groqceries")
+
+		api.lists = nil
+		ui.handle(ctx, "r")
+		assert.False(t, ui.open)
+		assert.Contains(t, ui.view(), "no lists yet")
+	})
+
+	t.Run("quit", func(t *testing.T) {
+		ui.handle(ctx, "q")
+		assert.True(t, ui.quit)
+	})
+}
+
+func TestReadKey(t *testing.T) {
+	keys := bufio.NewReader(strings.NewReader("a\r\x7f\x03é\x1b[A\x1b[B\x1b[C\x1bOD\x1bx\x1b"))
+	var got []string
+	for {
+		key, err := readKey(keys)
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		got = append(got, key)
+	}
+	assert.Equal(t, []string{"a", keyEnter, keyBackspace, keyCtrlC, "é", keyUp, keyDown, keyRight, keyLeft, keyEsc, "x", keyEsc}, got)
+}
+
+func TestRunTUI(t *testing.T) {
+	api := &fakeLists{}
+	var out bytes.Buffer
+	assert.Nil(t, runTUI(context.Background(), newTUI(api, "jon@test.com"), strings.NewReader("nbooks\rq"), &out))
+	assert.Len(t, api.lists, 1)
+	assert.Contains(t, out.String(), "\x1b[H\x1b[2J")
+	assert.Contains(t, out.String(), "> books  0/0\r\n")
+	assert.NotContains(t, strings.ReplaceAll(out.String(), "\r\n", ""), "\n")
+
+	// the end of the input quits
+	assert.Nil(t, runTUI(context.Background(), newTUI(api, "jon@test.com"), strings.NewReader("j"), &out))
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/config"
+	"github.com/pzolo85/todo-app/back/internal/log"
+	"github.com/pzolo85/todo-app/back/internal/migrate"
+	"github.com/pzolo85/todo-app/back/internal/storage"
+	"github.com/pzolo85/todo-app/back/internal/user"
+	"github.com/pzolo85/todo-app/back/pkg/client"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// users is where the user commands apply, the admin API of the running server or the db
+type users interface {
+	create(req user.AdminCreateUserRequest) (user.Summary, error)
+	list() ([]user.Summary, error)
+	// modify runs one of the admin actions that take a user.ModifyUserRequest
+	modify(action string, email string) error
+	setPassword(req user.SetPasswordRequest) error
+	revokeSessions(email string) (int, error)
+	close()
+}
+
+// user actions, named after their admin API path
+const (
+	actionDisable      = "disable"
+	actionMakeAdmin    = "make-admin"
+	actionDisableAdmin = "disable-admin"
+	actionSuspend      = "suspend"
+	actionResume       = "resume"
+)
+
+type apiUsers struct {
+	srv *client.Client
+}
+
+func (a apiUsers) create(req user.AdminCreateUserRequest) (user.Summary, error) {
+	s, err := a.srv.AdminCreateUser(context.Background(), client.AdminCreateUserRequest(req))
+	if err != nil {
+		return user.Summary{}, err
+	}
+	return user.Summary(*s), nil
+}
+
+func (a apiUsers) list() ([]user.Summary, error) {
+	list, err := a.srv.ListUsers(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]user.Summary, 0, len(list))
+	for _, s := range list {
+		summaries = append(summaries, user.Summary(s))
+	}
+	return summaries, nil
+}
+
+func (a apiUsers) modify(action string, email string) error {
+	actions := map[string]func(ctx context.Context, email string) error{
+		actionDisable:      a.srv.DisableUser,
+		actionMakeAdmin:    a.srv.MakeAdmin,
+		actionDisableAdmin: a.srv.DisableAdmin,
+		actionSuspend:      a.srv.SuspendUser,
+		actionResume:       a.srv.ResumeUser,
+	}
+	return actions[action](context.Background(), email)
+}
+
+func (a apiUsers) setPassword(req user.SetPasswordRequest) error {
+	return a.srv.SetPassword(context.Background(), req.Email, req.Salt, req.HashedPass)
+}
+
+func (a apiUsers) revokeSessions(email string) (int, error) {
+	return a.srv.RevokeSessions(context.Background(), email)
+}
+
+func (a apiUsers) close() {}
+
+type dbUsers struct {
+	repo  *user.DefaultRepo
+	store storage.Store
+	cfg   *config.Config
+}
+
+func (d dbUsers) create(req user.AdminCreateUserRequest) (user.Summary, error) {
+	role := d.cfg.UserRole
+	if req.Admin {
+		role = d.cfg.AdminRole
+	}
+
+	u := &user.User{
+		Email:        req.Email,
+		PassHash:     req.HashedPass,
+		Salt:         req.Salt,
+		Role:         role,
+		CreatedAt:    time.Now(),
+		ValidEmail:   req.Verified,
+		ActiveJWT:    []string{},
+		Notes:        []string{},
+		SharedWithMe: []string{},
+	}
+	if err := d.repo.SaveUser(context.Background(), u, false); err != nil {
+		return user.Summary{}, err
+	}
+	return u.Summary(), nil
+}
+
+func (d dbUsers) list() ([]user.Summary, error) {
+	all, err := d.repo.ListUsers(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]user.Summary, 0, len(all))
+	for _, u := range all {
+		summaries = append(summaries, u.Summary())
+	}
+	return summaries, nil
+}
+
+func (d dbUsers) modify(action string, email string) error {
+	actions := map[string]func(ctx context.Context, email string) error{
+		actionDisable:      d.repo.DisableUser,
+		actionMakeAdmin:    d.repo.MakeAdmin,
+		actionDisableAdmin: d.repo.DisableAdmin,
+		actionSuspend:      d.repo.SuspendUser,
+		actionResume:       d.repo.ResumeUser,
+	}
+	return actions[action](context.Background(), email)
+}
+
+func (d dbUsers) setPassword(req user.SetPasswordRequest) error {
+	return d.repo.SetPassword(context.Background(), req.Email, req.Salt, req.HashedPass)
+}
+
+func (d dbUsers) revokeSessions(email string) (int, error) {
+	return d.repo.RevokeSessions(context.Background(), email)
+}
+
+func (d dbUsers) close() {
+	d.store.Close()
+}
+
+// openUsers returns the admin API of the running server, or the db when the
+// server is stopped. readOnly opens the db read-only.
+func openUsers(cfg *config.Config, readOnly bool) (users, error) {
+	if err := validConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	srv, err := dialServer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if srv != nil {
+		return apiUsers{srv: srv}, nil
+	}
+
+	store, err := openStore(cfg, readOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator := migrate.NewDefaultService(store, log.NewDefaultService(cfg.Level, "cli", "localhost"), migrate.Migrations)
+	version, err := migrator.Version()
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	// users are stored in the format of the latest schema
+	if version != migrator.Latest() {
+		store.Close()
+		return nil, fmt.Errorf("db schema is at version %d, expected %d, run todo-app db migrate up", version, migrator.Latest())
+	}
+	if err := migrator.CheckEmailRules(cfg.Emails()); err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	userCache := cache.New(time.Hour, time.Minute*20)
+	if readOnly {
+		return dbUsers{repo: user.NewReadOnlyRepo(store, userCache, cfg.AdminRole, cfg.UserRole), store: store, cfg: cfg}, nil
+	}
+
+	repo, err := user.NewDefaultRepo(store, userCache, cfg.AdminRole, cfg.UserRole)
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to create userRepo > %w", err)
+	}
+	return dbUsers{repo: repo, store: store, cfg: cfg}, nil
+}
+
+// userResult is the output of the commands that change a user
+type userResult struct {
+	Email  string `json:"email"`
+	Result string `json:"result"`
+	// Password is set when the command generated one, it is not shown again.
+	// Clients log in with user.HashPassword of Salt and Password.
+	Password string `json:"password,omitempty"`
+	Salt     string `json:"salt,omitempty"`
+	Revoked  *int   `json:"revoked,omitempty"`
+	// User is set by add
+	User *user.Summary `json:"user,omitempty"`
+}
+
+func outputFlag(fs *flag.FlagSet) *string {
+	return fs.String("o", "table", "output format: table or json")
+}
+
+func checkFormat(format string) error {
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unknown output format %q, expected table or json", format)
+	}
+	return nil
+}
+
+// printResult writes r in the output format
+func printResult(format string, r userResult) error {
+	if format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(r)
+	}
+
+	fmt.Fprintf(os.Stdout, "%s: %s\n", r.Result, r.Email)
+	if r.Password != "" {
+		fmt.Fprintf(os.Stdout, "password: %s\nsalt: %s\n", r.Password, r.Salt)
+	}
+	if r.Revoked != nil {
+		fmt.Fprintf(os.Stdout, "revoked sessions: %d\n", *r.Revoked)
+	}
+	return nil
+}
+
+func printUsers(format string, list []user.Summary) error {
+	if format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(user.ListUsersResponse{Users: list})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "EMAIL\tROLE\tVERIFIED\tSUSPENDED\tSESSIONS\tCREATED\n")
+	for _, u := range list {
+		fmt.Fprintf(w, "%s\t%s\t%t\t%t\t%d\t%s\n", u.Email, u.Role, u.ValidEmail, u.Suspended, u.Sessions, u.CreatedAt.Format(time.DateTime))
+	}
+	return w.Flush()
+}
+
+// parseUserArgs parses the flags of a command that takes an email, and normalizes it
+func parseUserArgs(cfg *config.Config, fs *flag.FlagSet, args []string, format *string) (string, error) {
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return "", err
+	}
+	if err := checkFormat(*format); err != nil {
+		return "", err
+	}
+	return cfg.Emails().Normalize(args[0])
+}
+
+// newCredentials generates a password and the salt and hash a client would send for it
+func newCredentials() (password string, salt string, hash string, err error) {
+	password, salt, err = user.NewPassword()
+	if err != nil {
+		return "", "", "", err
+	}
+	return password, salt, user.HashPassword(salt, password), nil
+}
+
+func userAdd(cfg *config.Config, args []string) error {
+	fs := newFlags("user add", "<email>", "Create a user with a generated password, it is printed once.\n"+
+		"Clients log in with the hex SHA-256 of the salt followed by the password.")
+	admin := fs.Bool("admin", false, "give the user the admin role")
+	verified := fs.Bool("verified", false, "mark the email address as verified")
+	format := outputFlag(fs)
+	email, err := parseUserArgs(cfg, fs, args, format)
+	if err != nil {
+		return err
+	}
+
+	password, salt, hash, err := newCredentials()
+	if err != nil {
+		return err
+	}
+
+	target, err := openUsers(cfg, false)
+	if err != nil {
+		return err
+	}
+	defer target.close()
+
+	created, err := target.create(user.AdminCreateUserRequest{
+		Email:      email,
+		Salt:       salt,
+		HashedPass: hash,
+		Admin:      *admin,
+		Verified:   *verified,
+	})
+	if err != nil {
+		return err
+	}
+
+	return printResult(*format, userResult{Email: email, Result: "user created", Password: password, Salt: salt, User: &created})
+}
+
+func userList(cfg *config.Config, args []string) error {
+	fs := newFlags("user list", "", "List the users. With the server stopped the db is opened read-only.")
+	format := outputFlag(fs)
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+
+	target, err := openUsers(cfg, true)
+	if err != nil {
+		return err
+	}
+	defer target.close()
+
+	list, err := target.list()
+	if err != nil {
+		return err
+	}
+	return printUsers(*format, list)
+}
+
+func userDisable(cfg *config.Config, args []string) error {
+	return modifyUser(cfg, args, "disable", actionDisable, "Mark the email address of a user as not verified.", "user disabled")
+}
+
+func userMakeAdmin(cfg *config.Config, args []string) error {
+	return modifyUser(cfg, args, "make-admin", actionMakeAdmin, "Give a user the admin role.", "user is admin")
+}
+
+func userDemote(cfg *config.Config, args []string) error {
+	return modifyUser(cfg, args, "demote", actionDisableAdmin, "Give an admin the user role.", "user demoted")
+}
+
+func userSuspend(cfg *config.Config, args []string) error {
+	return modifyUser(cfg, args, "suspend", actionSuspend, "Block the login of a user and revoke its sessions.", "user suspended")
+}
+
+func userResume(cfg *config.Config, args []string) error {
+	return modifyUser(cfg, args, "resume", actionResume, "Lift the suspension of a user.", "user resumed")
+}
+
+// modifyUser runs one of the actions without arguments other than the email
+func modifyUser(cfg *config.Config, args []string, name string, action string, summary string, done string) error {
+	fs := newFlags("user "+name, "<email>", summary)
+	format := outputFlag(fs)
+	email, err := parseUserArgs(cfg, fs, args, format)
+	if err != nil {
+		return err
+	}
+
+	target, err := openUsers(cfg, false)
+	if err != nil {
+		return err
+	}
+	defer target.close()
+
+	if err := target.modify(action, email); err != nil {
+		return err
+	}
+	return printResult(*format, userResult{Email: email, Result: done})
+}
+
+func userResetPassword(cfg *config.Config, args []string) error {
+	fs := newFlags("user reset-password", "<email>", "Replace the password of a user with a generated one, it is printed once.\n"+
+		"The sessions of the user are revoked.")
+	format := outputFlag(fs)
+	email, err := parseUserArgs(cfg, fs, args, format)
+	if err != nil {
+		return err
+	}
+
+	password, salt, hash, err := newCredentials()
+	if err != nil {
+		return err
+	}
+
+	target, err := openUsers(cfg, false)
+	if err != nil {
+		return err
+	}
+	defer target.close()
+
+	if err := target.setPassword(user.SetPasswordRequest{Email: email, Salt: salt, HashedPass: hash}); err != nil {
+		return err
+	}
+	return printResult(*format, userResult{Email: email, Result: "password reset", Password: password, Salt: salt})
+}
+
+func userRevokeSessions(cfg *config.Config, args []string) error {
+	fs := newFlags("user revoke-sessions", "<email>", "Revoke every session of a user, the user must log in again.")
+	format := outputFlag(fs)
+	email, err := parseUserArgs(cfg, fs, args, format)
+	if err != nil {
+		return err
+	}
+
+	target, err := openUsers(cfg, false)
+	if err != nil {
+		return err
+	}
+	defer target.close()
+
+	revoked, err := target.revokeSessions(email)
+	if err != nil {
+		return err
+	}
+	return printResult(*format, userResult{Email: email, Result: "sessions revoked", Revoked: &revoked})
+}
@@ -0,0 +1,243 @@
+// Package app wires the services, handlers and background jobs of the server
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/auth"
+	"github.com/pzolo85/todo-app/back/internal/backup"
+	"github.com/pzolo85/todo-app/back/internal/certs"
+	"github.com/pzolo85/todo-app/back/internal/config"
+	"github.com/pzolo85/todo-app/back/internal/health"
+	"github.com/pzolo85/todo-app/back/internal/http"
+	"github.com/pzolo85/todo-app/back/internal/log"
+	"github.com/pzolo85/todo-app/back/internal/mail"
+	"github.com/pzolo85/todo-app/back/internal/metrics"
+	"github.com/pzolo85/todo-app/back/internal/migrate"
+	"github.com/pzolo85/todo-app/back/internal/storage"
+	"github.com/pzolo85/todo-app/back/internal/tracing"
+	"github.com/pzolo85/todo-app/back/internal/user"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/patrickmn/go-cache"
+)
+
+// Services is a group of services and handlers.
+type Services struct {
+	Logger   *slog.Logger
+	Store    storage.Store
+	AuthSvc  *auth.DefaultService
+	AuthHdl  *auth.Handler
+	Server   *http.DefaultServer
+	PurgeJob *user.PurgeJob
+	// Exporter builds the large exports, it is drained on shutdown
+	Exporter *user.Exporter
+	// BackupJob is nil unless BackupDir is set
+	BackupJob *backup.Job
+	// CertReloader is nil unless TLS is enabled
+	CertReloader *certs.Reloader
+	// ConfigWatcher reloads the runtime config on SIGHUP
+	ConfigWatcher *config.Watcher
+	Workers       *health.Workers
+	// ShutdownTracer flushes the pending spans
+	ShutdownTracer func(context.Context) error
+}
+
+// Options replace the parts of the app that talk to the outside world
+type Options struct {
+	// MailTransport delivers the mails, they are logged when nil
+	MailTransport mail.Transport
+}
+
+// Load opens the db and builds every service from cfg, the config must be valid.
+// The db is closed when it fails.
+func Load(cfg *config.Config, opts Options) (_ *Services, err error) {
+	// logger
+	appID := uuid.NewString()
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract hostname > %w", err)
+	}
+
+	logger := log.NewDefaultService(cfg.Level, appID, hostname)
+
+	// tracing
+	shutdownTracer, err := tracing.Setup(context.Background(), cfg.TraceExporter, cfg.TraceEndpoint, cfg.TraceSampleRatio, health.ReadVersion().Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup tracing > %w", err)
+	}
+
+	store, err := storage.Open(cfg.DBBackend, cfg.DBPath, storage.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open db > %w", err)
+	}
+	defer func() {
+		if err != nil {
+			store.Close()
+		}
+	}()
+	if cfg.MetricsEnabled {
+		store = metrics.InstrumentStore(store)
+	}
+
+	// schema
+	migrator := migrate.NewDefaultService(store, logger, migrate.Migrations)
+	if cfg.AutoMigrate {
+		if _, err := migrator.Up(false); err != nil {
+			return nil, fmt.Errorf("failed to migrate db > %w", err)
+		}
+		if _, err := migrator.CanonicalizeEmails(cfg.Emails()); err != nil {
+			return nil, err
+		}
+	} else if err := migrator.Check(); err != nil {
+		return nil, err
+	} else if err := migrator.CheckEmailRules(cfg.Emails()); err != nil {
+		return nil, err
+	}
+
+	// mail
+	mailCache := cache.New(time.Hour*24, time.Hour)
+	mailTransport := opts.MailTransport
+	if mailTransport == nil {
+		mailTransport = mail.NewLogTransport(logger)
+	}
+	mailSvc := mail.NewDefaultService(logger, mailCache, cfg, mailTransport)
+	mailHandler := mail.NewDefaultHandler(mailSvc, cfg, logger)
+
+	// user
+	userCache := cache.New(time.Hour, time.Minute*20)
+	userRepo, err := user.NewDefaultRepo(store, userCache, cfg.AdminRole, cfg.UserRole)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create userRepo > %w", err)
+	}
+	exporter := user.NewExporter(cache.New(time.Hour*24, time.Hour), mailSvc)
+	userHandler := user.NewDefaultHandler(userRepo, logger, mailSvc, cfg.AdminRole, cfg.UserRole, exporter, cfg.ExportAsyncThreshold, cfg.DeletionGracePeriod, cfg.Emails())
+	duplicates, err := userRepo.ListDuplicates(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if len(duplicates) > 0 {
+		logger.Warn("accounts sharing an email address must be merged, see GET /api/v1/admin/user/duplicates", "count", len(duplicates))
+	}
+	purgeJob := user.NewPurgeJob(userRepo, mailSvc, exporter, logger, cfg.PurgeInterval)
+
+	// auth
+	authSvc := auth.NewDefaultService(cfg.Key, jwt.SigningMethodHS256, cfg.TokenValidation(), logger)
+	if v := cfg.TokenValidation(); v.LegacyAccepted(time.Now()) {
+		logger.Warn("tokens signed before the registered claims are accepted, turn off jwt_accept_legacy once they are revoked", "until", v.LegacyUntil)
+	}
+	authHandler := auth.NewDefaultHandler(authSvc, logger, userRepo, cfg.Emails())
+
+	// backup
+	backupSvc := backup.NewDefaultService(store)
+	backupHandler := backup.NewDefaultHandler(backupSvc, logger)
+	var backupJob *backup.Job
+	if cfg.BackupDir != "" {
+		backupJob = backup.NewJob(backupSvc, logger, cfg.BackupDir, cfg.BackupInterval, cfg.BackupRetention)
+	}
+
+	// health
+	workers := health.NewWorkers()
+	healthHandler := health.NewDefaultHandler(logger,
+		health.NamedCheck{Name: "db", Check: health.StoreCheck(store)},
+		health.NamedCheck{Name: "mail", Check: mailSvc.Ping},
+		health.NamedCheck{Name: "workers", Check: workers.Check},
+	)
+
+	// server
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	srv := http.GetDefaultServer(e, logger, cfg.AdminRole, cfg.Emails())
+
+	var certReloader *certs.Reloader
+	if cfg.TLSEnabled() {
+		certReloader, err = certs.NewReloader(cfg.TLSCert, cfg.TLSKey, cfg.TLSReloadInterval, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig, err := certs.NewTLSConfig(certReloader, cfg.TLSMinVersion, cfg.TLSCipherPolicy, cfg.TLSClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tls config > %w", err)
+		}
+		srv.EnableTLS(tlsConfig, cfg.TLSRedirectPort)
+	}
+
+	if cfg.MetricsEnabled {
+		registerMetrics(cfg, userRepo, mailSvc)
+		srv.EnableMetrics(cfg.MetricsToken, cfg.MetricsPublic)
+	}
+
+	// runtime config
+	watcher := config.NewWatcher(cfg, config.Reload, logger)
+	watcher.Subscribe(func(rt config.Runtime) {
+		log.SetLevel(rt.Level)
+		userHandler.SetLimits(rt.ExportAsyncThreshold, rt.DeletionGracePeriod)
+		srv.SetMetricsToken(rt.MetricsToken)
+	})
+	configHandler := config.NewDefaultHandler(watcher, logger)
+
+	err = srv.LoadRoutes(authHandler, mailHandler, userHandler, backupHandler, healthHandler, configHandler)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Services{
+		Logger:         logger,
+		Store:          store,
+		AuthSvc:        authSvc,
+		AuthHdl:        authHandler,
+		Server:         srv,
+		PurgeJob:       purgeJob,
+		Exporter:       exporter,
+		BackupJob:      backupJob,
+		CertReloader:   certReloader,
+		ConfigWatcher:  watcher,
+		Workers:        workers,
+		ShutdownTracer: shutdownTracer,
+	}, nil
+}
+
+// sessionsTTL is how long the active_sessions gauge is cached
+const sessionsTTL = time.Minute
+
+// registerMetrics adds the metrics read from the services on every scrape
+func registerMetrics(cfg *config.Config, userRepo *user.DefaultRepo, mailSvc *mail.DefaultService) {
+	metrics.RegisterCache("user", func() (uint64, uint64) {
+		stats := userRepo.CacheStats()
+		return stats.Hits, stats.Misses
+	})
+	metrics.RegisterCache("mail", mailSvc.CacheStats)
+
+	// counting the sessions reads every user
+	metrics.RegisterGauge("active_sessions", "User tokens that were not revoked.", metrics.Cached(sessionsTTL, func() (float64, error) {
+		users, err := userRepo.ListUsers(context.Background())
+		if err != nil {
+			return 0, err
+		}
+
+		sessions := 0
+		for _, u := range users {
+			sessions += len(u.ActiveJWT)
+		}
+		return float64(sessions), nil
+	}))
+
+	metrics.RegisterGauge("db_size_bytes", "Size of the db files.", func() float64 {
+		var size int64
+		// sqlite keeps recent writes in the wal file
+		for _, path := range []string{cfg.DBPath, cfg.DBPath + "-wal"} {
+			if info, err := os.Stat(path); err == nil {
+				size += info.Size()
+			}
+		}
+		return float64(size)
+	})
+}
@@ -0,0 +1,29 @@
+package app
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/config"
+	"github.com/pzolo85/todo-app/back/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad_ClosesTheDBOnError(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.DBPath = filepath.Join(t.TempDir(), "test.bolt")
+	// the certificate is loaded after the db is opened
+	cfg.TLSCert = filepath.Join(t.TempDir(), "missing.pem")
+	cfg.TLSKey = cfg.TLSCert
+
+	_, err := Load(cfg, Options{})
+	assert.NotNil(t, err)
+
+	// bolt locks the file until the db is closed
+	store, err := storage.Open(storage.BackendBolt, cfg.DBPath, storage.Options{Timeout: 100 * time.Millisecond})
+	if assert.Nil(t, err) {
+		store.Close()
+	}
+}
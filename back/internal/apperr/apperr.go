@@ -0,0 +1,127 @@
+// Package apperr defines the typed errors handlers return to clients
+//
+// An Error carries a kind, which maps to an HTTP status, a stable code that
+// clients can match on, and a message that is safe to show. The cause is only
+// logged. The http package renders them as RFC 7807 problem+json.
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindBadRequest
+	KindValidation
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindConflict
+)
+
+var kindStatus = map[Kind]int{
+	KindInternal:     http.StatusInternalServerError,
+	KindBadRequest:   http.StatusBadRequest,
+	KindValidation:   http.StatusUnprocessableEntity,
+	KindUnauthorized: http.StatusUnauthorized,
+	KindForbidden:    http.StatusForbidden,
+	KindNotFound:     http.StatusNotFound,
+	KindConflict:     http.StatusConflict,
+}
+
+// FieldError describes why a request field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Fields  []FieldError
+	// Err is the cause, it is logged but never sent to clients
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s > %s", e.Code, e.Message, e.Err.Error())
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches errors of the same kind and code, so sentinel errors still
+// match after Wrap
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind && t.Code == e.Code
+}
+
+func (e *Error) Status() int {
+	return kindStatus[e.Kind]
+}
+
+// Wrap returns a copy of e with err as its cause
+func (e *Error) Wrap(err error) *Error {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+func New(kind Kind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func BadRequest(code string, message string) *Error {
+	return New(KindBadRequest, code, message)
+}
+
+func Unauthorized(code string, message string) *Error {
+	return New(KindUnauthorized, code, message)
+}
+
+func Forbidden(code string, message string) *Error {
+	return New(KindForbidden, code, message)
+}
+
+func NotFound(code string, message string) *Error {
+	return New(KindNotFound, code, message)
+}
+
+func Conflict(code string, message string) *Error {
+	return New(KindConflict, code, message)
+}
+
+// Internal hides err from the client behind a generic message
+func Internal(err error) *Error {
+	return &Error{Kind: KindInternal, Code: "internal_error", Message: "internal error", Err: err}
+}
+
+// Validation reports the invalid fields of a request
+func Validation(fields ...FieldError) *Error {
+	return &Error{Kind: KindValidation, Code: "validation_failed", Message: "request validation failed", Fields: fields}
+}
+
+// As returns the Error in the chain of err, if any
+func As(err error) (*Error, bool) {
+	var e *Error
+	ok := errors.As(err, &e)
+	return e, ok
+}
+
+// common errors
+var (
+	ErrInvalidBody = BadRequest("invalid_body", "request body could not be decoded")
+	ErrMissingAuth = Unauthorized("missing_token", "x-auth-token header is missing")
+	ErrBadToken    = Unauthorized("invalid_token", "token is invalid, expired or revoked")
+)
@@ -0,0 +1,34 @@
+package apperr
+
+// ContentType of Problem responses
+const ContentType = "application/problem+json"
+
+// Problem is the RFC 7807 body of every error response
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// TypeURI identifies the problem type of code
+func TypeURI(code string) string {
+	return "urn:todo-app:problem:" + code
+}
+
+// FromProblem rebuilds the Error a server rendered as p, so clients can match
+// it with errors.Is. Statuses without a kind are reported as internal.
+func FromProblem(p *Problem) *Error {
+	kind := KindInternal
+	for k, status := range kindStatus {
+		if status == p.Status {
+			kind = k
+			break
+		}
+	}
+	return &Error{Kind: kind, Code: p.Code, Message: p.Detail, Fields: p.Errors}
+}
@@ -1,13 +1,18 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"slices"
 	"time"
 
+	"github.com/pzolo85/todo-app/back/internal/apperr"
 	"github.com/pzolo85/todo-app/back/internal/claim"
+	"github.com/pzolo85/todo-app/back/internal/emailaddr"
+	"github.com/pzolo85/todo-app/back/internal/log"
+	"github.com/pzolo85/todo-app/back/internal/metrics"
 	"github.com/pzolo85/todo-app/back/internal/user"
 
 	"github.com/google/uuid"
@@ -15,29 +20,45 @@ import (
 )
 
 type Handler struct {
-	svc  Service
-	repo user.Repo
-	log  *slog.Logger
+	svc    Service
+	repo   user.Repo
+	log    *slog.Logger
+	emails emailaddr.Normalizer
 }
 
 type LoginRequest struct {
-	Email string `json:"email"`
-	Hash  string `json:"hash"`
+	Email string `json:"email" validate:"required,email,max=254" normalize:"email"`
+	Hash  string `json:"hash" validate:"required,max=512"`
 }
+
 type LoginResponse struct {
 	Token string `json:"token"`
 }
 
 const AuthHeader = "x-auth-token"
 
-func NewDefaultHandler(svc Service, log *slog.Logger, repo user.Repo) *Handler {
+var (
+	ErrInvalidCredentials  = apperr.Unauthorized("invalid_credentials", "email or password is invalid")
+	ErrRoleNotAllowed      = apperr.Forbidden("role_not_allowed", "your role cannot access this resource")
+	ErrAccountNotValidated = apperr.Forbidden("account_not_validated", "please validate your account")
+
+	errMissingClaim = apperr.Internal(fmt.Errorf("user claim missing from context"))
+)
+
+func NewDefaultHandler(svc Service, log *slog.Logger, repo user.Repo, emails emailaddr.Normalizer) *Handler {
 	return &Handler{
-		svc:  svc,
-		log:  log.WithGroup("auth_handler"),
-		repo: repo,
+		svc:    svc,
+		log:    log.WithGroup("auth_handler"),
+		repo:   repo,
+		emails: emails,
 	}
 }
 
+// requestLogger returns the request logger, see log.Middleware
+func (h *Handler) requestLogger(c echo.Context) *slog.Logger {
+	return log.FromContext(c, h.log, "auth_handler")
+}
+
 func (h *Handler) AddHandler(g *echo.Group) {
 	g.POST("/login", h.LoginHandler)
 }
@@ -46,35 +67,58 @@ func (h *Handler) LoginHandler(c echo.Context) error {
 	var req LoginRequest
 	err := c.Bind(&req)
 	if err != nil {
-		h.log.Error("failed to bind login request", slog.String("error", err.Error()))
-		return echo.NewHTTPError(http.StatusBadRequest, err)
+		h.requestLogger(c).Warn("failed to bind login request", slog.String("error", err.Error()))
+		return err
 	}
 
-	user, err := h.repo.GetUser(req.Email)
+	usr, err := h.repo.GetUser(c.Request().Context(), req.Email)
 	if err != nil {
-		h.log.Warn("invalid user login attempt", "email", req.Email)
-		return echo.NewHTTPError(http.StatusBadRequest, err)
+		h.requestLogger(c).Warn("invalid user login attempt", "email", req.Email)
+		metrics.Logins.WithLabelValues("failure").Inc()
+		return ErrInvalidCredentials.Wrap(err)
+	}
+
+	if usr.PassHash != req.Hash {
+		h.requestLogger(c).Warn("invalid password login attempt", "email", req.Email)
+		metrics.Logins.WithLabelValues("failure").Inc()
+		return ErrInvalidCredentials
 	}
 
-	if user.PassHash != req.Hash {
-		h.log.Warn("invalid password login attempt", "email", req.Email)
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("unknown user: %s", req.Email))
+	if usr.Suspended {
+		h.requestLogger(c).Warn("login attempt of suspended user", "email", req.Email)
+		metrics.Logins.WithLabelValues("failure").Inc()
+		return user.ErrSuspended
 	}
 
-	token, err := h.svc.GetJWT(&claim.UserClaim{
+	token, err := h.svc.GetJWT(c.Request().Context(), &claim.UserClaim{
 		Email:     req.Email,
 		CreatedAt: time.Now(),
 		SourceIP:  c.RealIP(),
 		UserAgent: c.Request().UserAgent(),
 		ClaimID:   uuid.NewString(),
 	})
+	if err != nil {
+		h.requestLogger(c).Error("failed to sign token", "err", err.Error())
+		return apperr.Internal(err)
+	}
 
-	user.ActiveJWT = append(user.ActiveJWT, token)
-	err = h.repo.SaveUser(user, true)
+	if usr.DeleteAt != nil {
+		if err := h.repo.CancelDeletion(c.Request().Context(), req.Email); err != nil {
+			h.requestLogger(c).Error("failed to cancel account deletion", "err", err.Error())
+			return err
+		}
+		h.requestLogger(c).Info("login cancelled pending account deletion", "email", req.Email)
+	}
+
+	_, err = h.repo.UpdateUser(c.Request().Context(), req.Email, func(u *user.User) error {
+		u.ActiveJWT = append(u.ActiveJWT, token)
+		return nil
+	})
 	if err != nil {
-		h.log.Error("failed to store user changes to db", "err", err.Error())
+		h.requestLogger(c).Error("failed to store user changes to db", "err", err.Error())
 	}
 
+	metrics.Logins.WithLabelValues("success").Inc()
 	return c.JSON(http.StatusOK, LoginResponse{
 		Token: token,
 	})
@@ -86,26 +130,26 @@ func (h *Handler) VerifyRole(validRoles []string) echo.MiddlewareFunc {
 		return func(c echo.Context) error {
 			userClaim, ok := c.Get(claim.UserClaimContextKey).(*claim.UserClaim)
 			if !ok {
-				h.log.Warn("failed to extract claims from context")
-				return echo.NewHTTPError(http.StatusInternalServerError, "failed to extract claims")
+				h.requestLogger(c).Warn("failed to extract claims from context")
+				return errMissingClaim
 			}
 
 			if userClaim.IsAdmin {
 				return next(c)
 			}
 
-			user, err := h.repo.GetUser(userClaim.Email)
+			user, err := h.repo.GetUser(c.Request().Context(), userClaim.Email)
 			if err != nil {
-				h.log.Error("failed to get user from db", "err", err.Error())
-				return echo.NewHTTPError(http.StatusInternalServerError, err)
+				h.requestLogger(c).Error("failed to get user from db", "err", err.Error())
+				return err
 			}
 
 			if !slices.Contains(validRoles, user.Role) {
-				h.log.Warn("unauthorized access to protected resource",
+				h.requestLogger(c).Warn("unauthorized access to protected resource",
 					slog.String("path", c.Request().RequestURI),
 					slog.String("real_ip", c.RealIP()),
 				)
-				return echo.NewHTTPError(http.StatusUnauthorized)
+				return ErrRoleNotAllowed
 			}
 
 			return next(c)
@@ -118,26 +162,26 @@ func (h *Handler) VerifyValidAccount() echo.MiddlewareFunc {
 		return func(c echo.Context) error {
 			userClaim, ok := c.Get(claim.UserClaimContextKey).(*claim.UserClaim)
 			if !ok {
-				h.log.Warn("failed to extract claims from context")
-				return echo.NewHTTPError(http.StatusInternalServerError, "failed to extract claims")
+				h.requestLogger(c).Warn("failed to extract claims from context")
+				return errMissingClaim
 			}
 
 			if userClaim.IsAdmin {
 				return next(c)
 			}
 
-			user, err := h.repo.GetUser(userClaim.Email)
+			user, err := h.repo.GetUser(c.Request().Context(), userClaim.Email)
 			if err != nil {
-				h.log.Error("failed to get user from db", "err", err.Error())
-				return echo.NewHTTPError(http.StatusInternalServerError, err)
+				h.requestLogger(c).Error("failed to get user from db", "err", err.Error())
+				return err
 			}
 
 			if !user.ValidEmail {
-				h.log.Warn("unvalidated user trying to access are for validated",
+				h.requestLogger(c).Warn("unvalidated user trying to access are for validated",
 					slog.String("user", user.Email),
 					slog.String("path", c.QueryString()),
 				)
-				return echo.NewHTTPError(http.StatusUnauthorized, "please validate your account")
+				return ErrAccountNotValidated
 			}
 
 			return next(c)
@@ -150,23 +194,29 @@ func (h *Handler) AddUserClaim() echo.MiddlewareFunc {
 		return func(c echo.Context) error {
 			token := c.Request().Header.Get(AuthHeader)
 			if token == "" {
-				h.log.Warn("x-auth-token header missing",
+				h.requestLogger(c).Warn("x-auth-token header missing",
 					"request_ip", c.RealIP(),
 					slog.String("request_url", c.Path()),
 				)
-				return echo.NewHTTPError(http.StatusUnauthorized)
+				return apperr.ErrMissingAuth
 			}
 
-			t, err := h.svc.DecodeToken(token)
+			t, err := h.svc.DecodeToken(c.Request().Context(), token)
 			if err != nil {
-				h.log.Warn("error attempting to decode", "err", err.Error())
-				return echo.NewHTTPError(http.StatusUnauthorized, err)
+				h.requestLogger(c).Warn("error attempting to decode", "err", err.Error())
+				return apperr.ErrBadToken.Wrap(err)
 			}
 
-			h.log.Debug("user claim decoded from request", "claim", t)
+			// tokens signed before emails were normalized carry the address as typed
+			if email, err := h.emails.Normalize(t.Email); err == nil {
+				t.Email = email
+			}
+
+			log.AddAttrs(c, "email", t.Email, "claim_id", t.ClaimID)
+			h.requestLogger(c).Debug("user claim decoded from request", "claim", t)
 			if t.IsAdmin && t.ExpiresAt.Before(time.Now()) {
-				h.log.Warn("auth attempt with expired JWT admin token ", "token", t)
-				return echo.NewHTTPError(http.StatusUnauthorized)
+				h.requestLogger(c).Warn("auth attempt with expired JWT admin token ", "token", t)
+				return apperr.ErrBadToken
 			}
 
 			if t.IsAdmin {
@@ -175,16 +225,25 @@ func (h *Handler) AddUserClaim() echo.MiddlewareFunc {
 			}
 
 			// verify if token is allowed
-			user, err := h.repo.GetUser(t.Email)
+			usr, err := h.repo.GetUser(c.Request().Context(), t.Email)
 			if err != nil {
-				h.log.Error("failed to get user from db", "err", err.Error())
-				return echo.NewHTTPError(http.StatusInternalServerError, err)
+				if errors.Is(err, user.ErrNotFound) {
+					h.requestLogger(c).Warn("auth attempt with token of unknown user", "email", t.Email)
+					return apperr.ErrBadToken
+				}
+				h.requestLogger(c).Error("failed to get user from db", "err", err.Error())
+				return err
+
+			}
 
+			if usr.Suspended {
+				h.requestLogger(c).Warn("auth attempt of suspended user", "email", t.Email)
+				return user.ErrSuspended
 			}
 
-			if !slices.Contains(user.ActiveJWT, token) {
-				h.log.Warn("auth attempt with removed JWT token ", "token", t)
-				return echo.NewHTTPError(http.StatusUnauthorized)
+			if !slices.Contains(usr.ActiveJWT, token) {
+				h.requestLogger(c).Warn("auth attempt with removed JWT token ", "token", t)
+				return apperr.ErrBadToken
 			}
 
 			c.Set(claim.UserClaimContextKey, t)
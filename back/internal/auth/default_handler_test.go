@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/claim"
+	"github.com/pzolo85/todo-app/back/internal/emailaddr"
+	"github.com/pzolo85/todo-app/back/internal/storage"
+	"github.com/pzolo85/todo-app/back/internal/user"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+)
+
+// run with -race
+func TestHandler_ConcurrentLogins(t *testing.T) {
+	ctx := context.Background()
+	const workers = 30
+
+	store, err := storage.OpenBolt(filepath.Join(t.TempDir(), "test.bolt"), storage.Options{})
+	assert.Nil(t, err)
+	defer store.Close()
+
+	repo, err := user.NewDefaultRepo(store, cache.New(time.Hour, time.Hour), "admin", "user")
+	assert.Nil(t, err)
+	assert.Nil(t, repo.SaveUser(ctx, &user.User{
+		Email:     "jon@test.com",
+		PassHash:  "abc123",
+		Role:      "user",
+		CreatedAt: time.Now(),
+	}, false))
+
+	svc := NewDefaultService([]byte("test-key"), jwt.SigningMethodHS256, claim.Validation{}, slog.Default())
+	h := NewDefaultHandler(svc, slog.Default(), repo, emailaddr.Default)
+	e := echo.New()
+
+	tokens := make(chan string, workers)
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(`{"email":"jon@test.com","hash":"abc123"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set("User-Agent", "test")
+			rec := httptest.NewRecorder()
+
+			assert.Nil(t, h.LoginHandler(e.NewContext(req, rec)))
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var res LoginResponse
+			assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			tokens <- res.Token
+		}()
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				assert.Nil(t, repo.MakeAdmin(ctx, "jon@test.com"))
+			} else {
+				assert.Nil(t, repo.DisableAdmin(ctx, "jon@test.com"))
+			}
+		}()
+	}
+	wg.Wait()
+	close(tokens)
+
+	u, err := repo.GetUser(ctx, "jon@test.com")
+	assert.Nil(t, err)
+	assert.Len(t, u.ActiveJWT, workers)
+	for token := range tokens {
+		assert.Contains(t, u.ActiveJWT, token)
+	}
+}
@@ -8,35 +8,72 @@
 package auth
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"time"
 
 	"github.com/golang-jwt/jwt"
-	"github.com/mitchellh/mapstructure"
 	"github.com/pzolo85/todo-app/back/internal/claim"
+	"github.com/pzolo85/todo-app/back/internal/tracing"
+	"go.opentelemetry.io/otel"
 )
 
+var tracer = otel.Tracer("github.com/pzolo85/todo-app/back/internal/auth")
+
+// maxTokenSize bounds the tokens that are parsed, the ones signed by the app
+// are a few hundred bytes
+const maxTokenSize = 8 << 10
+
 type DefaultService struct {
 	key           []byte
 	signingMethod jwt.SigningMethod
+	validation    claim.Validation
 	logger        *slog.Logger
+	// now is the clock the claims are verified against
+	now func() time.Time
 }
 
-func NewDefaultService(key []byte, signingMethod jwt.SigningMethod, logger *slog.Logger) *DefaultService {
+// NewDefaultService signs the tokens with the issuer and audience of validation,
+// and accepts the tokens that pass it
+func NewDefaultService(key []byte, signingMethod jwt.SigningMethod, validation claim.Validation, logger *slog.Logger) *DefaultService {
 	return &DefaultService{
 		key:           key,
 		signingMethod: signingMethod,
+		validation:    validation,
 		logger:        logger,
+		now:           time.Now,
 	}
 }
 
-func (s *DefaultService) GetJWT(u *claim.UserClaim) (string, error) {
+func (s *DefaultService) GetJWT(ctx context.Context, u *claim.UserClaim) (string, error) {
+	_, span := tracer.Start(ctx, "auth.GetJWT")
+	token, err := s.getJWT(u)
+	tracing.End(span, err)
+	return token, err
+}
+
+func (s *DefaultService) DecodeToken(ctx context.Context, t string) (*claim.UserClaim, error) {
+	ctx, span := tracer.Start(ctx, "auth.DecodeToken")
+	userClaim, err := s.decodeToken(ctx, t)
+	tracing.End(span, err)
+	return userClaim, err
+}
+
+func (s *DefaultService) getJWT(u *claim.UserClaim) (string, error) {
 	if err := u.Valid(); err != nil {
 		return "", err
 	}
 
-	t := jwt.NewWithClaims(s.signingMethod, u)
+	c := *u
+	c.Issuer = s.validation.Issuer
+	c.Audience = nil
+	if s.validation.Audience != "" {
+		c.Audience = []string{s.validation.Audience}
+	}
+	c.Legacy = false
+
+	t := jwt.NewWithClaims(s.signingMethod, c)
 	tstr, err := t.SignedString(s.key)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token > %w", err)
@@ -45,8 +82,15 @@ func (s *DefaultService) GetJWT(u *claim.UserClaim) (string, error) {
 	return tstr, nil
 }
 
-func (s *DefaultService) DecodeToken(t string) (*claim.UserClaim, error) {
-	token, err := jwt.Parse(t, func(t *jwt.Token) (any, error) {
+func (s *DefaultService) decodeToken(ctx context.Context, t string) (*claim.UserClaim, error) {
+	if len(t) > maxTokenSize {
+		return nil, fmt.Errorf("token of %d bytes exceeds %d bytes", len(t), maxTokenSize)
+	}
+
+	// the claims are verified below, with the clock skew
+	parser := jwt.Parser{SkipClaimsValidation: true}
+	var userClaim claim.UserClaim
+	_, err := parser.ParseWithClaims(t, &userClaim, func(t *jwt.Token) (any, error) {
 		if t.Method != s.signingMethod {
 			return nil, fmt.Errorf("invalid signing method: %s", t.Method)
 		}
@@ -56,35 +100,12 @@ func (s *DefaultService) DecodeToken(t string) (*claim.UserClaim, error) {
 		return nil, fmt.Errorf("failed to parse token > %w", err)
 	}
 
-	var userClaim claim.UserClaim
-	mapClaims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, fmt.Errorf("failed to convert claim to mapclaims")
-	}
-
-	for k, v := range token.Claims.(jwt.MapClaims) {
-		s.logger.Debug("user claim: ",
-			slog.String("key", k),
-			slog.Any("value", v),
-		)
+	s.logger.DebugContext(ctx, "user claim decoded", "claim", userClaim)
+	if err := userClaim.Verify(s.validation, s.now()); err != nil {
+		return nil, fmt.Errorf("failed to validate claims > %w", err)
 	}
-
-	dhf := mapstructure.StringToTimeHookFunc(time.RFC3339)
-	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
-		DecodeHook: dhf,
-		Result:     &userClaim,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create custom decoder > %w", err)
-	}
-
-	err = dec.Decode(mapClaims)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create custom decoder > %w", err)
-	}
-
-	if userClaim.Valid() != nil {
-		return nil, fmt.Errorf("failed to validate claims > %w", userClaim.Valid())
+	if userClaim.Legacy {
+		s.logger.DebugContext(ctx, "legacy token accepted", "email", userClaim.Email, "claim_id", userClaim.ClaimID)
 	}
 
 	return &userClaim, nil
@@ -0,0 +1,428 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pzolo85/todo-app/back/internal/claim"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+// testKey signs the tokens of the seed corpus
+var testKey = []byte("fuzz-key")
+
+// testNow is the clock of the test service, the times of the cases are
+// relative to it so the corpus never expires
+var testNow = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+var updateCorpus = flag.Bool("update-corpus", false, "write the cases of TestDecodeToken to the corpus of FuzzDecodeToken")
+
+var testValidation = claim.Validation{
+	Issuer:       "todo-app",
+	Audience:     "todo-app",
+	ClockSkew:    time.Minute,
+	AcceptLegacy: true,
+}
+
+func newTestService(v claim.Validation) *DefaultService {
+	svc := NewDefaultService(testKey, jwt.SigningMethodHS256, v, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	svc.now = func() time.Time { return testNow }
+	return svc
+}
+
+func validClaims() jwt.MapClaims {
+	now := testNow
+	return jwt.MapClaims{
+		"iss":            "todo-app",
+		"aud":            "todo-app",
+		"sub":            "jon@test.com",
+		"iat":            now.Add(-time.Hour).Unix(),
+		"nbf":            now.Add(-time.Hour).Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"jti":            "8b7f2a54-5a0e-4b2c-9a53-cb3b1e7a9d0e",
+		"is_admin":       false,
+		"source_address": "127.0.0.1",
+		"user_agent":     "curl/8.5.0",
+	}
+}
+
+// legacyClaims are signed before the registered claims
+func legacyClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"email":          "jon@test.com",
+		"created_at":     "2024-10-07T01:12:40Z",
+		"expires_at":     "0001-01-01T00:00:00Z",
+		"is_admin":       false,
+		"source_address": "127.0.0.1",
+		"user_agent":     "curl/8.5.0",
+		"claim_id":       "8b7f2a54-5a0e-4b2c-9a53-cb3b1e7a9d0e",
+	}
+}
+
+// with returns c with key set to v, or removed when v is nil
+func with(c jwt.MapClaims, key string, v any) jwt.MapClaims {
+	if v == nil {
+		delete(c, key)
+	} else {
+		c[key] = v
+	}
+	return c
+}
+
+func sign(t testing.TB, method jwt.SigningMethod, key any, claims jwt.Claims) string {
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token > %s", err)
+	}
+	return token
+}
+
+// signRaw signs payload as is with the test key, to send claims that are not a json object
+func signRaw(t testing.TB, payload string) string {
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc.EncodeToString([]byte(payload))
+	sig, err := jwt.SigningMethodHS256.Sign(unsigned, testKey)
+	if err != nil {
+		t.Fatalf("failed to sign payload > %s", err)
+	}
+	return unsigned + "." + sig
+}
+
+type decodeTest struct {
+	name    string
+	token   string
+	wantErr bool
+}
+
+// decodeTests are the cases of TestDecodeToken, they also seed FuzzDecodeToken
+func decodeTests(t testing.TB) []decodeTest {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key > %s", err)
+	}
+	hs256 := func(c jwt.MapClaims) string {
+		return sign(t, jwt.SigningMethodHS256, testKey, c)
+	}
+	now := testNow
+	valid := hs256(validClaims())
+	parts := strings.Split(valid, ".")
+
+	return []decodeTest{
+		{name: "valid", token: valid},
+		{name: "admin", token: hs256(with(validClaims(), "is_admin", true))},
+		{name: "unknown claims are ignored", token: hs256(with(validClaims(), "role", "admin"))},
+		{name: "no expiry", token: hs256(with(validClaims(), "exp", nil))},
+
+		// malformed
+		{name: "empty", token: "", wantErr: true},
+		{name: "not a jwt", token: "deadbeef", wantErr: true},
+		{name: "two segments", token: parts[0] + "." + parts[1], wantErr: true},
+		{name: "four segments", token: valid + ".", wantErr: true},
+		{name: "bad base64", token: parts[0] + ".!!!." + parts[2], wantErr: true},
+		{name: "payload not json", token: signRaw(t, "not json"), wantErr: true},
+		{name: "payload is an array", token: signRaw(t, `["jon@test.com"]`), wantErr: true},
+		{name: "payload is null", token: signRaw(t, "null"), wantErr: true},
+
+		// signature
+		{name: "wrong key", token: sign(t, jwt.SigningMethodHS256, []byte("other-key"), validClaims()), wantErr: true},
+		{name: "tampered payload", token: parts[0] + "." + strings.Split(hs256(with(validClaims(), "is_admin", true)), ".")[1] + "." + parts[2], wantErr: true},
+		{name: "no signature", token: parts[0] + "." + parts[1] + ".", wantErr: true},
+
+		// algorithms
+		{name: "HS384", token: sign(t, jwt.SigningMethodHS384, testKey, validClaims()), wantErr: true},
+		{name: "HS512", token: sign(t, jwt.SigningMethodHS512, testKey, validClaims()), wantErr: true},
+		{name: "RS256", token: sign(t, jwt.SigningMethodRS256, rsaKey, validClaims()), wantErr: true},
+		{name: "none", token: sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, validClaims()), wantErr: true},
+
+		// registered claims
+		{name: "wrong issuer", token: hs256(with(validClaims(), "iss", "other-app")), wantErr: true},
+		{name: "no issuer", token: hs256(with(validClaims(), "iss", nil)), wantErr: true},
+		{name: "wrong audience", token: hs256(with(validClaims(), "aud", "other-app")), wantErr: true},
+		{name: "aud is an array", token: hs256(with(validClaims(), "aud", []string{"other-app", "todo-app"}))},
+		{name: "aud is an array without the audience", token: hs256(with(validClaims(), "aud", []string{"other-app"})), wantErr: true},
+		{name: "aud is an empty array", token: hs256(with(validClaims(), "aud", []string{})), wantErr: true},
+		{name: "expired", token: hs256(with(validClaims(), "exp", now.Add(-2*time.Minute).Unix())), wantErr: true},
+		{name: "expired within the clock skew", token: hs256(with(validClaims(), "exp", now.Add(-30*time.Second).Unix()))},
+		{name: "not valid yet", token: hs256(with(validClaims(), "nbf", now.Add(2*time.Minute).Unix())), wantErr: true},
+		{name: "not valid yet within the clock skew", token: hs256(with(validClaims(), "nbf", now.Add(30*time.Second).Unix()))},
+		{name: "issued in the future", token: hs256(with(validClaims(), "iat", now.Add(2*time.Minute).Unix())), wantErr: true},
+
+		// type confusion
+		{name: "sub is a number", token: hs256(with(validClaims(), "sub", 42)), wantErr: true},
+		{name: "sub is an object", token: hs256(with(validClaims(), "sub", map[string]any{"a": "b"})), wantErr: true},
+		{name: "is_admin is a string", token: hs256(with(validClaims(), "is_admin", "true")), wantErr: true},
+		{name: "is_admin is a number", token: hs256(with(validClaims(), "is_admin", 1)), wantErr: true},
+		{name: "iat is a string", token: hs256(with(validClaims(), "iat", "2024-10-07T01:12:40Z")), wantErr: true},
+		{name: "exp is a string", token: hs256(with(validClaims(), "exp", "never")), wantErr: true},
+		{name: "exp is a float", token: hs256(with(validClaims(), "exp", 1e300)), wantErr: true},
+		{name: "aud is a number", token: hs256(with(validClaims(), "aud", 1)), wantErr: true},
+		{name: "aud is an array of numbers", token: hs256(with(validClaims(), "aud", []int{1})), wantErr: true},
+		{name: "jti is an array", token: hs256(with(validClaims(), "jti", []string{"a"})), wantErr: true},
+		{name: "missing sub", token: hs256(with(validClaims(), "sub", nil)), wantErr: true},
+		{name: "missing jti", token: hs256(with(validClaims(), "jti", nil)), wantErr: true},
+		{name: "null sub", token: signRaw(t, `{"sub":null,"iss":"todo-app","aud":"todo-app","source_address":"127.0.0.1","user_agent":"curl","jti":"1"}`), wantErr: true},
+
+		// legacy claims
+		{name: "legacy", token: hs256(legacyClaims())},
+		{name: "legacy admin", token: hs256(with(with(legacyClaims(), "is_admin", true), "expires_at", now.Add(time.Hour).Format(time.RFC3339)))},
+		{name: "legacy expired", token: hs256(with(legacyClaims(), "expires_at", now.Add(-time.Hour).Format(time.RFC3339))), wantErr: true},
+		{name: "legacy expired exp", token: hs256(with(legacyClaims(), "exp", 1)), wantErr: true},
+		{name: "legacy email is a number", token: hs256(with(legacyClaims(), "email", 42)), wantErr: true},
+		{name: "legacy created_at is a number", token: hs256(with(legacyClaims(), "created_at", 1728263560)), wantErr: true},
+		{name: "legacy expires_at is not a time", token: hs256(with(legacyClaims(), "expires_at", "tomorrow")), wantErr: true},
+		{name: "legacy claim_id is an array", token: hs256(with(legacyClaims(), "claim_id", []string{"a"})), wantErr: true},
+		{name: "legacy missing claim_id", token: hs256(with(legacyClaims(), "claim_id", nil)), wantErr: true},
+
+		// size
+		{name: "oversized", token: hs256(with(validClaims(), "user_agent", strings.Repeat("a", maxTokenSize))), wantErr: true},
+	}
+}
+
+func TestDecodeToken(t *testing.T) {
+	svc := newTestService(testValidation)
+	for _, tt := range decodeTests(t) {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := svc.DecodeToken(context.Background(), tt.token)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				assert.Nil(t, c)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, "jon@test.com", c.Email)
+			assert.Equal(t, "8b7f2a54-5a0e-4b2c-9a53-cb3b1e7a9d0e", c.ClaimID)
+		})
+	}
+}
+
+func TestDecodeToken_Legacy(t *testing.T) {
+	ctx := context.Background()
+	token := sign(t, jwt.SigningMethodHS256, testKey, legacyClaims())
+
+	c, err := newTestService(testValidation).DecodeToken(ctx, token)
+	assert.Nil(t, err)
+	assert.True(t, c.Legacy)
+	assert.Equal(t, time.Date(2024, 10, 7, 1, 12, 40, 0, time.UTC), c.CreatedAt)
+
+	// the transition is over
+	v := testValidation
+	v.AcceptLegacy = false
+	_, err = newTestService(v).DecodeToken(ctx, token)
+	assert.ErrorContains(t, err, "legacy claims are not accepted")
+
+	// past the cutoff
+	v = testValidation
+	v.LegacyUntil = testNow.Add(-time.Second)
+	_, err = newTestService(v).DecodeToken(ctx, token)
+	assert.ErrorContains(t, err, "legacy claims are not accepted")
+}
+
+func TestGetJWT_RegisteredClaims(t *testing.T) {
+	svc := newTestService(testValidation)
+	created := time.Date(2024, 10, 7, 1, 12, 40, 0, time.UTC)
+	token, err := svc.GetJWT(context.Background(), &claim.UserClaim{
+		Email:     "jon@test.com",
+		CreatedAt: created,
+		ExpiresAt: created.Add(time.Hour),
+		SourceIP:  "127.0.0.1",
+		UserAgent: "curl/8.5.0",
+		ClaimID:   "1",
+	})
+	assert.Nil(t, err)
+
+	var claims jwt.MapClaims
+	_, _, err = new(jwt.Parser).ParseUnverified(token, &claims)
+	assert.Nil(t, err)
+	assert.Equal(t, jwt.MapClaims{
+		"iss":            "todo-app",
+		"aud":            "todo-app",
+		"sub":            "jon@test.com",
+		"iat":            float64(created.Unix()),
+		"nbf":            float64(created.Unix()),
+		"exp":            float64(created.Add(time.Hour).Unix()),
+		"jti":            "1",
+		"is_admin":       false,
+		"source_address": "127.0.0.1",
+		"user_agent":     "curl/8.5.0",
+	}, claims)
+}
+
+// corpusFile is the file of the case name in the corpus of FuzzDecodeToken
+func corpusFile(name string) string {
+	return filepath.Join("testdata", "fuzz", "FuzzDecodeToken", strings.ReplaceAll(name, " ", "_"))
+}
+
+// TestDecodeTokenCorpus checks that every case of TestDecodeToken is in the
+// corpus of FuzzDecodeToken with the same outcome, go test -update-corpus
+// writes them again
+func TestDecodeTokenCorpus(t *testing.T) {
+	svc := newTestService(testValidation)
+	for _, tt := range decodeTests(t) {
+		t.Run(tt.name, func(t *testing.T) {
+			path := corpusFile(tt.name)
+			if *updateCorpus {
+				entry := fmt.Sprintf("go test fuzz v1\nstring(%q)\n", tt.token)
+				assert.Nil(t, os.WriteFile(path, []byte(entry), 0644))
+			}
+
+			entry, err := os.ReadFile(path)
+			if !assert.Nil(t, err, "run go test -run TestDecodeTokenCorpus -update-corpus") {
+				return
+			}
+			var token string
+			_, err = fmt.Sscanf(string(entry), "go test fuzz v1\nstring(%q)\n", &token)
+			if !assert.Nil(t, err) {
+				return
+			}
+			_, err = svc.DecodeToken(context.Background(), token)
+			assert.Equal(t, tt.wantErr, err != nil, "run go test -run TestDecodeTokenCorpus -update-corpus")
+		})
+	}
+}
+
+// FuzzDecodeToken checks that only the tokens signed with the key and
+// algorithm of the service are accepted, and that they decode into valid
+// claims that sign back into the same claims. The corpus in testdata/fuzz
+// holds the cases of TestDecodeToken, signed relative to testNow.
+func FuzzDecodeToken(f *testing.F) {
+	svc := newTestService(testValidation)
+	f.Fuzz(func(t *testing.T, token string) {
+		c, err := svc.DecodeToken(context.Background(), token)
+		if err != nil {
+			return
+		}
+
+		assert.LessOrEqual(t, len(token), maxTokenSize)
+		assert.Nil(t, c.Verify(testValidation, testNow))
+		// only the signature, the claims were verified with the clock skew
+		parser := jwt.Parser{SkipClaimsValidation: true}
+		parsed, err := parser.ParseWithClaims(token, &jwt.MapClaims{}, func(t *jwt.Token) (any, error) {
+			return testKey, nil
+		})
+		if assert.Nil(t, err) {
+			assert.Equal(t, jwt.SigningMethodHS256.Alg(), parsed.Method.Alg())
+		}
+
+		resigned, err := svc.GetJWT(context.Background(), c)
+		if assert.Nil(t, err) {
+			assertRoundTrip(t, svc, c, resigned)
+		}
+	})
+}
+
+// FuzzDecodeClaims signs arbitrary payloads with the key of the service, as a
+// leaked key or a bug in the signer would, and checks that the decoded claims
+// are valid
+func FuzzDecodeClaims(f *testing.F) {
+	f.Add(`{"sub":"jon@test.com","iss":"todo-app","aud":"todo-app","source_address":"127.0.0.1","user_agent":"curl","jti":"1"}`)
+	f.Add(`{"sub":"jon@test.com","iss":"todo-app","aud":"todo-app","source_address":"127.0.0.1","user_agent":"curl","jti":"1","is_admin":"yes"}`)
+	f.Add(`{"sub":["jon@test.com"],"iss":1,"aud":{},"source_address":1,"user_agent":{},"jti":null}`)
+	f.Add(`{"sub":"jon@test.com","iss":"todo-app","aud":"todo-app","source_address":"127.0.0.1","user_agent":"curl","jti":"1","iat":1e400}`)
+	f.Add(`{"sub":"jon@test.com","iss":"todo-app","aud":"todo-app","source_address":"127.0.0.1","user_agent":"curl","jti":"1","exp":-1,"nbf":9223372036854775807}`)
+	f.Add(`{"email":"jon@test.com","source_address":"127.0.0.1","user_agent":"curl","claim_id":"1","created_at":"2024-10-07T01:12:40Z"}`)
+	f.Add(`{"email":"jon@test.com","sub":"","source_address":"127.0.0.1","user_agent":"curl","claim_id":"1","jti":"2"}`)
+	f.Add(`[]`)
+
+	svc := newTestService(testValidation)
+	f.Fuzz(func(t *testing.T, payload string) {
+		c, err := svc.DecodeToken(context.Background(), signRaw(t, payload))
+		if err != nil {
+			return
+		}
+		assert.Nil(t, c.Verify(testValidation, testNow))
+	})
+}
+
+// FuzzSignDecode checks that the claims signed by GetJWT decode into the same
+// claims, when they are valid
+func FuzzSignDecode(f *testing.F) {
+	now := testNow
+	f.Add("jon@test.com", "127.0.0.1", "curl/8.5.0", "8b7f2a54-5a0e-4b2c-9a53-cb3b1e7a9d0e", false, now.UnixNano(), int64(0), 0)
+	f.Add("admin@localhost", "::1", "todo-app", "1", true, now.Add(-time.Hour).UnixNano(), now.Add(time.Hour).UnixNano(), 120)
+	f.Add("jön@tëst.com", "10.0.0.1", "Mozilla/5.0 (X11; Linux x86_64)", "\"quoted\"", false, int64(-62135596800000000), int64(1<<62), -570)
+
+	svc := newTestService(testValidation)
+	f.Fuzz(func(t *testing.T, email string, sourceIP string, userAgent string, claimID string, isAdmin bool, createdAt int64, expiresAt int64, offsetMinutes int) {
+		// json only carries valid utf-8
+		for _, s := range []string{email, sourceIP, userAgent, claimID} {
+			if !utf8.ValidString(s) {
+				t.Skip()
+			}
+		}
+		zone := time.FixedZone("", offsetMinutes%(24*60)*60)
+
+		c := &claim.UserClaim{
+			Email:     email,
+			CreatedAt: time.Unix(0, createdAt).In(zone),
+			IsAdmin:   isAdmin,
+			SourceIP:  sourceIP,
+			UserAgent: userAgent,
+			ClaimID:   claimID,
+		}
+		if expiresAt != 0 {
+			c.ExpiresAt = time.Unix(0, expiresAt)
+		}
+
+		token, err := svc.GetJWT(context.Background(), c)
+		if c.Valid() != nil {
+			assert.NotNil(t, err)
+			return
+		}
+		if !assert.Nil(t, err) || len(token) > maxTokenSize {
+			return
+		}
+
+		if signed(c).Verify(testValidation, testNow) != nil {
+			_, err := svc.DecodeToken(context.Background(), token)
+			assert.NotNil(t, err)
+			return
+		}
+		assertRoundTrip(t, svc, c, token)
+	})
+}
+
+// signed returns c as it is signed by the test service: the times are whole
+// seconds in UTC, the epoch being a missing time, nbf is iat and the issuer
+// and audience are set
+func signed(c *claim.UserClaim) claim.UserClaim {
+	seconds := func(t time.Time) time.Time {
+		if t.IsZero() || t.Unix() == 0 {
+			return time.Time{}
+		}
+		return time.Unix(t.Unix(), 0).UTC()
+	}
+
+	s := *c
+	if s.NotBefore.IsZero() {
+		s.NotBefore = s.CreatedAt
+	}
+	s.CreatedAt = seconds(s.CreatedAt)
+	s.NotBefore = seconds(s.NotBefore)
+	s.ExpiresAt = seconds(s.ExpiresAt)
+	s.Issuer = testValidation.Issuer
+	s.Audience = []string{testValidation.Audience}
+	s.Legacy = false
+	return s
+}
+
+// assertRoundTrip checks that token decodes into c as it is signed
+func assertRoundTrip(t *testing.T, svc *DefaultService, c *claim.UserClaim, token string) {
+	got, err := svc.DecodeToken(context.Background(), token)
+	if assert.Nil(t, err) {
+		assert.Equal(t, signed(c), *got)
+	}
+}
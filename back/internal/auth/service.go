@@ -1,8 +1,12 @@
 package auth
 
-import "github.com/pzolo85/todo-app/back/internal/claim"
+import (
+	"context"
+
+	"github.com/pzolo85/todo-app/back/internal/claim"
+)
 
 type Service interface {
-	DecodeToken(t string) (*claim.UserClaim, error)
-	GetJWT(u *claim.UserClaim) (string, error)
+	DecodeToken(ctx context.Context, t string) (*claim.UserClaim, error)
+	GetJWT(ctx context.Context, u *claim.UserClaim) (string, error)
 }
@@ -0,0 +1,43 @@
+package backup
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type DefaultHandler struct {
+	svc    Service
+	logger *slog.Logger
+}
+
+func NewDefaultHandler(svc Service, logger *slog.Logger) *DefaultHandler {
+	return &DefaultHandler{
+		svc:    svc,
+		logger: logger.WithGroup("backup_handler"),
+	}
+}
+
+func (h *DefaultHandler) AddHandler(g *echo.Group) {
+	g.GET("/backup", h.Backup)
+}
+
+func (h *DefaultHandler) Backup(c echo.Context) error {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "application/gzip")
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, FileName(time.Now())))
+	res.WriteHeader(http.StatusOK)
+
+	// headers are already sent, errors can only be logged
+	manifest, err := h.svc.Write(res)
+	if err != nil {
+		h.logger.Error("failed to stream backup", "err", err.Error())
+		return nil
+	}
+
+	h.logger.Info("backup streamed", "manifest", manifest)
+	return nil
+}
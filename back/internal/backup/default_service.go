@@ -0,0 +1,239 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/migrate"
+	"github.com/pzolo85/todo-app/back/internal/storage"
+)
+
+type DefaultService struct {
+	store storage.Store
+}
+
+func NewDefaultService(store storage.Store) *DefaultService {
+	return &DefaultService{
+		store: store,
+	}
+}
+
+// Write streams a compressed archive of a consistent snapshot of the db to w
+func (s *DefaultService) Write(w io.Writer) (*Manifest, error) {
+	dir, err := os.MkdirTemp("", "todo_backup_*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tmp dir > %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	snapshot := filepath.Join(dir, dbEntry)
+	if err := s.store.SnapshotFile(snapshot); err != nil {
+		return nil, fmt.Errorf("failed to take db snapshot > %w", err)
+	}
+
+	version, err := readVersion(s.store.Backend(), snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open db snapshot > %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat db snapshot > %w", err)
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	now := time.Now()
+
+	err = tw.WriteHeader(&tar.Header{
+		Name:    dbEntry,
+		Mode:    0600,
+		Size:    info.Size(),
+		ModTime: now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write db header > %w", err)
+	}
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tw, hash), f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write db snapshot > %w", err)
+	}
+
+	manifest := Manifest{
+		CreatedAt:     now,
+		Backend:       s.store.Backend(),
+		SchemaVersion: version,
+		Size:          n,
+		SHA256:        hex.EncodeToString(hash.Sum(nil)),
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest > %w", err)
+	}
+
+	err = tw.WriteHeader(&tar.Header{
+		Name:    manifestEntry,
+		Mode:    0600,
+		Size:    int64(len(manifestBytes)),
+		ModTime: now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write manifest header > %w", err)
+	}
+
+	if _, err := tw.Write(manifestBytes); err != nil {
+		return nil, fmt.Errorf("failed to write manifest > %w", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close archive > %w", err)
+	}
+
+	if err := gw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close archive > %w", err)
+	}
+
+	return &manifest, nil
+}
+
+// Restore validates the archive and replaces the db of the given backend at dbPath with its content.
+// The server must be stopped, and the archive schema cannot be newer than latestVersion.
+func Restore(archivePath string, backend string, dbPath string, latestVersion int) (*Manifest, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive > %w", err)
+	}
+	defer f.Close()
+
+	// the db is extracted next to the target so it can be renamed in place
+	tmp, err := os.CreateTemp(filepath.Dir(dbPath), ".restore_*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tmp db > %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	manifest, sum, size, err := extract(f, tmp)
+	tmp.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case manifest == nil:
+		return nil, fmt.Errorf("invalid archive > %s is missing", manifestEntry)
+	case manifest.SHA256 != sum || manifest.Size != size:
+		return nil, fmt.Errorf("invalid archive > checksum mismatch")
+	case manifest.Backend != backend:
+		return nil, fmt.Errorf("archive holds a %s db, use 'db convert' to move it to %s", manifest.Backend, backend)
+	case manifest.SchemaVersion > latestVersion:
+		return nil, fmt.Errorf("%w: archive version %d, supported version %d", migrate.ErrSchemaTooNew, manifest.SchemaVersion, latestVersion)
+	}
+
+	version, err := readVersion(backend, tmp.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read restored db > %w", err)
+	}
+	if version != manifest.SchemaVersion {
+		return nil, fmt.Errorf("invalid archive > db version %d does not match manifest version %d", version, manifest.SchemaVersion)
+	}
+
+	// fails if the server holds the lock of the current db
+	current, err := storage.Open(backend, dbPath, storage.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock db (is the server running?) > %w", err)
+	}
+	current.Close()
+
+	// stale sqlite journals would be replayed on top of the restored db
+	for _, journal := range []string{dbPath + "-wal", dbPath + "-shm"} {
+		if err := os.Remove(journal); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove %s > %w", journal, err)
+		}
+	}
+
+	if err := os.Rename(tmp.Name(), dbPath); err != nil {
+		return nil, fmt.Errorf("failed to replace db > %w", err)
+	}
+
+	return manifest, nil
+}
+
+func extract(r io.Reader, db io.Writer) (*Manifest, string, int64, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("failed to decompress archive > %w", err)
+	}
+	defer gr.Close()
+
+	var manifest *Manifest
+	var sum string
+	var size int64
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, "", 0, fmt.Errorf("failed to read archive > %w", err)
+		}
+
+		switch hdr.Name {
+		case dbEntry, legacyDBEntry:
+			hash := sha256.New()
+			size, err = io.Copy(io.MultiWriter(db, hash), tr)
+			if err != nil {
+				return nil, "", 0, fmt.Errorf("failed to extract db > %w", err)
+			}
+			sum = hex.EncodeToString(hash.Sum(nil))
+		case manifestEntry:
+			manifest = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, "", 0, fmt.Errorf("failed to decode manifest > %w", err)
+			}
+			// archives written before sqlite support only held bolt dbs
+			if manifest.Backend == "" {
+				manifest.Backend = storage.BackendBolt
+			}
+		}
+	}
+
+	return manifest, sum, size, nil
+}
+
+func readVersion(backend string, path string) (int, error) {
+	store, err := storage.Open(backend, path, storage.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return 0, fmt.Errorf("failed to open db snapshot > %w", err)
+	}
+	defer store.Close()
+
+	var version int
+	err = store.View(func(tx storage.Tx) error {
+		version, err = migrate.ReadVersion(tx)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version > %w", err)
+	}
+
+	return version, nil
+}
@@ -0,0 +1,83 @@
+package backup
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/migrate"
+	"github.com/pzolo85/todo-app/back/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultService_WriteRestore(t *testing.T) {
+	for _, backend := range storage.Backends {
+		t.Run(backend, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := storage.Open(backend, filepath.Join(dir, "src.db"), storage.Options{})
+			assert.Nil(t, err)
+			defer store.Close()
+
+			bucket := []byte("test")
+			err = store.Update(func(tx storage.Tx) error {
+				if err := tx.CreateBucket(bucket); err != nil {
+					return err
+				}
+				return tx.Put(bucket, []byte("key"), []byte("value"))
+			})
+			assert.Nil(t, err)
+
+			archive := filepath.Join(dir, FileName(time.Now()))
+			assert.Nil(t, WriteFile(NewDefaultService(store), archive))
+
+			t.Run("restore", func(t *testing.T) {
+				dbPath := filepath.Join(dir, "restored.db")
+				manifest, err := Restore(archive, backend, dbPath, migrate.LatestVersion(migrate.Migrations))
+				assert.Nil(t, err)
+				assert.Equal(t, 0, manifest.SchemaVersion)
+				assert.Equal(t, backend, manifest.Backend)
+
+				restored, err := storage.Open(backend, dbPath, storage.Options{ReadOnly: true})
+				assert.Nil(t, err)
+				defer restored.Close()
+
+				err = restored.View(func(tx storage.Tx) error {
+					v, err := tx.Get(bucket, []byte("key"))
+					assert.Equal(t, []byte("value"), v)
+					return err
+				})
+				assert.Nil(t, err)
+			})
+
+			t.Run("corrupted archive", func(t *testing.T) {
+				data, err := os.ReadFile(archive)
+				assert.Nil(t, err)
+
+				corrupted := filepath.Join(dir, "corrupted.tar.gz")
+				assert.Nil(t, os.WriteFile(corrupted, data[:len(data)/2], 0600))
+
+				_, err = Restore(corrupted, backend, filepath.Join(dir, "corrupted.db"), migrate.LatestVersion(migrate.Migrations))
+				assert.NotNil(t, err)
+			})
+		})
+	}
+}
+
+func TestJob_prune(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now()
+	for i := range 5 {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, FileName(start.Add(time.Duration(i)*time.Hour))), nil, 0600))
+	}
+
+	j := NewJob(nil, slog.Default(), dir, time.Hour, 2)
+	assert.Nil(t, j.prune())
+
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, FileName(start.Add(4*time.Hour)), entries[1].Name())
+}
@@ -0,0 +1,117 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const filePrefix = "todo-app-"
+
+// FileName returns the name of an archive created at t
+func FileName(t time.Time) string {
+	return filePrefix + t.UTC().Format("20060102T150405Z") + ".tar.gz"
+}
+
+// Job writes a backup to dir every interval and keeps the last retention archives
+type Job struct {
+	svc       Service
+	logger    *slog.Logger
+	dir       string
+	interval  time.Duration
+	retention int
+}
+
+func NewJob(svc Service, logger *slog.Logger, dir string, interval time.Duration, retention int) *Job {
+	return &Job{
+		svc:       svc,
+		logger:    logger.WithGroup("backup_job"),
+		dir:       dir,
+		interval:  interval,
+		retention: retention,
+	}
+}
+
+// Run takes a backup every interval until ctx is done
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		path, err := j.Backup(time.Now())
+		if err != nil {
+			j.logger.Error("scheduled backup failed", "err", err.Error())
+			continue
+		}
+		j.logger.Info("scheduled backup written", "path", path)
+
+		if err := j.prune(); err != nil {
+			j.logger.Error("failed to prune old backups", "err", err.Error())
+		}
+	}
+}
+
+func (j *Job) Backup(now time.Time) (string, error) {
+	if err := os.MkdirAll(j.dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create backup dir > %w", err)
+	}
+
+	path := filepath.Join(j.dir, FileName(now))
+	return path, WriteFile(j.svc, path)
+}
+
+func (j *Job) prune() error {
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read backup dir > %w", err)
+	}
+
+	archives := []string{}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), filePrefix) {
+			archives = append(archives, e.Name())
+		}
+	}
+
+	// names sort by creation time
+	slices.Sort(archives)
+	for len(archives) > j.retention {
+		if err := os.Remove(filepath.Join(j.dir, archives[0])); err != nil {
+			return fmt.Errorf("failed to remove %s > %w", archives[0], err)
+		}
+		archives = archives[1:]
+	}
+
+	return nil
+}
+
+// WriteFile writes a backup of svc to path
+func WriteFile(svc Service, path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create backup file > %w", err)
+	}
+
+	if _, err := svc.Write(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return fmt.Errorf("failed to write backup > %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close backup file > %w", err)
+	}
+
+	return nil
+}
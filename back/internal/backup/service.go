@@ -0,0 +1,29 @@
+// Package backup takes consistent snapshots of the database while the server runs
+//
+// A backup is a gzipped tar archive holding the db file (db) followed by a
+// manifest (manifest.json) with the storage backend, the schema version and
+// the sha256 of the db file.
+package backup
+
+import (
+	"io"
+	"time"
+)
+
+const (
+	dbEntry       = "db"
+	legacyDBEntry = "db.bolt"
+	manifestEntry = "manifest.json"
+)
+
+type Manifest struct {
+	CreatedAt     time.Time `json:"created_at"`
+	Backend       string    `json:"backend"`
+	SchemaVersion int       `json:"schema_version"`
+	Size          int64     `json:"size"`
+	SHA256        string    `json:"sha256"`
+}
+
+type Service interface {
+	Write(w io.Writer) (*Manifest, error)
+}
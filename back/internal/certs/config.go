@@ -0,0 +1,90 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	PolicyModern       = "modern"
+	PolicyIntermediate = "intermediate"
+	PolicyDefault      = "default"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// cipher suites for TLS 1.2, TLS 1.3 suites are not configurable
+var intermediateCiphers = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// NewTLSConfig builds the server tls.Config.
+//
+//	minVersion  // 1.2 or 1.3
+//	policy      // modern (TLS 1.3 only), intermediate (AEAD suites with forward secrecy) or default (Go defaults)
+//	clientCA    // optional PEM bundle used to verify client certificates
+func NewTLSConfig(r *Reloader, minVersion string, policy string, clientCA string) (*tls.Config, error) {
+	version, ok := tlsVersions[minVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported tls version: %s", minVersion)
+	}
+
+	cfg := &tls.Config{
+		GetCertificate: r.GetCertificate,
+		MinVersion:     version,
+	}
+
+	switch policy {
+	case PolicyModern:
+		cfg.MinVersion = tls.VersionTLS13
+	case PolicyIntermediate:
+		cfg.CipherSuites = intermediateCiphers
+	case PolicyDefault:
+	default:
+		return nil, fmt.Errorf("unknown cipher policy: %s", policy)
+	}
+
+	if clientCA != "" {
+		pem, err := os.ReadFile(clientCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client ca > %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", clientCA)
+		}
+
+		// only the admin group requires a certificate, see RequireClientCert
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return cfg, nil
+}
+
+// RequireClientCert rejects requests without a verified client certificate
+func RequireClientCert() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			state := c.Request().TLS
+			if state == nil || len(state.VerifiedChains) == 0 {
+				return echo.NewHTTPError(http.StatusUnauthorized, "client certificate required")
+			}
+			return next(c)
+		}
+	}
+}
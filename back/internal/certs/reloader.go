@@ -0,0 +1,103 @@
+// Package certs serves TLS certificates from disk and reloads them when they are rotated
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Reloader holds the certificate loaded from certPath and keyPath, and loads
+// it again when any of the files changes.
+type Reloader struct {
+	certPath string
+	keyPath  string
+	interval time.Duration
+	logger   *slog.Logger
+	cert     atomic.Pointer[tls.Certificate]
+	modTime  time.Time
+}
+
+func NewReloader(certPath string, keyPath string, interval time.Duration, logger *slog.Logger) (*Reloader, error) {
+	r := &Reloader{
+		certPath: certPath,
+		keyPath:  keyPath,
+		interval: interval,
+		logger:   logger.WithGroup("cert_reloader"),
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetCertificate can be used as tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate > %w", err)
+	}
+
+	modTime, err := r.lastModified()
+	if err != nil {
+		return err
+	}
+
+	r.cert.Store(&cert)
+	r.modTime = modTime
+	return nil
+}
+
+// Run reloads the certificate every interval if the files changed, until ctx is done.
+// A certificate that fails to load is logged and the previous one is kept.
+func (r *Reloader) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		modTime, err := r.lastModified()
+		if err != nil {
+			r.logger.Error("failed to stat certificate", "err", err.Error())
+			continue
+		}
+		if !modTime.After(r.modTime) {
+			continue
+		}
+
+		if err := r.Reload(); err != nil {
+			r.logger.Error("failed to reload certificate, keeping the current one", "err", err.Error())
+			continue
+		}
+		r.logger.Info("certificate reloaded", "cert", r.certPath)
+	}
+}
+
+func (r *Reloader) lastModified() (time.Time, error) {
+	var last time.Time
+	for _, path := range []string{r.certPath, r.keyPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to stat %s > %w", path, err)
+		}
+		if info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last, nil
+}
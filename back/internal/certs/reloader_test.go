@@ -0,0 +1,73 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.Nil(t, GenerateSelfSigned(certPath, keyPath, []string{"localhost"}, time.Hour))
+
+	r, err := NewReloader(certPath, keyPath, 10*time.Millisecond, slog.Default())
+	assert.Nil(t, err)
+	first, err := r.GetCertificate(nil)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	t.Run("invalid files keep the current certificate", func(t *testing.T) {
+		assert.Nil(t, os.WriteFile(certPath, []byte("garbage"), 0644))
+		time.Sleep(50 * time.Millisecond)
+
+		cert, err := r.GetCertificate(nil)
+		assert.Nil(t, err)
+		assert.Same(t, first, cert)
+	})
+
+	t.Run("rotated certificate is loaded", func(t *testing.T) {
+		// mtime resolution can be coarse
+		time.Sleep(20 * time.Millisecond)
+		assert.Nil(t, GenerateSelfSigned(certPath, keyPath, []string{"localhost"}, time.Hour))
+
+		assert.Eventually(t, func() bool {
+			cert, _ := r.GetCertificate(nil)
+			return cert != first
+		}, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.Nil(t, GenerateSelfSigned(certPath, keyPath, []string{"localhost"}, time.Hour))
+
+	r, err := NewReloader(certPath, keyPath, time.Minute, slog.Default())
+	assert.Nil(t, err)
+
+	cfg, err := NewTLSConfig(r, "1.2", PolicyModern, "")
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), cfg.MinVersion)
+
+	cfg, err = NewTLSConfig(r, "1.2", PolicyIntermediate, certPath)
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), cfg.MinVersion)
+	assert.NotEmpty(t, cfg.CipherSuites)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, cfg.ClientAuth)
+
+	_, err = NewTLSConfig(r, "1.0", PolicyDefault, "")
+	assert.NotNil(t, err)
+
+	_, err = NewTLSConfig(r, "1.3", "weak", "")
+	assert.NotNil(t, err)
+}
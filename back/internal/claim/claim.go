@@ -2,7 +2,9 @@
 package claim
 
 import (
+	"encoding/json"
 	"fmt"
+	"slices"
 	"time"
 )
 
@@ -10,15 +12,145 @@ const (
 	UserClaimContextKey = "user_claims"
 )
 
-// Holds the Claim section of the JWT
+// Holds the Claim section of the JWT. It is encoded with the registered
+// claims of RFC 7519: sub is the email, iat CreatedAt, exp ExpiresAt and
+// jti ClaimID. Tokens signed before them are decoded as Legacy claims.
 type UserClaim struct {
-	Email     string    `json:"email" mapstructure:"email"`
-	CreatedAt time.Time `json:"created_at" mapstructure:"created_at"`
-	ExpiresAt time.Time `json:"expires_at" mapstructure:"expires_at"`
-	IsAdmin   bool      `json:"is_admin" mapstructure:"is_admin"`
-	SourceIP  string    `json:"source_address" mapstructure:"source_address"`
-	UserAgent string    `json:"user_agent" mapstructure:"user_agent"`
-	ClaimID   string    `json:"claim_id" mapstructure:"claim_id"`
+	Email     string
+	CreatedAt time.Time
+	// NotBefore is CreatedAt when zero
+	NotBefore time.Time
+	// ExpiresAt is zero for tokens that are valid until they are revoked
+	ExpiresAt time.Time
+	IsAdmin   bool
+	SourceIP  string
+	UserAgent string
+	ClaimID   string
+	Issuer    string
+	// Audience holds the aud claim, a single audience is encoded as a string
+	Audience []string
+	// Legacy is set on claims decoded from tokens with the former
+	// email, created_at, expires_at and claim_id claims
+	Legacy bool
+}
+
+// payload is the json of the claim in the token
+type payload struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  audience `json:"aud,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	IsAdmin   bool     `json:"is_admin"`
+	SourceIP  string   `json:"source_address"`
+	UserAgent string   `json:"user_agent"`
+
+	// legacy claims
+	Email           string     `json:"email,omitempty"`
+	CreatedAt       *time.Time `json:"created_at,omitempty"`
+	LegacyExpiresAt *time.Time `json:"expires_at,omitempty"`
+	ClaimID         string     `json:"claim_id,omitempty"`
+}
+
+// audience is the aud claim, RFC 7519 allows a string or an array of strings
+type audience []string
+
+func (a audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("aud is neither a string nor an array of strings > %w", err)
+	}
+	*a = many
+	return nil
+}
+
+// unix returns the NumericDate of t, 0 omits the claim
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func fromUnix(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0).UTC()
+}
+
+// MarshalJSON encodes the registered claims, the times lose their fraction of second
+func (u UserClaim) MarshalJSON() ([]byte, error) {
+	nbf := u.NotBefore
+	if nbf.IsZero() {
+		nbf = u.CreatedAt
+	}
+
+	return json.Marshal(payload{
+		Issuer:    u.Issuer,
+		Audience:  audience(u.Audience),
+		Subject:   u.Email,
+		IssuedAt:  unix(u.CreatedAt),
+		NotBefore: unix(nbf),
+		ExpiresAt: unix(u.ExpiresAt),
+		ID:        u.ClaimID,
+		IsAdmin:   u.IsAdmin,
+		SourceIP:  u.SourceIP,
+		UserAgent: u.UserAgent,
+	})
+}
+
+func (u *UserClaim) UnmarshalJSON(data []byte) error {
+	var p payload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+
+	*u = UserClaim{
+		Email:     p.Subject,
+		CreatedAt: fromUnix(p.IssuedAt),
+		NotBefore: fromUnix(p.NotBefore),
+		ExpiresAt: fromUnix(p.ExpiresAt),
+		IsAdmin:   p.IsAdmin,
+		SourceIP:  p.SourceIP,
+		UserAgent: p.UserAgent,
+		ClaimID:   p.ID,
+		Issuer:    p.Issuer,
+		Audience:  p.Audience,
+	}
+	if len(p.Audience) == 0 {
+		u.Audience = nil
+	}
+	if p.Subject != "" || p.Email == "" {
+		return nil
+	}
+
+	u.Legacy = true
+	u.Email = p.Email
+	u.ClaimID = p.ClaimID
+	if p.CreatedAt != nil {
+		u.CreatedAt = *p.CreatedAt
+	}
+	// the tokens of users were signed with a zero expires_at, a registered exp is checked as well
+	if p.LegacyExpiresAt != nil && !p.LegacyExpiresAt.IsZero() && (u.ExpiresAt.IsZero() || p.LegacyExpiresAt.Before(u.ExpiresAt)) {
+		u.ExpiresAt = *p.LegacyExpiresAt
+	}
+	return nil
 }
 
 func (u UserClaim) Valid() error {
@@ -39,3 +171,55 @@ func validateUser(u *UserClaim) error {
 	}
 	return nil
 }
+
+// Validation is what Verify accepts besides valid claims
+type Validation struct {
+	// Issuer and Audience must match the iss and aud claims, unless empty
+	Issuer   string
+	Audience string
+	// ClockSkew is tolerated on the times of the claim, the clocks of the
+	// servers signing and verifying the tokens may differ
+	ClockSkew time.Duration
+	// AcceptLegacy accepts the tokens signed before the registered claims,
+	// during the transition
+	AcceptLegacy bool
+	// LegacyUntil ends the transition, the legacy claims are rejected from
+	// then on even with AcceptLegacy. Zero sets no end.
+	LegacyUntil time.Time
+}
+
+// LegacyAccepted reports whether the legacy claims are accepted at now
+func (v Validation) LegacyAccepted(now time.Time) bool {
+	return v.AcceptLegacy && (v.LegacyUntil.IsZero() || now.Before(v.LegacyUntil))
+}
+
+// Verify checks that the claim is valid at now
+func (u UserClaim) Verify(v Validation, now time.Time) error {
+	if err := u.Valid(); err != nil {
+		return err
+	}
+
+	if u.Legacy {
+		if !v.LegacyAccepted(now) {
+			return fmt.Errorf("invalid user claim > legacy claims are not accepted")
+		}
+	} else {
+		if v.Issuer != "" && u.Issuer != v.Issuer {
+			return fmt.Errorf("invalid user claim > issuer %q is not %q", u.Issuer, v.Issuer)
+		}
+		if v.Audience != "" && !slices.Contains(u.Audience, v.Audience) {
+			return fmt.Errorf("invalid user claim > audience %q does not include %q", u.Audience, v.Audience)
+		}
+	}
+
+	if !u.ExpiresAt.IsZero() && now.After(u.ExpiresAt.Add(v.ClockSkew)) {
+		return fmt.Errorf("invalid user claim > expired at %s", u.ExpiresAt.Format(time.RFC3339))
+	}
+	if !u.NotBefore.IsZero() && now.Add(v.ClockSkew).Before(u.NotBefore) {
+		return fmt.Errorf("invalid user claim > not valid before %s", u.NotBefore.Format(time.RFC3339))
+	}
+	if !u.Legacy && now.Add(v.ClockSkew).Before(u.CreatedAt) {
+		return fmt.Errorf("invalid user claim > issued in the future at %s", u.CreatedAt.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -2,8 +2,11 @@
 package claim
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestUserClaim_Valid(t *testing.T) {
@@ -21,7 +24,38 @@ func TestUserClaim_Valid(t *testing.T) {
 		fields  fields
 		wantErr bool
 	}{
-		// TODO: Add test cases.
+		{
+			name:   "valid",
+			fields: fields{Email: "jon@test.com", SourceIP: "127.0.0.1", UserAgent: "curl", ClaimID: "1"},
+		},
+		{
+			name:   "times are optional",
+			fields: fields{Email: "jon@test.com", SourceIP: "127.0.0.1", UserAgent: "curl", ClaimID: "1", IsAdmin: true},
+		},
+		{
+			name:    "empty",
+			wantErr: true,
+		},
+		{
+			name:    "missing email",
+			fields:  fields{SourceIP: "127.0.0.1", UserAgent: "curl", ClaimID: "1"},
+			wantErr: true,
+		},
+		{
+			name:    "missing source address",
+			fields:  fields{Email: "jon@test.com", UserAgent: "curl", ClaimID: "1"},
+			wantErr: true,
+		},
+		{
+			name:    "missing user agent",
+			fields:  fields{Email: "jon@test.com", SourceIP: "127.0.0.1", ClaimID: "1"},
+			wantErr: true,
+		},
+		{
+			name:    "missing claim id",
+			fields:  fields{Email: "jon@test.com", SourceIP: "127.0.0.1", UserAgent: "curl"},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -50,7 +84,15 @@ func Test_validateUser(t *testing.T) {
 		args    args
 		wantErr bool
 	}{
-		// TODO: Add test cases.
+		{
+			name: "valid",
+			args: args{u: &UserClaim{Email: "jon@test.com", SourceIP: "127.0.0.1", UserAgent: "curl", ClaimID: "1"}},
+		},
+		{
+			name:    "blank fields",
+			args:    args{u: &UserClaim{}},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -60,3 +102,117 @@ func Test_validateUser(t *testing.T) {
 		})
 	}
 }
+
+func TestUserClaim_JSON(t *testing.T) {
+	created := time.Date(2024, 10, 7, 1, 12, 40, 0, time.UTC)
+	c := UserClaim{
+		Email:     "jon@test.com",
+		CreatedAt: created,
+		ExpiresAt: created.Add(time.Hour),
+		SourceIP:  "127.0.0.1",
+		UserAgent: "curl",
+		ClaimID:   "1",
+		Issuer:    "todo-app",
+		Audience:  []string{"todo-app"},
+	}
+
+	data, err := json.Marshal(c)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"iss":"todo-app","aud":"todo-app","sub":"jon@test.com","iat":1728263560,"nbf":1728263560,"exp":1728267160,"jti":"1","is_admin":false,"source_address":"127.0.0.1","user_agent":"curl"}`, string(data))
+
+	var decoded UserClaim
+	assert.Nil(t, json.Unmarshal(data, &decoded))
+	c.NotBefore = created
+	assert.Equal(t, c, decoded)
+
+	t.Run("legacy", func(t *testing.T) {
+		var legacy UserClaim
+		err := json.Unmarshal([]byte(`{"email":"jon@test.com","created_at":"2024-10-07T01:12:40Z","expires_at":"0001-01-01T00:00:00Z","is_admin":true,"source_address":"127.0.0.1","user_agent":"curl","claim_id":"1"}`), &legacy)
+		assert.Nil(t, err)
+		assert.Equal(t, UserClaim{
+			Email:     "jon@test.com",
+			CreatedAt: created,
+			IsAdmin:   true,
+			SourceIP:  "127.0.0.1",
+			UserAgent: "curl",
+			ClaimID:   "1",
+			Legacy:    true,
+		}, legacy)
+	})
+
+	t.Run("audience", func(t *testing.T) {
+		var many UserClaim
+		assert.Nil(t, json.Unmarshal([]byte(`{"sub":"jon@test.com","aud":["other","todo-app"]}`), &many))
+		assert.Equal(t, []string{"other", "todo-app"}, many.Audience)
+
+		data, err := json.Marshal(many)
+		assert.Nil(t, err)
+		assert.Contains(t, string(data), `"aud":["other","todo-app"]`)
+
+		var none UserClaim
+		assert.Nil(t, json.Unmarshal([]byte(`{"sub":"jon@test.com","aud":[]}`), &none))
+		assert.Nil(t, none.Audience)
+
+		for _, aud := range []string{`1`, `[1]`, `{}`, `["a",null,1]`} {
+			assert.NotNil(t, json.Unmarshal([]byte(`{"sub":"jon@test.com","aud":`+aud+`}`), &none), aud)
+		}
+	})
+}
+
+func TestUserClaim_Verify(t *testing.T) {
+	now := time.Now()
+	v := Validation{Issuer: "todo-app", Audience: "todo-app", ClockSkew: time.Minute, AcceptLegacy: true}
+	claim := func(f func(c *UserClaim)) UserClaim {
+		c := UserClaim{
+			Email:     "jon@test.com",
+			CreatedAt: now.Add(-time.Hour),
+			SourceIP:  "127.0.0.1",
+			UserAgent: "curl",
+			ClaimID:   "1",
+			Issuer:    "todo-app",
+			Audience:  []string{"todo-app"},
+		}
+		f(&c)
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		claim UserClaim
+		// v replaces the default validation
+		v       *Validation
+		wantErr string
+	}{
+		{name: "valid", claim: claim(func(c *UserClaim) {})},
+		{name: "invalid", claim: claim(func(c *UserClaim) { c.Email = "" }), wantErr: "email cannot be nil"},
+		{name: "wrong issuer", claim: claim(func(c *UserClaim) { c.Issuer = "other" }), wantErr: "issuer"},
+		{name: "any issuer", claim: claim(func(c *UserClaim) { c.Issuer = "other" }), v: &Validation{Audience: "todo-app"}},
+		{name: "wrong audience", claim: claim(func(c *UserClaim) { c.Audience = []string{"other"} }), wantErr: "audience"},
+		{name: "no audience", claim: claim(func(c *UserClaim) { c.Audience = nil }), wantErr: "audience"},
+		{name: "one of the audiences", claim: claim(func(c *UserClaim) { c.Audience = []string{"other", "todo-app"} })},
+		{name: "expired", claim: claim(func(c *UserClaim) { c.ExpiresAt = now.Add(-2 * time.Minute) }), wantErr: "expired"},
+		{name: "expired within skew", claim: claim(func(c *UserClaim) { c.ExpiresAt = now.Add(-30 * time.Second) })},
+		{name: "not before", claim: claim(func(c *UserClaim) { c.NotBefore = now.Add(2 * time.Minute) }), wantErr: "not valid before"},
+		{name: "issued in the future", claim: claim(func(c *UserClaim) { c.CreatedAt = now.Add(2 * time.Minute) }), wantErr: "future"},
+		{name: "issued within skew", claim: claim(func(c *UserClaim) { c.CreatedAt = now.Add(30 * time.Second) })},
+		{name: "legacy", claim: claim(func(c *UserClaim) { c.Legacy, c.Issuer, c.Audience = true, "", nil })},
+		{name: "legacy before the cutoff", claim: claim(func(c *UserClaim) { c.Legacy = true }), v: &Validation{AcceptLegacy: true, LegacyUntil: now.Add(time.Hour)}},
+		{name: "legacy after the cutoff", claim: claim(func(c *UserClaim) { c.Legacy = true }), v: &Validation{AcceptLegacy: true, LegacyUntil: now}, wantErr: "legacy"},
+		{name: "legacy rejected", claim: claim(func(c *UserClaim) { c.Legacy = true }), v: &Validation{}, wantErr: "legacy"},
+		{name: "legacy expired", claim: claim(func(c *UserClaim) { c.Legacy, c.ExpiresAt = true, now.Add(-time.Hour) }), wantErr: "expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			val := v
+			if tt.v != nil {
+				val = *tt.v
+			}
+			err := tt.claim.Verify(val, now)
+			if tt.wantErr == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -7,30 +7,103 @@ import (
 	"os"
 	"time"
 
-	"github.com/kelseyhightower/envconfig"
+	"github.com/pzolo85/todo-app/back/internal/claim"
+	"github.com/pzolo85/todo-app/back/internal/emailaddr"
 )
 
 type Config struct {
-	Key            []byte
-	Level          string `default:"info"`
-	Address        string `default:"127.0.0.1"`
-	Port           int    `default:"7777"`
-	DBPath         string `default:"./db.bolt"`
-	AdminRole      string `default:"admin"`
-	UserRole       string `default:"user"`
-	SignAdminToken bool
-	SignDuration   time.Duration
-	SignEmail      string
-	GenerateKey    bool
+	Key       Secret `yaml:"key"`
+	Level     string `default:"info" yaml:"level"`
+	Address   string `default:"127.0.0.1" yaml:"address"`
+	Port      int    `default:"7777" yaml:"port"`
+	DBPath    string `default:"./db.bolt" yaml:"db_path"`
+	AdminRole string `default:"admin" yaml:"admin_role"`
+	UserRole  string `default:"user" yaml:"user_role"`
+
+	DBBackend            string        `default:"bolt" yaml:"db_backend"`
+	ExportAsyncThreshold int           `default:"1000" yaml:"export_async_threshold"`
+	DeletionGracePeriod  time.Duration `default:"720h" yaml:"deletion_grace_period"`
+	PurgeInterval        time.Duration `default:"1h" yaml:"purge_interval"`
+	AutoMigrate          bool          `default:"true" yaml:"auto_migrate"`
+	BackupDir            string        `yaml:"backup_dir"`
+	BackupInterval       time.Duration `default:"24h" yaml:"backup_interval"`
+	BackupRetention      int           `default:"7" yaml:"backup_retention"`
+	ShutdownTimeout      time.Duration `default:"15s" yaml:"shutdown_timeout"`
+
+	// TLS is enabled when TLSCert and TLSKey are set
+	TLSCert           string        `yaml:"tls_cert"`
+	TLSKey            string        `yaml:"tls_key"`
+	TLSMinVersion     string        `default:"1.2" yaml:"tls_min_version"`
+	TLSCipherPolicy   string        `default:"intermediate" yaml:"tls_cipher_policy"`
+	TLSClientCA       string        `yaml:"tls_client_ca"`
+	TLSReloadInterval time.Duration `default:"1m" yaml:"tls_reload_interval"`
+	TLSRedirectPort   int           `yaml:"tls_redirect_port"`
+
+	MetricsEnabled bool `default:"true" yaml:"metrics_enabled"`
+	// MetricsToken must be sent as a bearer token to read /metrics, unset refuses every request
+	MetricsToken string `yaml:"metrics_token"`
+	// MetricsPublic serves /metrics without the token
+	MetricsPublic bool `yaml:"metrics_public"`
+
+	// TraceExporter is otlp-grpc, otlp-http or stdout, unset disables tracing
+	TraceExporter    string  `yaml:"trace_exporter"`
+	TraceEndpoint    string  `yaml:"trace_endpoint"`
+	TraceSampleRatio float64 `default:"1" yaml:"trace_sample_ratio"`
+
+	// the tokens are signed with JWTIssuer and JWTAudience, and must carry them
+	JWTIssuer    string        `default:"todo-app" yaml:"jwt_issuer"`
+	JWTAudience  string        `default:"todo-app" yaml:"jwt_audience"`
+	JWTClockSkew time.Duration `default:"1m" yaml:"jwt_clock_skew"`
+	// JWTAcceptLegacy accepts the tokens signed before the registered claims, turn it off once they are revoked
+	JWTAcceptLegacy bool `default:"true" yaml:"jwt_accept_legacy"`
+	// JWTLegacyUntil rejects the legacy tokens from then on, unset keeps accepting them
+	JWTLegacyUntil time.Time `yaml:"jwt_legacy_until"`
+
+	// EmailProviderRules folds provider aliases like dots and +tags in gmail addresses into one account
+	// changing it requires todo-app db migrate up, unless AutoMigrate is set
+	EmailProviderRules bool `yaml:"email_provider_rules"`
+}
+
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCert != "" && c.TLSKey != ""
+}
+
+// Emails returns the normalizer that turns addresses into account identities
+func (c *Config) Emails() emailaddr.Normalizer {
+	return emailaddr.Normalizer{ProviderRules: c.EmailProviderRules}
+}
+
+// TokenValidation returns the checks of the tokens
+func (c *Config) TokenValidation() claim.Validation {
+	return claim.Validation{
+		Issuer:       c.JWTIssuer,
+		Audience:     c.JWTAudience,
+		ClockSkew:    c.JWTClockSkew,
+		AcceptLegacy: c.JWTAcceptLegacy,
+		LegacyUntil:  c.JWTLegacyUntil,
+	}
+}
+
+// BaseURL is the address of the server used in the links sent to users
+func (c *Config) BaseURL() string {
+	scheme := "http"
+	if c.TLSEnabled() {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s:%d", scheme, c.Address, c.Port)
 }
 
 const (
 	appEnv          = "APP_ENV"
+	appConfig       = "APP_CONFIG"
 	defaultKeyUsage = "file holding the signing key for JWT"
+	configUsage     = "yaml config file, overrides the defaults and is overridden by env vars and flags"
 )
 
 var (
-	KeyFile        string
+	KeyFile string
+	// ConfigFile is the path of the loaded config file, empty when there is none
+	ConfigFile     string
 	defaultKeyPath string
 )
 
@@ -43,33 +116,64 @@ func init() {
 	defaultKeyPath = home + "/.todo-app.key"
 }
 
+// Load builds the config from, in order of precedence, the flags, the env vars
+// prefixed with $APP_ENV, the config file and the defaults. It is not validated,
+// see Validate.
 func Load() (*Config, error) {
-	env := os.Getenv(appEnv)
-	if env == "" {
-		fmt.Fprintf(os.Stderr, "env var %s is not set. Trying to load config from flags\n\n", appEnv)
-	}
-
-	var cfg Config
-	err := envconfig.Process(env, &cfg)
-	if err != nil {
-		return nil, fmt.Errorf("failed to process env vars > %w", err)
-	}
-
+	var (
+		level, address, dbPath string
+		port                   int
+	)
 	flag.Usage = showUsage
 	flag.StringVar(&KeyFile, "k", defaultKeyPath, defaultKeyUsage)
 	flag.StringVar(&KeyFile, "key-path", defaultKeyPath, defaultKeyUsage)
+	flag.StringVar(&ConfigFile, "f", os.Getenv(appConfig), configUsage)
+	flag.StringVar(&ConfigFile, "config", os.Getenv(appConfig), configUsage)
 	flag.BoolFunc("h", "show this help", showHelp)
 	flag.BoolFunc("help", "show this help", showHelp)
-	flag.BoolVar(&cfg.SignAdminToken, "c", false, "create a new admin JWT token")
-	flag.BoolVar(&cfg.SignAdminToken, "create-token", false, "create a new admin JWT token")
-	flag.BoolVar(&cfg.GenerateKey, "g", false, fmt.Sprintf("create a new JWT signing key (%s)", defaultKeyPath))
-	flag.BoolVar(&cfg.GenerateKey, "generate", false, fmt.Sprintf("create a new JWT signing key (%s)", defaultKeyPath))
-	flag.DurationVar(&cfg.SignDuration, "d", time.Minute*15, "duration of the admin JWT token")
-	flag.DurationVar(&cfg.SignDuration, "duration", time.Minute*15, "duration of the admin JWT token")
-	flag.StringVar(&cfg.SignEmail, "e", "admin@localhost", "email address to use in the JWT token")
-	flag.StringVar(&cfg.SignEmail, "email", "admin@localhost", "email address to use in the JWT token")
+	flag.StringVar(&level, "l", "", "log level: debug, info, warn or error")
+	flag.StringVar(&level, "level", "", "log level: debug, info, warn or error")
+	flag.StringVar(&address, "a", "", "address to listen on")
+	flag.StringVar(&address, "address", "", "address to listen on")
+	flag.IntVar(&port, "p", 0, "port to listen on")
+	flag.IntVar(&port, "port", 0, "port to listen on")
+	flag.StringVar(&dbPath, "db-path", "", "path of the database file")
 	flag.Parse()
 
+	env := os.Getenv(appEnv)
+	if env == "" && ConfigFile == "" {
+		fmt.Fprintf(os.Stderr, "neither env var %s nor a config file is set. Trying to load config from flags\n\n", appEnv)
+	}
+
+	applyFlags = func(cfg *Config) {
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "l", "level":
+				cfg.Level = level
+			case "a", "address":
+				cfg.Address = address
+			case "p", "port":
+				cfg.Port = port
+			case "db-path":
+				cfg.DBPath = dbPath
+			}
+		})
+	}
+
+	return Reload()
+}
+
+// applyFlags sets the fields given on the command line, it is set by Load
+var applyFlags = func(*Config) {}
+
+// Reload builds the config again from the sources Load used, without parsing the flags again
+func Reload() (*Config, error) {
+	cfg, err := load(os.Getenv(appEnv), ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	applyFlags(cfg)
+
 	file, err := os.Open(KeyFile)
 	if err == nil && len(cfg.Key) == 0 {
 		defer file.Close()
@@ -82,12 +186,7 @@ func Load() (*Config, error) {
 		}
 	}
 
-	if len(cfg.Key) == 0 && !cfg.GenerateKey {
-		flag.Usage()
-		return nil, fmt.Errorf("jwt signing key is missing")
-	}
-
-	return &cfg, nil
+	return cfg, nil
 }
 
 func showHelp(val string) error {
@@ -96,8 +195,15 @@ func showHelp(val string) error {
 	return nil
 }
 
+// Commands is the list of commands shown by the help, set by main
+var Commands string
+
 func showUsage() {
 	fmt.Fprintf(os.Stderr, `%s%s`, banner, summary)
+	if Commands != "" {
+		fmt.Fprintf(os.Stderr, " Commands:\n\n%s\n", Commands)
+	}
+	fmt.Fprintf(os.Stderr, " Flags:\n\n")
 	flag.PrintDefaults()
 }
 
@@ -114,4 +220,7 @@ const summary = `
  
  Usage:
 
- `
+   todo-app [flags] <command> [command flags] [args]
+   todo-app <command> -h
+
+`
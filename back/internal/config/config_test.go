@@ -0,0 +1,147 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/apperr"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeFile(t, `
+level: debug
+port: 8080
+purge_interval: 5m
+metrics_token: from-file
+`)
+	t.Setenv("TEST_PORT", "9090")
+
+	cfg, err := load("test", path)
+	assert.Nil(t, err)
+	assert.Equal(t, "debug", cfg.Level, "file wins over defaults")
+	assert.Equal(t, 9090, cfg.Port, "env wins over file")
+	assert.Equal(t, 5*time.Minute, cfg.PurgeInterval)
+	assert.Equal(t, "from-file", cfg.MetricsToken)
+	assert.Equal(t, "127.0.0.1", cfg.Address, "defaults stay")
+}
+
+func TestLoad_LegacyUntil(t *testing.T) {
+	until := time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)
+	cfg, err := load("test", writeFile(t, "jwt_legacy_until: 2026-12-31T00:00:00Z\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, until, cfg.TokenValidation().LegacyUntil)
+
+	t.Setenv("TEST_JWTLEGACYUNTIL", "2027-01-31T00:00:00Z")
+	cfg, err = load("test", "")
+	assert.Nil(t, err)
+	assert.Equal(t, until.AddDate(0, 1, 0), cfg.JWTLegacyUntil)
+}
+
+func TestDefaults(t *testing.T) {
+	cfg, err := load("defaults_test", "")
+	assert.Nil(t, err)
+	assert.Equal(t, cfg, Defaults())
+}
+
+func TestLoad_UnknownField(t *testing.T) {
+	_, err := load("test", writeFile(t, "prot: 8080\n"))
+	assert.ErrorContains(t, err, "field prot not found")
+}
+
+func TestConfig_WriteYAML(t *testing.T) {
+	cfg, err := load("test", writeFile(t, "key: super-secret\nmetrics_token: token\n"))
+	assert.Nil(t, err)
+
+	var out strings.Builder
+	assert.Nil(t, cfg.WriteYAML(&out))
+	assert.NotContains(t, out.String(), "super-secret")
+	assert.NotContains(t, out.String(), "token: token")
+	assert.Contains(t, out.String(), `key: '*****'`)
+	assert.Equal(t, Secret("super-secret"), cfg.Key)
+
+	// the output is a valid config file
+	again, err := load("test", writeFile(t, out.String()))
+	assert.Nil(t, err)
+	assert.Equal(t, cfg.Port, again.Port)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	cfg, err := load("test", "")
+	assert.Nil(t, err)
+	cfg.Key = Secret("abcdef")
+	cfg.DBPath = filepath.Join(t.TempDir(), "db.bolt")
+	assert.Nil(t, cfg.Validate())
+
+	cfg.Port = 70000
+	cfg.UserRole = cfg.AdminRole
+	cfg.Level = "verbose"
+	cfg.DBPath = "/does/not/exist/db.bolt"
+	cfg.TLSCert = "cert.pem"
+
+	err = cfg.Validate()
+	for _, field := range []string{"port:", "user_role:", "level:", "db_path:", "tls_cert:"} {
+		assert.ErrorContains(t, err, field)
+	}
+}
+
+func TestWatcher_Reload(t *testing.T) {
+	valid := func() *Config {
+		cfg, err := load("test", "")
+		assert.Nil(t, err)
+		cfg.Key = Secret("abcdef")
+		cfg.DBPath = filepath.Join(t.TempDir(), "db.bolt")
+		return cfg
+	}
+
+	current := valid()
+	var next *Config
+	w := NewWatcher(current, func() (*Config, error) { return next, nil }, slog.Default())
+
+	var got []Runtime
+	w.Subscribe(func(rt Runtime) { got = append(got, rt) })
+
+	t.Run("runtime changes are applied", func(t *testing.T) {
+		next = valid()
+		next.Level = "debug"
+		next.Port = 8080
+
+		rt, err := w.Reload()
+		assert.Nil(t, err)
+		assert.Equal(t, "debug", rt.Level)
+		assert.Equal(t, []Runtime{rt}, got)
+		assert.Equal(t, 7777, w.current.Port, "port requires a restart")
+	})
+
+	t.Run("invalid config is rejected", func(t *testing.T) {
+		next = valid()
+		next.Level = "verbose"
+
+		rt, err := w.Reload()
+		e, ok := apperr.As(err)
+		assert.True(t, ok)
+		assert.Equal(t, []apperr.FieldError{{Field: "level", Code: "invalid", Message: `must be one of ["debug" "info" "warn" "error"], got "verbose"`}}, e.Fields)
+		assert.Equal(t, "debug", rt.Level)
+		assert.Len(t, got, 1)
+	})
+
+	t.Run("unchanged config is not sent", func(t *testing.T) {
+		next = valid()
+		next.Level = "debug"
+
+		_, err := w.Reload()
+		assert.Nil(t, err)
+		assert.Len(t, got, 1)
+	})
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/pzolo85/todo-app/back/internal/log"
+
+	"github.com/labstack/echo/v4"
+)
+
+type DefaultHandler struct {
+	watcher *Watcher
+	logger  *slog.Logger
+}
+
+func NewDefaultHandler(watcher *Watcher, logger *slog.Logger) *DefaultHandler {
+	return &DefaultHandler{
+		watcher: watcher,
+		logger:  logger.WithGroup("config_handler"),
+	}
+}
+
+// requestLogger returns the request logger, see log.Middleware
+func (h *DefaultHandler) requestLogger(c echo.Context) *slog.Logger {
+	return log.FromContext(c, h.logger, "config_handler")
+}
+
+func (h *DefaultHandler) AddHandler(g *echo.Group) {
+	g.POST("/reload", h.Reload)
+}
+
+// Reload applies the runtime part of the config, as on SIGHUP
+func (h *DefaultHandler) Reload(c echo.Context) error {
+	rt, err := h.watcher.Reload()
+	if err != nil {
+		h.requestLogger(c).Warn("config reload rejected", "err", err.Error())
+		return err
+	}
+
+	h.requestLogger(c).Info("config reloaded from the admin api")
+	return c.JSON(http.StatusOK, rt)
+}
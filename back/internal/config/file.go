@@ -0,0 +1,113 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+	"gopkg.in/yaml.v3"
+)
+
+const masked = "*****"
+
+// Secret is a value that is never printed
+type Secret []byte
+
+func (s Secret) MarshalYAML() (any, error) {
+	if len(s) == 0 {
+		return "", nil
+	}
+	return masked, nil
+}
+
+func (s *Secret) UnmarshalYAML(n *yaml.Node) error {
+	*s = Secret(n.Value)
+	return nil
+}
+
+func (s Secret) LogValue() slog.Value {
+	v, _ := s.MarshalYAML()
+	return slog.StringValue(v.(string))
+}
+
+// load merges the defaults, the config file at path and the env vars with prefix, the later ones win
+func load(prefix string, path string) (*Config, error) {
+	var cfg Config
+	err := envconfig.Process(prefix, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process env vars > %w", err)
+	}
+	if path == "" {
+		return &cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file > %w", err)
+	}
+
+	fromFile := cfg
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&fromFile); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config file %s > %w", path, err)
+	}
+
+	// the defaults envconfig applied are replaced by the file, the env vars are not
+	file := reflect.ValueOf(&fromFile).Elem()
+	env := reflect.ValueOf(&cfg).Elem()
+	for i := range file.NumField() {
+		if _, ok := os.LookupEnv(envKey(prefix, file.Type().Field(i))); ok {
+			file.Field(i).Set(env.Field(i))
+		}
+	}
+
+	return &fromFile, nil
+}
+
+// Defaults returns the config with the defaults of the struct tags only, the
+// env vars and files are ignored
+func Defaults() *Config {
+	var cfg Config
+	v := reflect.ValueOf(&cfg).Elem()
+	for i := range v.NumField() {
+		if def, ok := v.Type().Field(i).Tag.Lookup("default"); ok {
+			// the defaults are yaml scalars, see TestDefaults
+			_ = yaml.Unmarshal([]byte(def), v.Field(i).Addr().Interface())
+		}
+	}
+	return &cfg
+}
+
+// envKey is the env var envconfig reads f from
+func envKey(prefix string, f reflect.StructField) string {
+	if prefix == "" {
+		return strings.ToUpper(f.Name)
+	}
+	return strings.ToUpper(prefix + "_" + f.Name)
+}
+
+// Masked returns a copy of c that is safe to print
+func (c *Config) Masked() *Config {
+	m := *c
+	if m.MetricsToken != "" {
+		m.MetricsToken = masked
+	}
+	return &m
+}
+
+// WriteYAML writes c in the config file format, with the secrets masked
+func (c *Config) WriteYAML(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Masked()); err != nil {
+		return fmt.Errorf("failed to encode config > %w", err)
+	}
+	return enc.Close()
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/apperr"
+)
+
+var ErrInvalidConfig = apperr.BadRequest("invalid_config", "the config could not be loaded, the running config is kept")
+
+// Runtime is the part of the config that can change without a restart
+type Runtime struct {
+	Level                string        `json:"level"`
+	ExportAsyncThreshold int           `json:"export_async_threshold"`
+	DeletionGracePeriod  time.Duration `json:"deletion_grace_period"`
+	MetricsToken         string        `json:"-"`
+}
+
+// runtimeFields are the fields of Config copied to Runtime
+var runtimeFields = []string{"Level", "ExportAsyncThreshold", "DeletionGracePeriod", "MetricsToken"}
+
+func (c *Config) Runtime() Runtime {
+	return Runtime{
+		Level:                c.Level,
+		ExportAsyncThreshold: c.ExportAsyncThreshold,
+		DeletionGracePeriod:  c.DeletionGracePeriod,
+		MetricsToken:         c.MetricsToken,
+	}
+}
+
+// Watcher reloads the config on SIGHUP or on demand, and hands the runtime part
+// to its subscribers. A config that fails to load or validate is rejected and the
+// running one is kept.
+type Watcher struct {
+	mu          sync.Mutex
+	current     *Config
+	load        func() (*Config, error)
+	subscribers []func(Runtime)
+	logger      *slog.Logger
+}
+
+func NewWatcher(cfg *Config, load func() (*Config, error), logger *slog.Logger) *Watcher {
+	return &Watcher{
+		current: cfg,
+		load:    load,
+		logger:  logger.WithGroup("config_watcher"),
+	}
+}
+
+// Subscribe registers fn to be called with the new runtime config after every reload that changes it
+func (w *Watcher) Subscribe(fn func(Runtime)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// Reload loads and validates the config, then applies its runtime part.
+// Changes to the other fields are logged and ignored until the next restart.
+func (w *Watcher) Reload() (Runtime, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	next, err := w.load()
+	if err != nil {
+		w.logger.Error("config reload rejected, the running config is kept", "err", err.Error())
+		return w.current.Runtime(), ErrInvalidConfig.Wrap(err)
+	}
+	if err := next.Validate(); err != nil {
+		w.logger.Error("config reload rejected, the running config is kept", "err", err.Error())
+		return w.current.Runtime(), validationError(err)
+	}
+
+	if changed := restartRequired(w.current, next); len(changed) > 0 {
+		w.logger.Warn("config changes ignored until restart", "fields", changed)
+	}
+
+	rt := next.Runtime()
+	if rt == w.current.Runtime() {
+		w.logger.Info("config reloaded, runtime config unchanged")
+		return rt, nil
+	}
+
+	for _, fn := range w.subscribers {
+		fn(rt)
+	}
+
+	tokenChanged := rt.MetricsToken != w.current.MetricsToken
+	applied := *w.current
+	applied.Level = rt.Level
+	applied.ExportAsyncThreshold = rt.ExportAsyncThreshold
+	applied.DeletionGracePeriod = rt.DeletionGracePeriod
+	applied.MetricsToken = rt.MetricsToken
+	w.current = &applied
+
+	w.logger.Info("config reloaded",
+		"level", rt.Level,
+		"export_async_threshold", rt.ExportAsyncThreshold,
+		"deletion_grace_period", rt.DeletionGracePeriod.String(),
+		"metrics_token_changed", tokenChanged,
+	)
+	return rt, nil
+}
+
+// Run reloads the config on every SIGHUP until ctx is done
+func (w *Watcher) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			w.logger.Info("SIGHUP received, reloading config")
+			w.Reload()
+		}
+	}
+}
+
+// restartRequired lists the yaml names of the fields outside Runtime that differ
+func restartRequired(current *Config, next *Config) []string {
+	var changed []string
+	cv := reflect.ValueOf(current).Elem()
+	nv := reflect.ValueOf(next).Elem()
+	for i := range cv.NumField() {
+		f := cv.Type().Field(i)
+		name := f.Tag.Get("yaml")
+		if name == "-" || slices.Contains(runtimeFields, f.Name) {
+			continue
+		}
+		if !reflect.DeepEqual(cv.Field(i).Interface(), nv.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// validationError lists the problems found by Validate as field errors
+func validationError(err error) error {
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+
+	fields := make([]apperr.FieldError, 0, len(errs))
+	for _, e := range errs {
+		field, msg, _ := strings.Cut(e.Error(), ": ")
+		fields = append(fields, apperr.FieldError{Field: field, Code: "invalid", Message: msg})
+	}
+	return apperr.Validation(fields...).Wrap(err)
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pzolo85/todo-app/back/internal/certs"
+	"github.com/pzolo85/todo-app/back/internal/storage"
+	"github.com/pzolo85/todo-app/back/internal/tracing"
+)
+
+var (
+	levels         = []string{"debug", "info", "warn", "error"}
+	tlsVersions    = []string{"1.2", "1.3"}
+	cipherPolicies = []string{certs.PolicyModern, certs.PolicyIntermediate, certs.PolicyDefault}
+	traceExporters = []string{tracing.ExporterNone, tracing.ExporterOTLPGRPC, tracing.ExporterOTLPHTTP, tracing.ExporterStdout}
+)
+
+// Validate checks the whole config and returns every problem found, joined
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, field string, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+		}
+	}
+	oneOf := func(field string, value string, valid []string) {
+		check(slices.Contains(valid, value), field, "must be one of %q, got %q", valid, value)
+	}
+
+	check(len(c.Key) > 5, "key", "jwt signing key is missing, or shorter than 6 bytes")
+	oneOf("level", strings.ToLower(c.Level), levels)
+	check(c.Address != "", "address", "is required")
+	check(validPort(c.Port), "port", "must be between 1 and 65535, got %d", c.Port)
+
+	check(c.AdminRole != "", "admin_role", "is required")
+	check(c.UserRole != "", "user_role", "is required")
+	check(c.AdminRole != c.UserRole, "user_role", "must differ from admin_role, both are %q", c.UserRole)
+
+	oneOf("db_backend", c.DBBackend, storage.Backends)
+	if err := writableDir(filepath.Dir(c.DBPath)); err != nil {
+		errs = append(errs, fmt.Errorf("db_path: directory is not writable > %w", err))
+	}
+	check(c.ExportAsyncThreshold >= 0, "export_async_threshold", "must not be negative")
+	check(c.DeletionGracePeriod >= 0, "deletion_grace_period", "must not be negative")
+	check(c.PurgeInterval > 0, "purge_interval", "must be positive")
+	check(c.ShutdownTimeout > 0, "shutdown_timeout", "must be positive")
+	if c.BackupDir != "" {
+		check(c.BackupInterval > 0, "backup_interval", "must be positive")
+		check(c.BackupRetention > 0, "backup_retention", "must keep at least one backup")
+	}
+
+	check((c.TLSCert == "") == (c.TLSKey == ""), "tls_cert", "tls_cert and tls_key must be set together")
+	oneOf("tls_min_version", c.TLSMinVersion, tlsVersions)
+	oneOf("tls_cipher_policy", c.TLSCipherPolicy, cipherPolicies)
+	check(c.TLSReloadInterval > 0, "tls_reload_interval", "must be positive")
+	if c.TLSEnabled() {
+		for _, f := range []struct{ field, path string }{{"tls_cert", c.TLSCert}, {"tls_key", c.TLSKey}, {"tls_client_ca", c.TLSClientCA}} {
+			if _, err := os.Stat(f.path); f.path != "" && err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", f.field, err))
+			}
+		}
+	} else {
+		check(c.TLSClientCA == "", "tls_client_ca", "requires tls_cert and tls_key")
+		check(c.TLSRedirectPort == 0, "tls_redirect_port", "requires tls_cert and tls_key")
+	}
+	if c.TLSRedirectPort != 0 {
+		check(validPort(c.TLSRedirectPort), "tls_redirect_port", "must be between 1 and 65535, got %d", c.TLSRedirectPort)
+		check(c.TLSRedirectPort != c.Port, "tls_redirect_port", "must differ from port")
+	}
+
+	check(c.JWTClockSkew >= 0, "jwt_clock_skew", "must not be negative")
+
+	oneOf("trace_exporter", c.TraceExporter, traceExporters)
+	check(c.TraceSampleRatio >= 0 && c.TraceSampleRatio <= 1, "trace_sample_ratio", "must be between 0 and 1, got %g", c.TraceSampleRatio)
+
+	return errors.Join(errs...)
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+// writableDir creates and removes a file in dir
+func writableDir(dir string) error {
+	f, err := os.CreateTemp(dir, ".todo-app-check-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
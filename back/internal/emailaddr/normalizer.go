@@ -0,0 +1,98 @@
+// Package emailaddr turns email addresses into the canonical form used as user identity
+//
+// Two addresses belong to the same account when their canonical forms are
+// equal. The canonical form is trimmed and lowercased, with the domain in
+// its ASCII (punycode) form. Provider rules optionally drop the parts some
+// providers ignore, like dots and +tags in gmail addresses.
+package emailaddr
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var ErrInvalid = errors.New("invalid email address")
+
+type Normalizer struct {
+	// ProviderRules applies the aliasing rules of well known providers
+	ProviderRules bool
+}
+
+// Default is used where no configured normalizer is available, like migrations
+var Default = Normalizer{}
+
+// providers maps a domain to its canonical domain and whether it ignores dots in the local part.
+// Every provider listed ignores the +tag suffix.
+var providers = map[string]struct {
+	domain     string
+	ignoreDots bool
+}{
+	"gmail.com":      {"gmail.com", true},
+	"googlemail.com": {"gmail.com", true},
+	"outlook.com":    {"outlook.com", false},
+	"hotmail.com":    {"hotmail.com", false},
+	"live.com":       {"live.com", false},
+	"fastmail.com":   {"fastmail.com", false},
+	"icloud.com":     {"icloud.com", false},
+}
+
+// Normalize returns the canonical form of addr. addr must be a bare address as
+// parsed by net/mail, without a display name or angle brackets.
+func (n Normalizer) Normalize(addr string) (string, error) {
+	addr = strings.TrimSpace(addr)
+	at := strings.LastIndexByte(addr, '@')
+	if at <= 0 || at == len(addr)-1 {
+		return "", fmt.Errorf("%w: %q", ErrInvalid, addr)
+	}
+	// net/mail refuses the trailing dot of a fully qualified domain
+	parsed, err := mail.ParseAddress(strings.TrimSuffix(addr, "."))
+	if err != nil {
+		return "", fmt.Errorf("%w: %q > %w", ErrInvalid, addr, err)
+	}
+	if parsed.Address != strings.TrimSuffix(addr, ".") {
+		return "", fmt.Errorf("%w: %q", ErrInvalid, addr)
+	}
+
+	local := strings.ToLower(addr[:at])
+	domain, err := idna.Lookup.ToASCII(strings.TrimSuffix(addr[at+1:], "."))
+	if err != nil {
+		return "", fmt.Errorf("%w: %q > %w", ErrInvalid, addr, err)
+	}
+
+	if p, ok := providers[domain]; ok && n.ProviderRules {
+		local, _, _ = strings.Cut(local, "+")
+		if p.ignoreDots {
+			local = strings.ReplaceAll(local, ".", "")
+		}
+		domain = p.domain
+		if local == "" {
+			return "", fmt.Errorf("%w: %q", ErrInvalid, addr)
+		}
+	}
+
+	return local + "@" + domain, nil
+}
+
+// Rules names the rules applied by n, they are recorded with the canonical
+// keys, see migrate.DefaultService.CanonicalizeEmails
+func (n Normalizer) Rules() string {
+	if n.ProviderRules {
+		return "provider"
+	}
+	return "default"
+}
+
+// Equal reports whether a and b are the same account. Invalid addresses
+// are only equal to themselves.
+func (n Normalizer) Equal(a string, b string) bool {
+	na, errA := n.Normalize(a)
+	nb, errB := n.Normalize(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return na == nb
+}
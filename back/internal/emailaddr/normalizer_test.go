@@ -0,0 +1,55 @@
+package emailaddr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizer_Normalize(t *testing.T) {
+	tests := []struct {
+		in            string
+		providerRules bool
+		want          string
+		wantErr       bool
+	}{
+		{in: "jon@test.com", want: "jon@test.com"},
+		{in: "  Jon@Test.COM ", want: "jon@test.com"},
+		{in: "jon@test.com.", want: "jon@test.com"},
+		{in: "jon@bücher.de", want: "jon@xn--bcher-kva.de"},
+		{in: "jon@XN--BCHER-KVA.de", want: "jon@xn--bcher-kva.de"},
+		{in: "J.On+news@GoogleMail.com", want: "j.on+news@googlemail.com"},
+		{in: "J.On+news@GoogleMail.com", providerRules: true, want: "jon@gmail.com"},
+		{in: "j.on+news@outlook.com", providerRules: true, want: "j.on@outlook.com"},
+		{in: "j.on+news@test.com", providerRules: true, want: "j.on+news@test.com"},
+		{in: "+news@gmail.com", providerRules: true, wantErr: true},
+		{in: "jon", wantErr: true},
+		{in: "@test.com", wantErr: true},
+		{in: "jon@", wantErr: true},
+		{in: "jon@exa mple.com", wantErr: true},
+		{in: "jon x@test.com", wantErr: true},
+		{in: "jon@@test.com", wantErr: true},
+		{in: "jon..x@test.com", wantErr: true},
+		{in: "Jon <jon@test.com>", wantErr: true},
+		{in: "<jon@test.com>", wantErr: true},
+		{in: "jon+news@test.com", want: "jon+news@test.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Normalizer{ProviderRules: tt.providerRules}.Normalize(tt.in)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalid)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNormalizer_Equal(t *testing.T) {
+	assert.True(t, Default.Equal("Jon@Test.com", "jon@test.com"))
+	assert.False(t, Default.Equal("jon@test.com", "mary@test.com"))
+	assert.True(t, Default.Equal("not an email", "not an email"))
+}
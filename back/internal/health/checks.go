@@ -0,0 +1,63 @@
+package health
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/pzolo85/todo-app/back/internal/migrate"
+	"github.com/pzolo85/todo-app/back/internal/storage"
+)
+
+// StoreCheck reads the schema version to make sure the db can be read
+func StoreCheck(store storage.Store) Check {
+	return func() error {
+		return store.View(func(tx storage.Tx) error {
+			_, err := migrate.ReadVersion(tx)
+			return err
+		})
+	}
+}
+
+// Workers tracks the background workers that must be running for the app to be ready
+type Workers struct {
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+func NewWorkers() *Workers {
+	return &Workers{
+		running: map[string]bool{},
+	}
+}
+
+func (w *Workers) Set(name string, running bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.running[name] = running
+}
+
+// Check fails when no worker was started or any of them stopped
+func (w *Workers) Check() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.running) == 0 {
+		return fmt.Errorf("workers not started")
+	}
+
+	stopped := []string{}
+	for name, running := range w.running {
+		if !running {
+			stopped = append(stopped, name)
+		}
+	}
+	if len(stopped) > 0 {
+		slices.Sort(stopped)
+		return fmt.Errorf("workers stopped: %s", strings.Join(stopped, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package health
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type DefaultHandler struct {
+	checks  []NamedCheck
+	version Version
+	logger  *slog.Logger
+}
+
+func NewDefaultHandler(logger *slog.Logger, checks ...NamedCheck) *DefaultHandler {
+	return &DefaultHandler{
+		checks:  checks,
+		version: ReadVersion(),
+		logger:  logger.WithGroup("health_handler"),
+	}
+}
+
+func (h *DefaultHandler) AddHandler(e *echo.Echo) {
+	e.GET("/healthz", h.Healthz)
+	e.GET("/readyz", h.Readyz)
+	e.GET("/version", h.Version)
+}
+
+// Healthz answers as long as the process can serve requests
+func (h *DefaultHandler) Healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, Report{Status: StatusOK})
+}
+
+// Readyz runs every check and fails with 503 if any of them fails
+func (h *DefaultHandler) Readyz(c echo.Context) error {
+	report := Report{
+		Status: StatusOK,
+		Checks: make(map[string]CheckResult, len(h.checks)),
+	}
+
+	for _, nc := range h.checks {
+		start := time.Now()
+		err := nc.Check()
+		res := CheckResult{
+			Status:   StatusOK,
+			Duration: time.Since(start).String(),
+		}
+		if err != nil {
+			h.logger.Warn("readiness check failed", "check", nc.Name, "err", err.Error())
+			res.Status = StatusFail
+			res.Error = err.Error()
+			report.Status = StatusFail
+		}
+		report.Checks[nc.Name] = res
+	}
+
+	if report.Status != StatusOK {
+		return c.JSON(http.StatusServiceUnavailable, report)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+func (h *DefaultHandler) Version(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.version)
+}
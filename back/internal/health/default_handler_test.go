@@ -0,0 +1,48 @@
+package health
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_Readyz(t *testing.T) {
+	workers := NewWorkers()
+	h := NewDefaultHandler(slog.Default(),
+		NamedCheck{Name: "ok", Check: func() error { return nil }},
+		NamedCheck{Name: "workers", Check: workers.Check},
+	)
+	e := echo.New()
+	h.AddHandler(e)
+
+	readyz := func() (int, Report) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		var report Report
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &report))
+		return rec.Code, report
+	}
+
+	code, report := readyz()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, StatusOK, report.Checks["ok"].Status)
+	assert.Equal(t, "workers not started", report.Checks["workers"].Error)
+
+	workers.Set("purge", true)
+	workers.Set("backup", true)
+	code, report = readyz()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusOK, report.Status)
+
+	workers.Set("backup", false)
+	code, report = readyz()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "workers stopped: backup", report.Checks["workers"].Error)
+}
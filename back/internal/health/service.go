@@ -0,0 +1,35 @@
+// Package health reports whether the app is alive, ready to serve, and which build is running
+package health
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Check returns an error when the dependency it probes is not usable
+type Check func() error
+
+type NamedCheck struct {
+	Name  string
+	Check Check
+}
+
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type Version struct {
+	Module    string `json:"module,omitempty"`
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+}
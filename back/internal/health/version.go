@@ -0,0 +1,45 @@
+package health
+
+import "runtime/debug"
+
+// BuildTime can be set at link time:
+//
+//	go build -ldflags "-X github.com/pzolo85/todo-app/back/internal/health.BuildTime=$(date -u +%FT%TZ)"
+//
+// otherwise the time of the vcs commit is reported.
+var BuildTime string
+
+func ReadVersion() Version {
+	v := Version{
+		Version:   "unknown",
+		BuildTime: BuildTime,
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return v
+	}
+
+	v.Module = info.Main.Path
+	v.Version = info.Main.Version
+	v.GoVersion = info.GoVersion
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			v.Revision = s.Value
+		case "vcs.modified":
+			v.Modified = s.Value == "true"
+		case "vcs.time":
+			if v.BuildTime == "" {
+				v.BuildTime = s.Value
+			}
+		}
+	}
+
+	if v.Version == "" {
+		// binaries built from a file list carry no module or vcs information
+		v.Version = "unknown"
+	}
+
+	return v
+}
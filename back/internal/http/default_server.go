@@ -1,31 +1,108 @@
 package http
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
+	nethttp "net/http"
+	"strconv"
+	"sync/atomic"
 
 	"github.com/pzolo85/todo-app/back/internal/auth"
+	"github.com/pzolo85/todo-app/back/internal/backup"
+	"github.com/pzolo85/todo-app/back/internal/certs"
+	"github.com/pzolo85/todo-app/back/internal/config"
+	"github.com/pzolo85/todo-app/back/internal/emailaddr"
+	"github.com/pzolo85/todo-app/back/internal/health"
+	"github.com/pzolo85/todo-app/back/internal/log"
 	"github.com/pzolo85/todo-app/back/internal/mail"
+	"github.com/pzolo85/todo-app/back/internal/metrics"
+	"github.com/pzolo85/todo-app/back/internal/openapi"
+	"github.com/pzolo85/todo-app/back/internal/tracing"
 	"github.com/pzolo85/todo-app/back/internal/user"
+	"github.com/pzolo85/todo-app/back/internal/validate"
 
 	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
 )
 
 type DefaultServer struct {
 	srv       *echo.Echo
 	logger    *slog.Logger
 	adminRole string
+	tlsConfig *tls.Config
+	// redirect sends plain HTTP requests to the TLS listener, nil when disabled
+	redirect     *nethttp.Server
+	redirectPort int
+	tlsPort      int
+	metricsToken atomic.Pointer[string]
 }
 
-func GetDefaultServer(echo *echo.Echo, log *slog.Logger, adminRole string) *DefaultServer {
+func GetDefaultServer(echo *echo.Echo, logger *slog.Logger, adminRole string, emails emailaddr.Normalizer) *DefaultServer {
+	echo.HTTPErrorHandler = ErrorHandler(logger)
+	echo.Binder = validate.NewBinder(emails)
+
+	// first middlewares, so everything after them is traced and logs with the request id
+	echo.Use(otelecho.Middleware(tracing.ServiceName))
+	echo.Use(log.Middleware(logger))
+
 	return &DefaultServer{
 		srv:       echo,
-		logger:    log,
+		logger:    logger,
 		adminRole: adminRole,
 	}
 }
 
-func (s *DefaultServer) LoadRoutes(authHandler *auth.Handler, mailHandler *mail.DefaultHandler, userHandler *user.DefaultHandler) error {
+// EnableTLS serves with tlsConfig. When redirectPort is set, a plain HTTP listener
+// on that port redirects every request to the TLS listener.
+// It must be called before LoadRoutes.
+func (s *DefaultServer) EnableTLS(tlsConfig *tls.Config, redirectPort int) {
+	s.tlsConfig = tlsConfig
+	if redirectPort == 0 {
+		return
+	}
+
+	s.redirect = &nethttp.Server{
+		Handler: nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			nethttp.Redirect(w, r, fmt.Sprintf("https://%s%s", s.redirectHost(r), r.URL.RequestURI()), nethttp.StatusMovedPermanently)
+		}),
+	}
+	s.redirectPort = redirectPort
+}
+
+// EnableMetrics records every request and serves the metrics at /metrics.
+// They require the metrics token unless public is set, see metrics.Handler.
+func (s *DefaultServer) EnableMetrics(token string, public bool) {
+	if public {
+		s.logger.Warn("metrics are served without authentication")
+	} else if token == "" {
+		s.logger.Warn("metrics are refused until MetricsToken is set, or MetricsPublic to serve them without authentication")
+	}
+
+	s.SetMetricsToken(token)
+	s.srv.Use(metrics.Middleware())
+	s.srv.GET("/metrics", metrics.Handler(func() string {
+		return *s.metricsToken.Load()
+	}, public))
+}
+
+// SetMetricsToken changes the token required by /metrics, it is safe to call while serving
+func (s *DefaultServer) SetMetricsToken(token string) {
+	s.metricsToken.Store(&token)
+}
+
+// Handler returns the handler of the routes, to serve them without Start as in tests
+func (s *DefaultServer) Handler() nethttp.Handler {
+	return s.srv
+}
+
+func (s *DefaultServer) LoadRoutes(authHandler *auth.Handler, mailHandler *mail.DefaultHandler, userHandler *user.DefaultHandler, backupHandler *backup.DefaultHandler, healthHandler *health.DefaultHandler, configHandler *config.DefaultHandler) error {
+	// probes
+	healthHandler.AddHandler(s.srv)
+
 	// api/v1
 	v1grp := s.srv.Group("/api/v1")
 
@@ -36,27 +113,103 @@ func (s *DefaultServer) LoadRoutes(authHandler *auth.Handler, mailHandler *mail.
 	authGrp := v1grp.Group("/auth")
 
 	// admin
-	adminGrp := v1grp.Group("/admin",
+	adminMW := []echo.MiddlewareFunc{
 		authHandler.AddUserClaim(),
 		authHandler.VerifyRole([]string{s.adminRole}),
-	)
+	}
+	if s.tlsConfig != nil && s.tlsConfig.ClientCAs != nil {
+		adminMW = append([]echo.MiddlewareFunc{certs.RequireClientCert()}, adminMW...)
+	}
+	adminGrp := v1grp.Group("/admin", adminMW...)
 
 	// admin/mail
 	mailGrp := adminGrp.Group("/mail")
 
+	// admin/db
+	dbGrp := adminGrp.Group("/db")
+
+	// admin/config
+	configGrp := adminGrp.Group("/config")
+
 	// add handlers
 	authHandler.AddHandler(authGrp)
 	mailHandler.AddHandler(mailGrp)
+	backupHandler.AddHandler(dbGrp)
+	configHandler.AddHandler(configGrp)
 	userHandler.AddHandler(userGrp, adminGrp, authHandler.AddUserClaim(), authHandler.VerifyValidAccount())
 
+	// docs, registered last so the document lists every route
+	s.srv.GET(docsPath, openapi.UIHandler)
+	s.srv.GET(redocPath, openapi.RedocHandler)
+	if !openapi.RedocEmbedded() {
+		s.logger.Warn("redoc bundle is not vendored, the docs page cannot render, run make redoc", "version", openapi.RedocVersion)
+	}
+	var spec echo.HandlerFunc
+	s.srv.GET(openAPIPath, func(c echo.Context) error {
+		return spec(c)
+	})
+
+	doc, missing := s.openAPI()
+	for _, r := range missing {
+		s.logger.Warn("route missing from the openapi document", "method", r.method, "path", r.path)
+	}
+	spec, err := openapi.Handler(doc)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-func (s *DefaultServer) Start(add string, port int) {
-	s.logger.Error("server crashed",
-		slog.String(
-			"err",
-			s.srv.Start(fmt.Sprintf("%s:%d", add, port)).Error(),
-		),
-	)
+// Start blocks until the server fails or Shutdown is called, in which case it returns nil
+func (s *DefaultServer) Start(add string, port int) error {
+	addr := fmt.Sprintf("%s:%d", add, port)
+	if s.tlsConfig == nil {
+		return ignoreClosed(s.srv.Start(addr))
+	}
+
+	if s.redirect != nil {
+		// bind before serving so a busy port fails the start
+		l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", add, s.redirectPort))
+		if err != nil {
+			return fmt.Errorf("failed to start redirect listener > %w", err)
+		}
+
+		s.tlsPort = port
+		go func() {
+			if err := ignoreClosed(s.redirect.Serve(l)); err != nil {
+				s.logger.Error("redirect listener stopped", "err", err.Error())
+			}
+		}()
+	}
+
+	s.srv.TLSServer.Addr = addr
+	s.srv.TLSServer.TLSConfig = s.tlsConfig
+	return ignoreClosed(s.srv.StartServer(s.srv.TLSServer))
+}
+
+// redirectHost replaces the port of the request host with the TLS port
+func (s *DefaultServer) redirectHost(r *nethttp.Request) string {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	return net.JoinHostPort(host, strconv.Itoa(s.tlsPort))
+}
+
+func ignoreClosed(err error) error {
+	if errors.Is(err, nethttp.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests until ctx is done
+func (s *DefaultServer) Shutdown(ctx context.Context) error {
+	if s.redirect != nil {
+		if err := s.redirect.Shutdown(ctx); err != nil {
+			return fmt.Errorf("failed to shutdown redirect listener > %w", err)
+		}
+	}
+	return s.srv.Shutdown(ctx)
 }
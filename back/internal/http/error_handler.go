@@ -0,0 +1,74 @@
+package http
+
+import (
+	"log/slog"
+	nethttp "net/http"
+	"strings"
+
+	"github.com/pzolo85/todo-app/back/internal/apperr"
+	"github.com/pzolo85/todo-app/back/internal/log"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ErrorHandler renders every error as problem+json. Typed errors from apperr
+// keep their code and message, echo errors get a code from their status, and
+// anything else is logged and hidden behind a generic internal error.
+func ErrorHandler(logger *slog.Logger) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if c.Response().Committed {
+			return
+		}
+
+		p := toProblem(err)
+		p.Instance = c.Request().URL.Path
+		p.RequestID = c.Response().Header().Get(echo.HeaderXRequestID)
+
+		l := log.FromContext(c, logger, "")
+		if p.Status >= nethttp.StatusInternalServerError {
+			l.Error("request failed", "err", err.Error())
+		} else {
+			l.Debug("request rejected", "err", err.Error())
+		}
+
+		if c.Request().Method == nethttp.MethodHead {
+			err = c.NoContent(p.Status)
+		} else {
+			c.Response().Header().Set(echo.HeaderContentType, apperr.ContentType)
+			err = c.JSON(p.Status, p)
+		}
+		if err != nil {
+			l.Error("failed to write error response", "err", err.Error())
+		}
+	}
+}
+
+func toProblem(err error) *apperr.Problem {
+	if e, ok := apperr.As(err); ok {
+		return &apperr.Problem{
+			Type:   apperr.TypeURI(e.Code),
+			Title:  nethttp.StatusText(e.Status()),
+			Status: e.Status(),
+			Detail: e.Message,
+			Code:   e.Code,
+			Errors: e.Fields,
+		}
+	}
+
+	if he, ok := err.(*echo.HTTPError); ok {
+		code := strings.ReplaceAll(strings.ToLower(nethttp.StatusText(he.Code)), " ", "_")
+		p := &apperr.Problem{
+			Type:   apperr.TypeURI(code),
+			Title:  nethttp.StatusText(he.Code),
+			Status: he.Code,
+			Code:   code,
+		}
+		// only plain messages are shown, wrapped errors may leak internals
+		if msg, ok := he.Message.(string); ok && msg != p.Title {
+			p.Detail = msg
+		}
+		return p
+	}
+
+	return toProblem(apperr.Internal(err))
+}
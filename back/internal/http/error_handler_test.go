@@ -0,0 +1,94 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	nethttp "net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pzolo85/todo-app/back/internal/apperr"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorHandler(t *testing.T) {
+	notFound := apperr.NotFound("item_not_found", "item not found")
+
+	tests := []struct {
+		name string
+		err  error
+		want apperr.Problem
+	}{
+		{
+			name: "typed error keeps code and message",
+			err:  fmt.Errorf("failed to get item > %w", notFound.Wrap(errors.New("bucket missing"))),
+			want: apperr.Problem{
+				Type:   "urn:todo-app:problem:item_not_found",
+				Title:  "Not Found",
+				Status: nethttp.StatusNotFound,
+				Detail: "item not found",
+				Code:   "item_not_found",
+			},
+		},
+		{
+			name: "validation errors list the fields",
+			err:  apperr.Validation(apperr.FieldError{Field: "email", Code: "required", Message: "email is required"}),
+			want: apperr.Problem{
+				Type:   "urn:todo-app:problem:validation_failed",
+				Title:  "Unprocessable Entity",
+				Status: nethttp.StatusUnprocessableEntity,
+				Detail: "request validation failed",
+				Code:   "validation_failed",
+				Errors: []apperr.FieldError{{Field: "email", Code: "required", Message: "email is required"}},
+			},
+		},
+		{
+			name: "echo errors get a code from the status",
+			err:  echo.NewHTTPError(nethttp.StatusUnauthorized, "client certificate required"),
+			want: apperr.Problem{
+				Type:   "urn:todo-app:problem:unauthorized",
+				Title:  "Unauthorized",
+				Status: nethttp.StatusUnauthorized,
+				Detail: "client certificate required",
+				Code:   "unauthorized",
+			},
+		},
+		{
+			name: "other errors are hidden",
+			err:  errors.New("failed to open db > permission denied"),
+			want: apperr.Problem{
+				Type:   "urn:todo-app:problem:internal_error",
+				Title:  "Internal Server Error",
+				Status: nethttp.StatusInternalServerError,
+				Detail: "internal error",
+				Code:   "internal_error",
+			},
+		},
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = ErrorHandler(slog.Default())
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(nethttp.MethodGet, "/api/v1/items/1", nil), rec)
+			c.Response().Header().Set(echo.HeaderXRequestID, "abc-123")
+
+			e.HTTPErrorHandler(tt.err, c)
+
+			assert.Equal(t, tt.want.Status, rec.Code)
+			assert.Equal(t, apperr.ContentType, rec.Header().Get(echo.HeaderContentType))
+
+			var got apperr.Problem
+			assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			tt.want.Instance = "/api/v1/items/1"
+			tt.want.RequestID = "abc-123"
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package http
+
+import (
+	nethttp "net/http"
+	"strconv"
+
+	"github.com/pzolo85/todo-app/back/internal/apperr"
+	"github.com/pzolo85/todo-app/back/internal/auth"
+	"github.com/pzolo85/todo-app/back/internal/config"
+	"github.com/pzolo85/todo-app/back/internal/health"
+	"github.com/pzolo85/todo-app/back/internal/mail"
+	"github.com/pzolo85/todo-app/back/internal/openapi"
+	"github.com/pzolo85/todo-app/back/internal/user"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	openAPIPath = "/api/v1/openapi.json"
+	docsPath    = "/api/v1/docs"
+	redocPath   = "/api/v1/redoc.standalone.js"
+)
+
+type route struct {
+	method string
+	path   string
+}
+
+var (
+	userToken  = []map[string][]string{{"token": {}}}
+	adminToken = userToken
+)
+
+// operations documents every route of the server, a route missing here is
+// left out of the document and reported by LoadRoutes
+func operations(d *openapi.Document) map[route]*openapi.Operation {
+	problem := func(op *openapi.Operation, statuses ...int) *openapi.Operation {
+		for _, status := range statuses {
+			op.Responses[strconv.Itoa(status)] = openapi.Content(nethttp.StatusText(status), apperr.ContentType, d.SchemaOf(apperr.Problem{}))
+		}
+		return op
+	}
+	json := func(v any) *openapi.RequestBody {
+		return openapi.Body(echo.MIMEApplicationJSON, d.SchemaOf(v))
+	}
+	ok := func(description string, v any) map[string]*openapi.Response {
+		if v == nil {
+			return map[string]*openapi.Response{"200": openapi.Content(description, "", nil)}
+		}
+		return map[string]*openapi.Response{"200": openapi.Content(description, echo.MIMEApplicationJSON, d.SchemaOf(v))}
+	}
+	admin := func(summary string, req any, res any) *openapi.Operation {
+		op := &openapi.Operation{Summary: summary, Tags: []string{"admin"}, Security: adminToken, Responses: ok("done", res)}
+		if req != nil {
+			op.RequestBody = json(req)
+			problem(op, nethttp.StatusUnprocessableEntity)
+		}
+		return problem(op, nethttp.StatusUnauthorized, nethttp.StatusForbidden, nethttp.StatusNotFound)
+	}
+	listID := openapi.Parameter{Name: "id", In: "path", Required: true, Schema: openapi.String()}
+
+	return map[route]*openapi.Operation{
+		// probes
+		{nethttp.MethodGet, "/healthz"}: {
+			Summary: "Liveness probe", Tags: []string{"probes"},
+			Responses: ok("the process is alive", health.Report{}),
+		},
+		{nethttp.MethodGet, "/readyz"}: {
+			Summary: "Readiness probe with the result of every check", Tags: []string{"probes"},
+			Responses: map[string]*openapi.Response{
+				"200": openapi.Content("ready", echo.MIMEApplicationJSON, d.SchemaOf(health.Report{})),
+				"503": openapi.Content("a check failed", echo.MIMEApplicationJSON, d.SchemaOf(health.Report{})),
+			},
+		},
+		{nethttp.MethodGet, "/version"}: {
+			Summary: "Build information", Tags: []string{"probes"},
+			Responses: ok("build information", health.Version{}),
+		},
+		{nethttp.MethodGet, "/metrics"}: problem(&openapi.Operation{
+			Summary: "Prometheus metrics", Tags: []string{"probes"},
+			Security:  []map[string][]string{{"metricsToken": {}}},
+			Responses: map[string]*openapi.Response{"200": openapi.Content("metrics in text format", "text/plain", openapi.String())},
+		}, nethttp.StatusUnauthorized),
+
+		// docs
+		{nethttp.MethodGet, openAPIPath}: {
+			Summary: "This document", Tags: []string{"docs"},
+			Responses: map[string]*openapi.Response{"200": openapi.Content("OpenAPI document", echo.MIMEApplicationJSON, &openapi.Schema{Type: "object"})},
+		},
+		{nethttp.MethodGet, docsPath}: {
+			Summary: "API reference rendered by Redoc", Tags: []string{"docs"},
+			Responses: map[string]*openapi.Response{"200": openapi.Content("html page", echo.MIMETextHTML, openapi.String())},
+		},
+		{nethttp.MethodGet, redocPath}: {
+			Summary: "Redoc bundle loaded by the API reference", Tags: []string{"docs"},
+			Responses: map[string]*openapi.Response{
+				"200": openapi.Content("javascript bundle", "text/javascript", openapi.String()),
+				"302": {Description: "redirect to the Redoc CDN when the bundle is not vendored"},
+			},
+		},
+
+		// auth
+		{nethttp.MethodPost, "/api/v1/auth/login"}: problem(&openapi.Operation{
+			Summary: "Log in and get a token for the x-auth-token header", Tags: []string{"auth"},
+			RequestBody: json(auth.LoginRequest{}),
+			Responses:   ok("logged in", auth.LoginResponse{}),
+		}, nethttp.StatusUnauthorized, nethttp.StatusUnprocessableEntity),
+
+		// user
+		{nethttp.MethodPost, "/api/v1/user/create"}: problem(&openapi.Operation{
+			Summary: "Sign up, a challenge is sent to the email address", Tags: []string{"user"},
+			RequestBody: json(user.UserCreateRequest{}),
+			Responses:   ok("user created", user.User{}),
+		}, nethttp.StatusConflict, nethttp.StatusUnprocessableEntity),
+		{nethttp.MethodGet, "/api/v1/user/validate"}: problem(&openapi.Operation{
+			Summary: "Verify the email address with the challenge sent to it", Tags: []string{"user"},
+			Parameters: d.QueryParams(user.ValidateUserRequest{}),
+			Responses:  ok("email verified", nil),
+		}, nethttp.StatusBadRequest, nethttp.StatusNotFound, nethttp.StatusUnprocessableEntity),
+		{nethttp.MethodGet, "/api/v1/user/info"}: problem(&openapi.Operation{
+			Summary: "Current user", Tags: []string{"user"}, Security: userToken,
+			Responses: ok("current user", user.User{}),
+		}, nethttp.StatusUnauthorized, nethttp.StatusForbidden),
+		{nethttp.MethodGet, "/api/v1/user/resend-challenge"}: problem(&openapi.Operation{
+			Summary: "Send a new email challenge", Tags: []string{"user"}, Security: userToken,
+			Responses: ok("challenge sent", nil),
+		}, nethttp.StatusUnauthorized),
+		{nethttp.MethodDelete, "/api/v1/user/"}: problem(&openapi.Operation{
+			Summary: "Delete the account after the grace period, logging in cancels it", Tags: []string{"user"}, Security: userToken,
+			Parameters: []openapi.Parameter{{Name: "confirm", In: "query", Required: true, Schema: &openapi.Schema{Type: "string", Enum: []string{"true"}}}},
+			Responses: map[string]*openapi.Response{
+				"202": openapi.Content("account marked for deletion", echo.MIMEApplicationJSON, d.SchemaOf(user.DeleteUserResponse{})),
+			},
+		}, nethttp.StatusBadRequest, nethttp.StatusUnauthorized),
+		{nethttp.MethodGet, "/api/v1/user/export"}: problem(&openapi.Operation{
+			Summary: "Export the account data, large accounts get a download link by mail", Tags: []string{"user"}, Security: userToken,
+			Responses: map[string]*openapi.Response{
+				"200": openapi.Content("zip archive", "application/zip", openapi.Binary()),
+				"202": openapi.Content("archive is being built", echo.MIMEApplicationJSON, d.SchemaOf(user.ExportResponse{})),
+			},
+		}, nethttp.StatusUnauthorized, nethttp.StatusForbidden),
+		{nethttp.MethodGet, "/api/v1/user/export/:id"}: problem(&openapi.Operation{
+			Summary: "Download an export built in the background", Tags: []string{"user"}, Security: userToken,
+			Parameters: []openapi.Parameter{{Name: "id", In: "path", Required: true, Schema: openapi.String()}},
+			Responses: map[string]*openapi.Response{
+				"200": openapi.Content("zip archive", "application/zip", openapi.Binary()),
+			},
+		}, nethttp.StatusUnauthorized, nethttp.StatusForbidden, nethttp.StatusNotFound),
+		{nethttp.MethodGet, "/api/v1/user/lists"}: problem(&openapi.Operation{
+			Summary: "Lists of the current user, then the lists shared with it", Tags: []string{"lists"}, Security: userToken,
+			Responses: ok("lists", user.ListsResponse{}),
+		}, nethttp.StatusUnauthorized, nethttp.StatusForbidden),
+		{nethttp.MethodPost, "/api/v1/user/lists"}: problem(&openapi.Operation{
+			Summary: "Create a list", Tags: []string{"lists"}, Security: userToken,
+			RequestBody: json(user.CreateListRequest{}),
+			Responses: map[string]*openapi.Response{
+				"201": openapi.Content("list created", echo.MIMEApplicationJSON, d.SchemaOf(user.List{})),
+			},
+		}, nethttp.StatusUnauthorized, nethttp.StatusForbidden, nethttp.StatusUnprocessableEntity),
+		{nethttp.MethodGet, "/api/v1/user/lists/:id"}: problem(&openapi.Operation{
+			Summary: "A list owned by or shared with the current user", Tags: []string{"lists"}, Security: userToken,
+			Parameters: []openapi.Parameter{listID},
+			Responses:  ok("list", user.List{}),
+		}, nethttp.StatusUnauthorized, nethttp.StatusForbidden, nethttp.StatusNotFound),
+		{nethttp.MethodPost, "/api/v1/user/lists/:id/items"}: problem(&openapi.Operation{
+			Summary: "Add an item to a list", Tags: []string{"lists"}, Security: userToken,
+			Parameters:  []openapi.Parameter{listID},
+			RequestBody: json(user.AddItemRequest{}),
+			Responses: map[string]*openapi.Response{
+				"201": openapi.Content("item added", echo.MIMEApplicationJSON, d.SchemaOf(user.List{})),
+			},
+		}, nethttp.StatusUnauthorized, nethttp.StatusForbidden, nethttp.StatusNotFound, nethttp.StatusUnprocessableEntity),
+		{nethttp.MethodPut, "/api/v1/user/lists/:id/items/:item"}: problem(&openapi.Operation{
+			Summary: "Check off an item, or uncheck it", Tags: []string{"lists"}, Security: userToken,
+			Parameters:  []openapi.Parameter{listID, {Name: "item", In: "path", Required: true, Schema: openapi.String()}},
+			RequestBody: json(user.CheckItemRequest{}),
+			Responses:   ok("item updated", user.List{}),
+		}, nethttp.StatusUnauthorized, nethttp.StatusForbidden, nethttp.StatusNotFound, nethttp.StatusUnprocessableEntity),
+		{nethttp.MethodPut, "/api/v1/user/lists/:id/share"}: problem(&openapi.Operation{
+			Summary: "Share a list with another user, only the owner can share it", Tags: []string{"lists"}, Security: userToken,
+			Parameters:  []openapi.Parameter{listID},
+			RequestBody: json(user.ShareListRequest{}),
+			Responses:   ok("list shared", user.List{}),
+		}, nethttp.StatusBadRequest, nethttp.StatusUnauthorized, nethttp.StatusForbidden, nethttp.StatusNotFound, nethttp.StatusUnprocessableEntity),
+
+		// admin
+		{nethttp.MethodPut, "/api/v1/admin/user/disable"}:         admin("Mark the email address of a user as not verified", user.ModifyUserRequest{}, nil),
+		{nethttp.MethodPut, "/api/v1/admin/user/make-admin"}:      admin("Give a user the admin role", user.ModifyUserRequest{}, nil),
+		{nethttp.MethodPut, "/api/v1/admin/user/disable-admin"}:   admin("Give an admin the user role", user.ModifyUserRequest{}, nil),
+		{nethttp.MethodGet, "/api/v1/admin/user/duplicates"}:      admin("Accounts that share a canonical email address", nil, user.DuplicatesResponse{}),
+		{nethttp.MethodPost, "/api/v1/admin/user/merge"}:          problem(admin("Merge accounts that share a canonical email address", user.MergeUsersRequest{}, user.User{}), nethttp.StatusBadRequest, nethttp.StatusConflict),
+		{nethttp.MethodGet, "/api/v1/admin/user/list"}:            admin("Every user, without credentials", nil, user.ListUsersResponse{}),
+		{nethttp.MethodPost, "/api/v1/admin/user/create"}:         problem(admin("Create a user without the email challenge", user.AdminCreateUserRequest{}, user.Summary{}), nethttp.StatusConflict),
+		{nethttp.MethodPut, "/api/v1/admin/user/suspend"}:         admin("Block the login of a user and revoke its sessions", user.ModifyUserRequest{}, nil),
+		{nethttp.MethodPut, "/api/v1/admin/user/resume"}:          admin("Lift the suspension of a user", user.ModifyUserRequest{}, nil),
+		{nethttp.MethodPut, "/api/v1/admin/user/password"}:        admin("Replace the password of a user and revoke its sessions", user.SetPasswordRequest{}, nil),
+		{nethttp.MethodPut, "/api/v1/admin/user/revoke-sessions"}: admin("Revoke every session of a user", user.ModifyUserRequest{}, user.RevokeSessionsResponse{}),
+		{nethttp.MethodGet, "/api/v1/admin/mail/list"}:            admin("Mails sent and challenges waiting verification", nil, mail.Mails{}),
+		{nethttp.MethodPost, "/api/v1/admin/config/reload"}:       problem(admin("Reload the runtime config, as on SIGHUP", nil, config.Runtime{}), nethttp.StatusBadRequest, nethttp.StatusUnprocessableEntity),
+		{nethttp.MethodGet, "/api/v1/admin/db/backup"}: problem(&openapi.Operation{
+			Summary: "Stream a consistent backup of the database", Tags: []string{"admin"}, Security: adminToken,
+			Responses: map[string]*openapi.Response{"200": openapi.Content("gzip archive", "application/gzip", openapi.Binary())},
+		}, nethttp.StatusUnauthorized, nethttp.StatusForbidden),
+	}
+}
+
+// openAPI documents the routes registered on the server, and returns the ones
+// that have no entry in operations
+func (s *DefaultServer) openAPI() (*openapi.Document, []route) {
+	d := openapi.New(openapi.Info{
+		Title:       "todo-app",
+		Description: "Backend of a web app for creating and sharing To-Do lists. Errors are returned as application/problem+json (RFC 7807).",
+		Version:     health.ReadVersion().Version,
+	})
+	d.Components.SecuritySchemes["token"] = &openapi.SecurityScheme{
+		Type: "apiKey", In: "header", Name: auth.AuthHeader,
+		Description: "token returned by /api/v1/auth/login, or an admin token signed with the CLI",
+	}
+	d.Components.SecuritySchemes["metricsToken"] = &openapi.SecurityScheme{Type: "http", Scheme: "bearer"}
+
+	ops := operations(d)
+	var missing []route
+	for _, r := range s.srv.Routes() {
+		if r.Method == echo.RouteNotFound {
+			continue
+		}
+		op, ok := ops[route{r.Method, r.Path}]
+		if !ok {
+			missing = append(missing, route{r.Method, r.Path})
+			continue
+		}
+		d.Add(r.Method, r.Path, op)
+	}
+	return d, missing
+}
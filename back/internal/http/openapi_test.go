@@ -0,0 +1,92 @@
+package http
+
+import (
+	"encoding/json"
+	"log/slog"
+	nethttp "net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pzolo85/todo-app/back/internal/auth"
+	"github.com/pzolo85/todo-app/back/internal/backup"
+	"github.com/pzolo85/todo-app/back/internal/config"
+	"github.com/pzolo85/todo-app/back/internal/emailaddr"
+	"github.com/pzolo85/todo-app/back/internal/health"
+	"github.com/pzolo85/todo-app/back/internal/mail"
+	"github.com/pzolo85/todo-app/back/internal/openapi"
+	"github.com/pzolo85/todo-app/back/internal/user"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer registers every route, the handlers are never called
+func newTestServer(t *testing.T) *DefaultServer {
+	logger := slog.Default()
+	s := GetDefaultServer(echo.New(), logger, "admin", emailaddr.Default)
+	s.EnableMetrics("", false)
+
+	err := s.LoadRoutes(
+		auth.NewDefaultHandler(nil, logger, nil, emailaddr.Default),
+		mail.NewDefaultHandler(nil, &config.Config{}, logger),
+		user.NewDefaultHandler(nil, logger, nil, "admin", "user", nil, 0, 0, emailaddr.Default),
+		backup.NewDefaultHandler(nil, logger),
+		health.NewDefaultHandler(logger),
+		config.NewDefaultHandler(nil, logger),
+	)
+	assert.Nil(t, err)
+	return s
+}
+
+func TestOpenAPI_EveryRouteDocumented(t *testing.T) {
+	s := newTestServer(t)
+
+	doc, missing := s.openAPI()
+	assert.Empty(t, missing, "add the routes to operations in openapi.go")
+
+	// and nothing documented that is not served
+	for r := range operations(openapi.New(openapi.Info{})) {
+		_, ok := doc.Operation(r.method, r.path)
+		assert.True(t, ok, "%s %s is documented but not served", r.method, r.path)
+	}
+}
+
+func TestOpenAPI_Served(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := httptest.NewRecorder()
+	s.srv.ServeHTTP(rec, httptest.NewRequest(nethttp.MethodGet, openAPIPath, nil))
+	assert.Equal(t, nethttp.StatusOK, rec.Code)
+
+	var doc openapi.Document
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, openapi.Version, doc.OpenAPI)
+
+	op, ok := doc.Operation(nethttp.MethodPost, "/api/v1/auth/login")
+	assert.True(t, ok)
+	assert.Equal(t, "#/components/schemas/auth.LoginRequest", op.RequestBody.Content[echo.MIMEApplicationJSON].Schema.Ref)
+
+	login := doc.Components.Schemas["auth.LoginRequest"]
+	assert.Equal(t, []string{"email", "hash"}, login.Required)
+	assert.Equal(t, "email", login.Properties["email"].Format)
+	assert.Equal(t, 254, *login.Properties["email"].MaxLength)
+
+	_, ok = doc.Operation(nethttp.MethodGet, "/api/v1/user/export/{id}")
+	assert.True(t, ok)
+
+	rec = httptest.NewRecorder()
+	s.srv.ServeHTTP(rec, httptest.NewRequest(nethttp.MethodGet, docsPath, nil))
+	assert.Equal(t, nethttp.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `spec-url="openapi.json"`)
+	assert.NotContains(t, rec.Body.String(), "https://")
+
+	rec = httptest.NewRecorder()
+	s.srv.ServeHTTP(rec, httptest.NewRequest(nethttp.MethodGet, redocPath, nil))
+	// a missing bundle fails TestRedocEmbedded in internal/openapi
+	if openapi.RedocEmbedded() {
+		assert.Equal(t, nethttp.StatusOK, rec.Code)
+	} else {
+		assert.Equal(t, nethttp.StatusNotFound, rec.Code)
+	}
+	assert.Empty(t, rec.Header().Get(echo.HeaderLocation))
+}
@@ -6,16 +6,25 @@ import (
 	"strings"
 )
 
-func NewDefaultService(level string, appID string, hostname string) *slog.Logger {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: stringToLevel(level),
-	}))
+// level is shared by every logger, so it can be changed while running
+var level = new(slog.LevelVar)
+
+func NewDefaultService(lvl string, appID string, hostname string) *slog.Logger {
+	SetLevel(lvl)
+	logger := slog.New(NewTraceHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level: level,
+	})))
 	return logger.With(
 		slog.String("app_id", appID),
 		slog.String("hostname", hostname),
 	)
 }
 
+// SetLevel changes the level of every logger, unknown levels are treated as info
+func SetLevel(lvl string) {
+	level.Set(stringToLevel(lvl))
+}
+
 func stringToLevel(s string) slog.Level {
 	var levelToInt = map[string]slog.Level{
 		"debug": slog.LevelDebug,
@@ -0,0 +1,126 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	contextKey      = "request_logger"
+	maxRequestIDLen = 128
+)
+
+type ctxKey struct{}
+
+// Middleware assigns every request an id, taken from the X-Request-ID header
+// when it is valid, stores a logger with the request attributes in the echo
+// context and the request context, and writes one access log line when the
+// request is done.
+func Middleware(logger *slog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			req := c.Request()
+
+			id := req.Header.Get(echo.HeaderXRequestID)
+			if !validRequestID(id) {
+				id = uuid.NewString()
+			}
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+
+			attrs := []any{
+				slog.String("request_id", id),
+				slog.String("method", req.Method),
+				slog.String("route", c.Path()),
+			}
+			if sc := trace.SpanContextFromContext(req.Context()); sc.IsValid() {
+				attrs = append(attrs,
+					slog.String("trace_id", sc.TraceID().String()),
+					slog.String("span_id", sc.SpanID().String()),
+				)
+			}
+			setLogger(c, logger.With(attrs...))
+
+			err := next(c)
+
+			if err != nil {
+				// render the error now to see the final status, the error
+				// handler skips responses that are already committed
+				c.Error(err)
+			}
+			status := c.Response().Status
+
+			level := slog.LevelInfo
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+
+			FromContext(c, logger, "").LogAttrs(req.Context(), level, "request",
+				slog.String("uri", req.RequestURI),
+				slog.Int("status", status),
+				slog.Duration("latency", time.Since(start)),
+				slog.Int64("bytes_out", c.Response().Size),
+				slog.String("real_ip", c.RealIP()),
+				slog.String("user_agent", req.UserAgent()),
+			)
+			return err
+		}
+	}
+}
+
+// FromContext returns the request logger of c in group, or fallback when c has none
+func FromContext(c echo.Context, fallback *slog.Logger, group string) *slog.Logger {
+	logger, ok := c.Get(contextKey).(*slog.Logger)
+	if !ok {
+		return fallback
+	}
+	if group == "" {
+		return logger
+	}
+	return logger.WithGroup(group)
+}
+
+// AddAttrs adds args to the request logger of c, for the rest of the request
+func AddAttrs(c echo.Context, args ...any) {
+	if logger, ok := c.Get(contextKey).(*slog.Logger); ok {
+		setLogger(c, logger.With(args...))
+	}
+}
+
+// setLogger stores the request logger in c and in its request, for the
+// services that only get the context
+func setLogger(c echo.Context, logger *slog.Logger) {
+	c.Set(contextKey, logger)
+	c.SetRequest(c.Request().WithContext(context.WithValue(c.Request().Context(), ctxKey{}, logger)))
+}
+
+// FromCtx returns the request logger of ctx in group, or fallback when ctx
+// has none, as for the background jobs
+func FromCtx(ctx context.Context, fallback *slog.Logger, group string) *slog.Logger {
+	logger, ok := ctx.Value(ctxKey{}).(*slog.Logger)
+	if !ok {
+		return fallback
+	}
+	if group == "" {
+		return logger
+	}
+	return logger.WithGroup(group)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, r := range id {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
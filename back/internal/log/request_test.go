@@ -0,0 +1,78 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	e := echo.New()
+	e.Use(Middleware(slog.New(slog.NewJSONHandler(&buf, nil))))
+	e.GET("/items/:id", func(c echo.Context) error {
+		AddAttrs(c, "email", "jon@test.com")
+		FromContext(c, nil, "items_handler").Info("item read", "id", c.Param("id"))
+		// services only get the request context
+		FromCtx(c.Request().Context(), nil, "").Info("mail sent")
+		return c.NoContent(http.StatusOK)
+	})
+
+	serve := func(requestID string) (string, []map[string]any) {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/items/1", nil)
+		req.Header.Set(echo.HeaderXRequestID, requestID)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		lines := []map[string]any{}
+		for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var line map[string]any
+			assert.Nil(t, json.Unmarshal([]byte(l), &line))
+			lines = append(lines, line)
+		}
+		return rec.Header().Get(echo.HeaderXRequestID), lines
+	}
+
+	t.Run("propagates the request id", func(t *testing.T) {
+		id, lines := serve("abc-123")
+		assert.Equal(t, "abc-123", id)
+		assert.Len(t, lines, 3)
+
+		assert.Equal(t, "item read", lines[0]["msg"])
+		assert.Equal(t, "abc-123", lines[0]["request_id"])
+		assert.Equal(t, "/items/:id", lines[0]["route"])
+		assert.Equal(t, map[string]any{"id": "1"}, lines[0]["items_handler"])
+
+		assert.Equal(t, "mail sent", lines[1]["msg"])
+		assert.Equal(t, "abc-123", lines[1]["request_id"])
+		assert.Equal(t, "jon@test.com", lines[1]["email"])
+
+		assert.Equal(t, "request", lines[2]["msg"])
+		assert.Equal(t, "abc-123", lines[2]["request_id"])
+		assert.Equal(t, "jon@test.com", lines[2]["email"])
+		assert.Equal(t, float64(http.StatusOK), lines[2]["status"])
+	})
+
+	t.Run("replaces invalid request ids", func(t *testing.T) {
+		for _, requestID := range []string{"", "has space", strings.Repeat("a", maxRequestIDLen+1)} {
+			id, lines := serve(requestID)
+			assert.NotEqual(t, requestID, id)
+			assert.Len(t, id, 36)
+			assert.Equal(t, id, lines[2]["request_id"])
+		}
+	})
+}
+
+func TestFromCtx(t *testing.T) {
+	fallback := slog.Default()
+	assert.Same(t, fallback, FromCtx(context.Background(), fallback, "mail"))
+}
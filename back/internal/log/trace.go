@@ -0,0 +1,65 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceHandler adds the trace_id and span_id of the span in the context of a
+// record, so the logs of the services match their spans. They are added at the
+// top level, before the attrs and groups of the logger, unless the logger
+// already carries them, as the request logger does.
+type TraceHandler struct {
+	slog.Handler
+	// root is the wrapped handler without the attrs and groups of the logger,
+	// they are replayed by ops on top of the trace attrs
+	root     slog.Handler
+	ops      []func(slog.Handler) slog.Handler
+	grouped  bool
+	hasTrace bool
+}
+
+func NewTraceHandler(h slog.Handler) *TraceHandler {
+	return &TraceHandler{Handler: h, root: h}
+}
+
+func (h *TraceHandler) Handle(ctx context.Context, r slog.Record) error {
+	sc := trace.SpanContextFromContext(ctx)
+	if h.hasTrace || !sc.IsValid() {
+		return h.Handler.Handle(ctx, r)
+	}
+
+	withTrace := h.root.WithAttrs([]slog.Attr{
+		slog.String("trace_id", sc.TraceID().String()),
+		slog.String("span_id", sc.SpanID().String()),
+	})
+	for _, op := range h.ops {
+		withTrace = op(withTrace)
+	}
+	return withTrace.Handle(ctx, r)
+}
+
+func (h *TraceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := h.with(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+	for _, a := range attrs {
+		if a.Key == "trace_id" && !h.grouped {
+			c.hasTrace = true
+		}
+	}
+	return c
+}
+
+func (h *TraceHandler) WithGroup(name string) slog.Handler {
+	c := h.with(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+	c.grouped = true
+	return c
+}
+
+func (h *TraceHandler) with(op func(slog.Handler) slog.Handler) *TraceHandler {
+	c := *h
+	c.Handler = op(h.Handler)
+	c.ops = append(h.ops[:len(h.ops):len(h.ops)], op)
+	return &c
+}
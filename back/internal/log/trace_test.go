@@ -0,0 +1,53 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewTraceHandler(slog.NewJSONHandler(&buf, nil)))
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{2},
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	logLine := func(l *slog.Logger, ctx context.Context) map[string]any {
+		buf.Reset()
+		l.InfoContext(ctx, "msg", "id", 1)
+
+		var line map[string]any
+		assert.Nil(t, json.Unmarshal(buf.Bytes(), &line))
+		return line
+	}
+
+	t.Run("adds the span of the context", func(t *testing.T) {
+		line := logLine(logger.With("app_id", "app").WithGroup("mail"), ctx)
+		assert.Equal(t, sc.TraceID().String(), line["trace_id"])
+		assert.Equal(t, sc.SpanID().String(), line["span_id"])
+		assert.Equal(t, "app", line["app_id"])
+		assert.Equal(t, map[string]any{"id": float64(1)}, line["mail"])
+	})
+
+	t.Run("without span", func(t *testing.T) {
+		line := logLine(logger, context.Background())
+		assert.NotContains(t, line, "trace_id")
+		assert.NotContains(t, line, "span_id")
+	})
+
+	t.Run("logger with a trace", func(t *testing.T) {
+		buf.Reset()
+		logger.With("trace_id", "request").WithGroup("user").InfoContext(ctx, "msg")
+		assert.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("trace_id")))
+		assert.Contains(t, buf.String(), `"trace_id":"request"`)
+	})
+}
@@ -2,25 +2,34 @@ package mail
 
 import (
 	"fmt"
+	"log/slog"
 	"net/http"
 
 	"github.com/pzolo85/todo-app/back/internal/config"
+	"github.com/pzolo85/todo-app/back/internal/log"
 
 	"github.com/labstack/echo/v4"
 )
 
 type DefaultHandler struct {
-	svc Service
-	cfg *config.Config
+	svc    Service
+	cfg    *config.Config
+	logger *slog.Logger
 }
 
-func NewDefaultHandler(svc Service, cfg *config.Config) *DefaultHandler {
+func NewDefaultHandler(svc Service, cfg *config.Config, logger *slog.Logger) *DefaultHandler {
 	return &DefaultHandler{
-		svc: svc,
-		cfg: cfg,
+		svc:    svc,
+		cfg:    cfg,
+		logger: logger.WithGroup("mail_handler"),
 	}
 }
 
+// requestLogger returns the request logger, see log.Middleware
+func (h *DefaultHandler) requestLogger(c echo.Context) *slog.Logger {
+	return log.FromContext(c, h.logger, "mail_handler")
+}
+
 type Mails struct {
 	Mails []Mail `json:"mails"`
 }
@@ -41,10 +50,13 @@ func (h *DefaultHandler) List(c echo.Context) error {
 		mails = append(mails, Mail{
 			Subject: fmt.Sprintf("verify your email"),
 			To:      email,
-			Link:    fmt.Sprintf("http://%s:%d/api/v1/user/validate?email=%s&challenge=%s", h.cfg.Address, h.cfg.Port, email, challenge),
+			Link:    validateLink(h.cfg.BaseURL(), email, challenge),
 		})
 	}
 
+	mails = append(mails, h.svc.ListMails()...)
+	h.requestLogger(c).Info("mails listed", "count", len(mails))
+
 	return c.JSON(http.StatusOK, Mails{
 		Mails: mails,
 	})
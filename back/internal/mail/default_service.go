@@ -1,62 +1,111 @@
 package mail
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"net/url"
+	"sync/atomic"
 	"time"
+
 	"github.com/pzolo85/todo-app/back/internal/config"
+	"github.com/pzolo85/todo-app/back/internal/log"
+	"github.com/pzolo85/todo-app/back/internal/metrics"
+	"github.com/pzolo85/todo-app/back/internal/tracing"
 
 	"github.com/google/uuid"
 	"github.com/patrickmn/go-cache"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/pzolo85/todo-app/back/internal/mail")
+
 type DefaultService struct {
-	logger *slog.Logger
-	cache  *cache.Cache
-	config *config.Config
+	// logger is used outside of requests, see log.FromCtx
+	logger    *slog.Logger
+	cache     *cache.Cache
+	outbox    *cache.Cache
+	config    *config.Config
+	transport Transport
+	hits      atomic.Uint64
+	misses    atomic.Uint64
 }
 
-func NewDefaultService(logger *slog.Logger, cache *cache.Cache, cfg *config.Config) *DefaultService {
+func NewDefaultService(logger *slog.Logger, cache *cache.Cache, cfg *config.Config, transport Transport) *DefaultService {
 	return &DefaultService{
-		logger: logger,
-		cache:  cache,
-		config: cfg,
+		logger:    logger,
+		cache:     cache,
+		outbox:    newOutbox(),
+		config:    cfg,
+		transport: transport,
 	}
 }
 
-func (s *DefaultService) SendChallenge(email string) error {
+func newOutbox() *cache.Cache {
+	return cache.New(time.Hour*24, time.Hour)
+}
+
+// validateLink is the link that verifies email. The query is escaped, a + in
+// the address would be read as a space.
+func validateLink(baseURL string, email string, challenge string) string {
+	return baseURL + "/api/v1/user/validate?" + url.Values{"email": {email}, "challenge": {challenge}}.Encode()
+}
+
+func (s *DefaultService) SendChallenge(ctx context.Context, email string) (err error) {
+	ctx, span := tracer.Start(ctx, "mail.SendChallenge", trace.WithAttributes(attribute.String("mail.to", email)))
+	defer func() { tracing.End(span, err) }()
+
 	challenge := uuid.NewString()
-	s.logger.Info("new challenge", "email", email, "challenge", challenge, "url", fmt.Sprintf("http://%s:%d/api/v1/user/validate?email=%s&challenge=%s", s.config.Address, s.config.Port, email, challenge))
-	err := s.cache.Add(challenge, email, time.Hour*24)
+	link := validateLink(s.config.BaseURL(), email, challenge)
+	log.FromCtx(ctx, s.logger, "").InfoContext(ctx, "new challenge", "email", email, "challenge", challenge, "url", link)
+	err = s.cache.Add(challenge, email, time.Hour*24)
 	if err != nil {
 		return fmt.Errorf("failed to store challenge in cache > %w", err)
 	}
 
+	err = s.transport.Send(ctx, Mail{Subject: "verify your email", To: email, Link: link})
+	if err != nil {
+		return fmt.Errorf("failed to send challenge > %w", err)
+	}
+
+	metrics.Challenges.WithLabelValues("issued").Inc()
 	return nil
 
 }
 
-func (s *DefaultService) VerifyChallenge(email string, challenge string) error {
-	s.logger.Info("verify challenge", "email", email, "challenge", challenge)
+func (s *DefaultService) VerifyChallenge(ctx context.Context, email string, challenge string) error {
+	log.FromCtx(ctx, s.logger, "").InfoContext(ctx, "verify challenge", "email", email, "challenge", challenge)
 	cacheEmail, found := s.cache.Get(challenge)
 	if !found {
-		return fmt.Errorf("invalid challenge")
+		s.misses.Add(1)
+		metrics.Challenges.WithLabelValues("rejected").Inc()
+		return ErrInvalidChallenge
 	}
+	s.hits.Add(1)
 
 	emailString, ok := cacheEmail.(string)
 	if !ok {
 		return fmt.Errorf("corrupted value in cache > %#v", cacheEmail)
 	}
 
-	if emailString != email {
-		return fmt.Errorf("invalid challenge email")
+	if !s.config.Emails().Equal(emailString, email) {
+		metrics.Challenges.WithLabelValues("rejected").Inc()
+		return fmt.Errorf("%w: email does not match", ErrInvalidChallenge)
 	}
 
 	s.cache.Delete(challenge)
 
+	metrics.Challenges.WithLabelValues("verified").Inc()
 	return nil
 }
 
+// CacheStats returns the challenge lookups that found and missed the challenge
+func (s *DefaultService) CacheStats() (hits uint64, misses uint64) {
+	return s.hits.Load(), s.misses.Load()
+}
+
 func (s *DefaultService) ListChallenges() map[string]string {
 	m := s.cache.Items()
 	outmap := make(map[string]string, len(m))
@@ -66,3 +115,49 @@ func (s *DefaultService) ListChallenges() map[string]string {
 	}
 	return outmap
 }
+
+func (s *DefaultService) DeleteChallenges(email string) {
+	for challenge, v := range s.cache.Items() {
+		if v.Object.(string) == email {
+			s.cache.Delete(challenge)
+		}
+	}
+}
+
+func (s *DefaultService) SendExportLink(ctx context.Context, email string, exportID string) (err error) {
+	ctx, span := tracer.Start(ctx, "mail.SendExportLink", trace.WithAttributes(attribute.String("mail.to", email)))
+	defer func() { tracing.End(span, err) }()
+
+	m := Mail{
+		Subject: "your data export is ready",
+		To:      email,
+		Link:    fmt.Sprintf("%s/api/v1/user/export/%s", s.config.BaseURL(), exportID),
+	}
+	log.FromCtx(ctx, s.logger, "").InfoContext(ctx, "new export link", "email", email, "url", m.Link)
+	err = s.outbox.Add(uuid.NewString(), m, cache.DefaultExpiration)
+	if err != nil {
+		return fmt.Errorf("failed to store mail in outbox > %w", err)
+	}
+
+	err = s.transport.Send(ctx, m)
+	if err != nil {
+		return fmt.Errorf("failed to send export link > %w", err)
+	}
+
+	return nil
+}
+
+func (s *DefaultService) ListMails() []Mail {
+	m := s.outbox.Items()
+	mails := make([]Mail, 0, len(m))
+	for _, v := range m {
+		mails = append(mails, v.Object.(Mail))
+	}
+	return mails
+}
+
+// Ping checks the mail transport. The transports only log or capture the
+// mails for now, so it is always reachable.
+func (s *DefaultService) Ping() error {
+	return nil
+}
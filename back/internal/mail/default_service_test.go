@@ -0,0 +1,71 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/config"
+	"github.com/pzolo85/todo-app/back/internal/log"
+
+	"github.com/labstack/echo/v4"
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultService_RequestLogger(t *testing.T) {
+	var requestLogs, serviceLogs bytes.Buffer
+	svc := NewDefaultService(slog.New(slog.NewJSONHandler(&serviceLogs, nil)), cache.New(time.Hour, time.Hour), config.Defaults(), NewLogTransport(slog.Default()))
+
+	e := echo.New()
+	e.Use(log.Middleware(slog.New(slog.NewJSONHandler(&requestLogs, nil))))
+	e.GET("/", func(c echo.Context) error {
+		return svc.SendChallenge(c.Request().Context(), "jon@test.com")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderXRequestID, "abc-123")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Contains(t, requestLogs.String(), `"msg":"new challenge","request_id":"abc-123"`)
+	assert.Empty(t, serviceLogs.String())
+}
+
+// outbox is a Transport that keeps the last mail
+type outbox struct {
+	last Mail
+}
+
+func (o *outbox) Send(ctx context.Context, m Mail) error {
+	o.last = m
+	return nil
+}
+
+func TestDefaultService_ValidateLink(t *testing.T) {
+	ctx := context.Background()
+	transport := &outbox{}
+	cfg := config.Defaults()
+	svc := NewDefaultService(slog.Default(), cache.New(time.Hour, time.Hour), cfg, transport)
+
+	assert.Nil(t, svc.SendChallenge(ctx, "jon+news@test.com"))
+	link, err := url.Parse(transport.last.Link)
+	assert.Nil(t, err)
+	assert.Equal(t, "/api/v1/user/validate", link.Path)
+	assert.Equal(t, "jon+news@test.com", link.Query().Get("email"))
+
+	// the link listed to admins is the one mailed
+	rec := httptest.NewRecorder()
+	h := NewDefaultHandler(svc, cfg, slog.Default())
+	assert.Nil(t, h.List(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)))
+	var listed Mails
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &listed))
+	assert.Equal(t, []Mail{transport.last}, listed.Mails)
+
+	assert.Nil(t, svc.VerifyChallenge(ctx, link.Query().Get("email"), link.Query().Get("challenge")))
+}
@@ -1,7 +1,19 @@
 package mail
 
+import (
+	"context"
+
+	"github.com/pzolo85/todo-app/back/internal/apperr"
+)
+
+var ErrInvalidChallenge = apperr.BadRequest("invalid_challenge", "challenge is invalid or expired")
+
 type Service interface {
-	SendChallenge(email string) error
-	VerifyChallenge(email string, challenge string) error
+	SendChallenge(ctx context.Context, email string) error
+	VerifyChallenge(ctx context.Context, email string, challenge string) error
 	ListChallenges() map[string]string
+	DeleteChallenges(email string)
+	SendExportLink(ctx context.Context, email string, exportID string) error
+	ListMails() []Mail
+	Ping() error
 }
@@ -0,0 +1,27 @@
+package mail
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/pzolo85/todo-app/back/internal/log"
+)
+
+// Transport delivers the mails of the service
+type Transport interface {
+	Send(ctx context.Context, m Mail) error
+}
+
+// LogTransport only logs the mails, admins list them with GET /api/v1/admin/mail/list
+type LogTransport struct {
+	logger *slog.Logger
+}
+
+func NewLogTransport(logger *slog.Logger) *LogTransport {
+	return &LogTransport{logger: logger}
+}
+
+func (t *LogTransport) Send(ctx context.Context, m Mail) error {
+	log.FromCtx(ctx, t.logger, "").DebugContext(ctx, "mail sent", "to", m.To, "subject", m.Subject)
+	return nil
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Middleware records the count and latency of every request by echo route
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			if err != nil {
+				// render the error now to see the final status, the error
+				// handler skips responses that are already committed
+				c.Error(err)
+			}
+			status := c.Response().Status
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+
+			labels := []string{c.Request().Method, route, strconv.Itoa(status)}
+			httpRequests.WithLabelValues(labels...).Inc()
+			httpDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// Handler serves the registry. Requests must send the value of token as a
+// bearer token, unless public is set. Without a token nor public, every
+// request is refused.
+func Handler(token func() string, public bool) echo.HandlerFunc {
+	h := echo.WrapHandler(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+	return func(c echo.Context) error {
+		if public {
+			return h(c)
+		}
+
+		token := token()
+		if token == "" {
+			return echo.NewHTTPError(http.StatusForbidden, "metrics_token is not set")
+		}
+		got, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			return echo.NewHTTPError(http.StatusUnauthorized)
+		}
+		return h(c)
+	}
+}
@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(Middleware())
+	e.GET("/items/:id", func(c echo.Context) error {
+		if c.Param("id") == "missing" {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+		return c.NoContent(http.StatusOK)
+	})
+	token := "s3cret"
+	e.GET("/metrics", Handler(func() string { return token }, false))
+	e.GET("/public", Handler(func() string { return "" }, true))
+
+	for _, id := range []string{"1", "2", "missing"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/"+id, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/items/:id", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/items/:id", "404")))
+
+	t.Run("token required", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer s3cret")
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `todo_http_requests_total{method="GET",route="/items/:id",status="404"} 1`)
+	})
+
+	t.Run("token not set", func(t *testing.T) {
+		token = ""
+		defer func() { token = "s3cret" }()
+
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer ")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("public", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/public", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
+
+func TestCached(t *testing.T) {
+	calls := 0
+	var err error
+	gauge := Cached(time.Hour, func() (float64, error) {
+		calls++
+		return float64(calls), err
+	})
+
+	assert.Equal(t, 1.0, gauge())
+	assert.Equal(t, 1.0, gauge())
+	assert.Equal(t, 1, calls)
+
+	expired := Cached(0, func() (float64, error) {
+		calls++
+		return float64(calls), err
+	})
+	assert.Equal(t, 2.0, expired())
+
+	// a failed call keeps the last value
+	err = errors.New("db is closed")
+	assert.Equal(t, 2.0, expired())
+	assert.Equal(t, 3, calls)
+}
+
+func TestRegisterCache(t *testing.T) {
+	RegisterCache("test", func() (uint64, uint64) { return 1, 0 })
+	// registering again replaces the previous collectors
+	RegisterCache("test", func() (uint64, uint64) { return 3, 1 })
+
+	n, err := testutil.GatherAndCount(Registry, "todo_cache_hit_ratio")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+}
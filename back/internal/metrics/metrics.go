@@ -0,0 +1,142 @@
+// Package metrics collects the app metrics and serves them in the prometheus text format
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "todo"
+
+// Registry holds every metric of the app
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	httpRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	txDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_tx_duration_seconds",
+		Help:      "Duration of db transactions by type (view or update).",
+		Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+	}, []string{"type"})
+
+	// Logins counts login attempts by result (success or failure)
+	Logins = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts by result.",
+	}, []string{"result"})
+
+	// Challenges counts email challenges by event (issued, verified or rejected)
+	Challenges = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "challenges_total",
+		Help:      "Email validation challenges by event.",
+	}, []string{"event"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	// report zero before the first event
+	for _, result := range []string{"success", "failure"} {
+		Logins.WithLabelValues(result)
+	}
+	for _, event := range []string{"issued", "verified", "rejected"} {
+		Challenges.WithLabelValues(event)
+	}
+}
+
+// replace registers c, replacing the collector registered with the same
+// metric, so the services can be loaded more than once in a process
+func replace(c prometheus.Collector) {
+	Registry.Unregister(c)
+	Registry.MustRegister(c)
+}
+
+// RegisterGauge adds a gauge whose value is read from fn on every scrape
+func RegisterGauge(name string, help string, fn func() float64) {
+	replace(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, fn))
+}
+
+// Cached returns a gauge function that calls fn at most once per ttl, for the
+// values that are expensive to compute. A failed call keeps the last value.
+func Cached(ttl time.Duration, fn func() (float64, error)) func() float64 {
+	var (
+		mu      sync.Mutex
+		value   float64
+		expires time.Time
+	)
+	return func() float64 {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if now := time.Now(); now.After(expires) {
+			if v, err := fn(); err == nil {
+				value = v
+				expires = now.Add(ttl)
+			}
+		}
+		return value
+	}
+}
+
+// RegisterCache reports the hits, misses and hit ratio of the named cache
+func RegisterCache(name string, stats func() (hits uint64, misses uint64)) {
+	labels := prometheus.Labels{"cache": name}
+	replace(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Name:        "cache_hits_total",
+		Help:        "Cache lookups that found the key.",
+		ConstLabels: labels,
+	}, func() float64 {
+		hits, _ := stats()
+		return float64(hits)
+	}))
+	replace(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Name:        "cache_misses_total",
+		Help:        "Cache lookups that missed the key.",
+		ConstLabels: labels,
+	}, func() float64 {
+		_, misses := stats()
+		return float64(misses)
+	}))
+	replace(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "cache_hit_ratio",
+		Help:        "Share of cache lookups that found the key since start.",
+		ConstLabels: labels,
+	}, func() float64 {
+		hits, misses := stats()
+		if hits+misses == 0 {
+			return 0
+		}
+		return float64(hits) / float64(hits+misses)
+	}))
+}
@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/storage"
+)
+
+type instrumentedStore struct {
+	storage.Store
+}
+
+// InstrumentStore records the duration of every transaction of store
+func InstrumentStore(store storage.Store) storage.Store {
+	return &instrumentedStore{Store: store}
+}
+
+func (s *instrumentedStore) View(fn func(tx storage.Tx) error) error {
+	defer observeTx("view", time.Now())
+	return s.Store.View(fn)
+}
+
+func (s *instrumentedStore) Update(fn func(tx storage.Tx) error) error {
+	defer observeTx("update", time.Now())
+	return s.Store.Update(fn)
+}
+
+func observeTx(txType string, start time.Time) {
+	txDuration.WithLabelValues(txType).Observe(time.Since(start).Seconds())
+}
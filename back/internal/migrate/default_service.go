@@ -0,0 +1,258 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+
+	"github.com/pzolo85/todo-app/back/internal/emailaddr"
+	"github.com/pzolo85/todo-app/back/internal/storage"
+	"github.com/pzolo85/todo-app/back/internal/user"
+)
+
+type DefaultService struct {
+	store      storage.Store
+	logger     *slog.Logger
+	migrations []Migration
+}
+
+var (
+	MetaBucket = []byte("meta")
+	versionKey = []byte("schema_version")
+	// emailRulesKey holds the emailaddr rules the user keys are canonical for
+	emailRulesKey = []byte("email_rules")
+
+	errDryRun = errors.New("dry run")
+)
+
+func NewDefaultService(store storage.Store, logger *slog.Logger, migrations []Migration) *DefaultService {
+	migrations = slices.Clone(migrations)
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return a.Version - b.Version
+	})
+
+	return &DefaultService{
+		store:      store,
+		logger:     logger.WithGroup("migrate"),
+		migrations: migrations,
+	}
+}
+
+// Version returns the schema version stored in the db, 0 if it was never migrated
+func (s *DefaultService) Version() (int, error) {
+	var version int
+	err := s.store.View(func(tx storage.Tx) error {
+		var err error
+		version, err = ReadVersion(tx)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version > %w", err)
+	}
+
+	return version, nil
+}
+
+// Latest returns the version of the last known migration
+func (s *DefaultService) Latest() int {
+	return LatestVersion(s.migrations)
+}
+
+// LatestVersion returns the highest version in migrations
+func LatestVersion(migrations []Migration) int {
+	latest := 0
+	for _, m := range migrations {
+		latest = max(latest, m.Version)
+	}
+	return latest
+}
+
+// Check fails when the db was migrated by a newer binary
+func (s *DefaultService) Check() error {
+	version, err := s.Version()
+	if err != nil {
+		return err
+	}
+
+	if version > s.Latest() {
+		return fmt.Errorf("%w: db version %d, supported version %d", ErrSchemaTooNew, version, s.Latest())
+	}
+
+	return nil
+}
+
+func (s *DefaultService) Status() ([]Status, error) {
+	version, err := s.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]Status, 0, len(s.migrations))
+	for _, m := range s.migrations {
+		status = append(status, Status{
+			Version: m.Version,
+			Name:    m.Name,
+			Applied: m.Version <= version,
+		})
+	}
+
+	return status, nil
+}
+
+// Up applies the pending migrations. With dryRun all of them run in a single
+// transaction that is rolled back at the end.
+func (s *DefaultService) Up(dryRun bool) ([]Migration, error) {
+	if err := s.Check(); err != nil {
+		return nil, err
+	}
+
+	version, err := s.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := slices.DeleteFunc(slices.Clone(s.migrations), func(m Migration) bool {
+		return m.Version <= version
+	})
+
+	if dryRun {
+		err := s.store.Update(func(tx storage.Tx) error {
+			for _, m := range pending {
+				if err := apply(tx, m); err != nil {
+					return err
+				}
+			}
+			return errDryRun
+		})
+		if !errors.Is(err, errDryRun) {
+			return nil, err
+		}
+		return pending, nil
+	}
+
+	for i, m := range pending {
+		err := s.store.Update(func(tx storage.Tx) error {
+			return apply(tx, m)
+		})
+		if err != nil {
+			return pending[:i], err
+		}
+		s.logger.Info("migration applied", "version", m.Version, "name", m.Name)
+	}
+
+	return pending, nil
+}
+
+// EmailRules returns the rules the user keys were canonicalized with, migration 2
+// applies the default ones
+func (s *DefaultService) EmailRules() (string, error) {
+	var rules string
+	err := s.store.View(func(tx storage.Tx) error {
+		var err error
+		rules, err = readEmailRules(tx)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read email rules > %w", err)
+	}
+
+	return rules, nil
+}
+
+// CheckEmailRules returns ErrEmailRules when the user keys are not canonical
+// under emails, lookups would miss the accounts stored under other keys
+func (s *DefaultService) CheckEmailRules(emails emailaddr.Normalizer) error {
+	version, err := s.Version()
+	if err != nil || version < 2 {
+		return err
+	}
+
+	rules, err := s.EmailRules()
+	if err != nil {
+		return err
+	}
+	if rules != emails.Rules() {
+		return fmt.Errorf("%w: stored %s, configured %s", ErrEmailRules, rules, emails.Rules())
+	}
+
+	return nil
+}
+
+func readEmailRules(tx storage.Tx) (string, error) {
+	v, err := tx.Get(MetaBucket, emailRulesKey)
+	if err != nil && !errors.Is(err, storage.ErrBucketNotFound) {
+		return "", err
+	}
+	if v == nil {
+		return emailaddr.Default.Rules(), nil
+	}
+	return string(v), nil
+}
+
+// CanonicalizeEmails moves the users to their canonical keys under emails, when
+// the keys were canonicalized with other rules, as after email_provider_rules
+// is turned on. The accounts that now share a key are recorded as duplicates.
+// It returns false when the keys were already canonical, and does nothing
+// before migration 2.
+func (s *DefaultService) CanonicalizeEmails(emails emailaddr.Normalizer) (bool, error) {
+	changed := false
+	err := s.store.Update(func(tx storage.Tx) error {
+		version, err := ReadVersion(tx)
+		if err != nil || version < 2 {
+			return err
+		}
+
+		rules, err := readEmailRules(tx)
+		if err != nil || rules == emails.Rules() {
+			return err
+		}
+
+		duplicates, err := user.CanonicalizeEmails(tx, emails.Normalize)
+		if err != nil {
+			return err
+		}
+		s.logger.Info("user emails canonicalized", "from", rules, "to", emails.Rules(), "duplicates", len(duplicates))
+		changed = true
+		return tx.Put(MetaBucket, emailRulesKey, []byte(emails.Rules()))
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to canonicalize user emails > %w", err)
+	}
+
+	return changed, nil
+}
+
+func apply(tx storage.Tx, m Migration) error {
+	if err := m.Up(tx); err != nil {
+		return fmt.Errorf("failed to apply migration %d (%s) > %w", m.Version, m.Name, err)
+	}
+
+	if err := tx.CreateBucket(MetaBucket); err != nil {
+		return fmt.Errorf("failed to create meta bucket > %w", err)
+	}
+
+	return tx.Put(MetaBucket, versionKey, []byte(strconv.Itoa(m.Version)))
+}
+
+// ReadVersion returns the schema version stored in the meta bucket of tx
+func ReadVersion(tx storage.Tx) (int, error) {
+	v, err := tx.Get(MetaBucket, versionKey)
+	if errors.Is(err, storage.ErrBucketNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if v == nil {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(string(v))
+	if err != nil {
+		return 0, fmt.Errorf("corrupted schema version %q > %w", v, err)
+	}
+
+	return version, nil
+}
@@ -0,0 +1,133 @@
+package migrate
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/emailaddr"
+	"github.com/pzolo85/todo-app/back/internal/storage"
+	"github.com/pzolo85/todo-app/back/internal/user"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStore(t *testing.T) storage.Store {
+	store, err := storage.OpenBolt(filepath.Join(t.TempDir(), "test.bolt"), storage.Options{})
+	assert.Nil(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestDefaultService_Up(t *testing.T) {
+	bucket := []byte("test")
+	migrations := []Migration{
+		{Version: 2, Name: "second", Up: func(tx storage.Tx) error {
+			return tx.Put(bucket, []byte("k"), []byte("v2"))
+		}},
+		{Version: 1, Name: "first", Up: func(tx storage.Tx) error {
+			return tx.CreateBucket(bucket)
+		}},
+	}
+
+	store := newTestStore(t)
+	svc := NewDefaultService(store, slog.Default(), migrations)
+
+	t.Run("dry run rolls back", func(t *testing.T) {
+		pending, err := svc.Up(true)
+		assert.Nil(t, err)
+		assert.Len(t, pending, 2)
+
+		version, err := svc.Version()
+		assert.Nil(t, err)
+		assert.Equal(t, 0, version)
+	})
+
+	t.Run("applies in order", func(t *testing.T) {
+		applied, err := svc.Up(false)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, applied[0].Version)
+		assert.Equal(t, 2, applied[1].Version)
+
+		version, err := svc.Version()
+		assert.Nil(t, err)
+		assert.Equal(t, 2, version)
+
+		status, err := svc.Status()
+		assert.Nil(t, err)
+		for _, s := range status {
+			assert.True(t, s.Applied)
+		}
+	})
+
+	t.Run("nothing left to apply", func(t *testing.T) {
+		applied, err := svc.Up(false)
+		assert.Nil(t, err)
+		assert.Empty(t, applied)
+	})
+}
+
+func TestDefaultService_Check(t *testing.T) {
+	store := newTestStore(t)
+	err := store.Update(func(tx storage.Tx) error {
+		if err := tx.CreateBucket(MetaBucket); err != nil {
+			return err
+		}
+		return tx.Put(MetaBucket, versionKey, []byte(strconv.Itoa(LatestVersion(Migrations)+1)))
+	})
+	assert.Nil(t, err)
+
+	svc := NewDefaultService(store, slog.Default(), Migrations)
+	assert.ErrorIs(t, svc.Check(), ErrSchemaTooNew)
+
+	_, err = svc.Up(false)
+	assert.ErrorIs(t, err, ErrSchemaTooNew)
+}
+
+func TestDefaultService_CanonicalizeEmails(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	svc := NewDefaultService(store, slog.Default(), Migrations)
+	_, err := svc.Up(false)
+	assert.Nil(t, err)
+
+	repo, err := user.NewDefaultRepo(store, cache.New(time.Hour, time.Hour), "admin", "user")
+	assert.Nil(t, err)
+	for _, email := range []string{"j.on+x@gmail.com", "jon@gmail.com", "a.na+y@gmail.com", "mary@test.com"} {
+		assert.Nil(t, repo.SaveUser(ctx, &user.User{Email: email, Role: "user", CreatedAt: time.Now()}, false))
+	}
+
+	provider := emailaddr.Normalizer{ProviderRules: true}
+	assert.Nil(t, svc.CheckEmailRules(emailaddr.Default))
+	assert.ErrorIs(t, svc.CheckEmailRules(provider), ErrEmailRules)
+
+	changed, err := svc.CanonicalizeEmails(provider)
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.Nil(t, svc.CheckEmailRules(provider))
+
+	rules, err := svc.EmailRules()
+	assert.Nil(t, err)
+	assert.Equal(t, "provider", rules)
+
+	repo, err = user.NewDefaultRepo(store, cache.New(time.Hour, time.Hour), "admin", "user")
+	assert.Nil(t, err)
+	u, err := repo.GetUser(ctx, "ana@gmail.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "ana@gmail.com", u.Email)
+	_, err = repo.GetUser(ctx, "mary@test.com")
+	assert.Nil(t, err)
+
+	duplicates, err := repo.ListDuplicates(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{"jon@gmail.com": {"j.on+x@gmail.com", "jon@gmail.com"}}, duplicates)
+
+	// the keys are already canonical
+	changed, err = svc.CanonicalizeEmails(provider)
+	assert.Nil(t, err)
+	assert.False(t, changed)
+}
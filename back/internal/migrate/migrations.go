@@ -0,0 +1,35 @@
+package migrate
+
+import (
+	"github.com/pzolo85/todo-app/back/internal/emailaddr"
+	"github.com/pzolo85/todo-app/back/internal/storage"
+	"github.com/pzolo85/todo-app/back/internal/user"
+)
+
+// Migrations holds every schema change, new ones are appended at the end
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create user bucket",
+		Up: func(tx storage.Tx) error {
+			return tx.CreateBucket(user.UserBucket)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "canonical user emails",
+		// duplicates are recorded in user.DuplicateBucket, the provider rules are
+		// applied by DefaultService.CanonicalizeEmails when they are configured
+		Up: func(tx storage.Tx) error {
+			_, err := user.CanonicalizeEmails(tx, emailaddr.Default.Normalize)
+			return err
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create list bucket",
+		Up: func(tx storage.Tx) error {
+			return tx.CreateBucket(user.ListBucket)
+		},
+	},
+}
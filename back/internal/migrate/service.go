@@ -0,0 +1,40 @@
+// Package migrate keeps the schema of the database up to date
+//
+// The schema version is stored in the meta bucket. Migrations are applied in
+// order, each one in its own transaction.
+package migrate
+
+import (
+	"errors"
+
+	"github.com/pzolo85/todo-app/back/internal/emailaddr"
+	"github.com/pzolo85/todo-app/back/internal/storage"
+)
+
+var (
+	ErrSchemaTooNew = errors.New("database schema is newer than this binary supports")
+	ErrEmailRules   = errors.New("user emails are canonical for other rules, run `todo-app db migrate up`")
+)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx storage.Tx) error
+}
+
+type Status struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Applied bool   `json:"applied"`
+}
+
+type Service interface {
+	Version() (int, error)
+	Latest() int
+	Check() error
+	Status() ([]Status, error)
+	Up(dryRun bool) ([]Migration, error)
+	EmailRules() (string, error)
+	CheckEmailRules(emails emailaddr.Normalizer) error
+	CanonicalizeEmails(emails emailaddr.Normalizer) (bool, error)
+}
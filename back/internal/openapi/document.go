@@ -0,0 +1,129 @@
+// Package openapi builds the OpenAPI 3.1 description of the API
+//
+// Schemas are generated from the request and response types, reading their
+// json and validate tags, so the document cannot drift from the code.
+package openapi
+
+import (
+	"regexp"
+	"strings"
+)
+
+const Version = "3.1.0"
+
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// PathItem maps a lowercase http method to its operation
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Summary     string                `json:"summary"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	In          string `json:"in,omitempty"`
+	Scheme      string `json:"scheme,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+func New(info Info) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]*PathItem{},
+		Components: Components{
+			Schemas:         map[string]*Schema{},
+			SecuritySchemes: map[string]*SecurityScheme{},
+		},
+	}
+}
+
+var echoParam = regexp.MustCompile(`:([^/]+)`)
+
+// Path converts an echo route path like /export/:id to its OpenAPI form /export/{id}
+func Path(route string) string {
+	return echoParam.ReplaceAllString(route, "{$1}")
+}
+
+// Add documents the operation served at method and the echo route path
+func (d *Document) Add(method string, route string, op *Operation) {
+	path := Path(route)
+	item, ok := d.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		d.Paths[path] = item
+	}
+	(*item)[strings.ToLower(method)] = op
+}
+
+// Operation returns the operation documented for method and the echo route path
+func (d *Document) Operation(method string, route string) (*Operation, bool) {
+	item, ok := d.Paths[Path(route)]
+	if !ok {
+		return nil, false
+	}
+	op, ok := (*item)[strings.ToLower(method)]
+	return op, ok
+}
+
+// Body is a required request body of the given schema
+func Body(contentType string, schema *Schema) *RequestBody {
+	return &RequestBody{
+		Required: true,
+		Content:  map[string]*MediaType{contentType: {Schema: schema}},
+	}
+}
+
+// Content is a response of the given schema, a nil schema has no body
+func Content(description string, contentType string, schema *Schema) *Response {
+	r := &Response{Description: description}
+	if schema != nil {
+		r.Content = map[string]*MediaType{contentType: {Schema: schema}}
+	}
+	return r
+}
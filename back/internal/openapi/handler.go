@@ -0,0 +1,61 @@
+package openapi
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+
+	"github.com/pzolo85/todo-app/back/internal/apperr"
+
+	"github.com/labstack/echo/v4"
+)
+
+//go:embed ui.html
+var ui []byte
+
+// RedocVersion is the Redoc release vendored by make redoc
+const RedocVersion = "v2.2.0"
+
+const redocBundle = "redoc/redoc.standalone.js"
+
+var ErrRedocMissing = apperr.NotFound("redoc_missing", "the redoc bundle is not built into the server, run make redoc")
+
+//go:embed redoc
+var redoc embed.FS
+
+// Handler serves the document as JSON, it is encoded once
+func Handler(d *Document) (echo.HandlerFunc, error) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode openapi document > %w", err)
+	}
+
+	return func(c echo.Context) error {
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, data)
+	}, nil
+}
+
+// UIHandler serves a Redoc page that renders the openapi.json next to it
+func UIHandler(c echo.Context) error {
+	return c.HTMLBlob(http.StatusOK, ui)
+}
+
+// RedocEmbedded reports whether the Redoc bundle is built into the binary
+func RedocEmbedded() bool {
+	_, err := fs.Stat(redoc, redocBundle)
+	return err == nil
+}
+
+// RedocHandler serves the Redoc bundle loaded by the UI page. The docs do not
+// load scripts from other origins, without the bundle the page stays blank.
+func RedocHandler(c echo.Context) error {
+	data, err := redoc.ReadFile(redocBundle)
+	if err != nil {
+		return ErrRedocMissing
+	}
+
+	c.Response().Header().Set("Cache-Control", "public, max-age=86400")
+	return c.Blob(http.StatusOK, "text/javascript; charset=utf-8", data)
+}
@@ -0,0 +1,11 @@
+package openapi
+
+import "testing"
+
+// TestRedocEmbedded fails until the bundle is vendored, the docs page does not
+// load it from a CDN
+func TestRedocEmbedded(t *testing.T) {
+	if !RedocEmbedded() {
+		t.Fatalf("%s is missing, run make redoc and commit it", redocBundle)
+	}
+}
@@ -0,0 +1,192 @@
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of JSON Schema used by the document
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 any                `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// String is a plain string schema
+func String() *Schema {
+	return &Schema{Type: "string"}
+}
+
+// Binary is the schema of a file download
+func Binary() *Schema {
+	return &Schema{Type: "string", Format: "binary"}
+}
+
+// SchemaOf returns a reference to the schema of v, registering the schemas of
+// every named struct it uses in the document components.
+func (d *Document) SchemaOf(v any) *Schema {
+	return d.schema(reflect.TypeOf(v))
+}
+
+func (d *Document) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct:
+		return d.ref(t)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return String()
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schema(t.Elem())}
+	}
+
+	return &Schema{}
+}
+
+// ref registers the struct t as a component and returns a reference to it
+func (d *Document) ref(t reflect.Type) *Schema {
+	name := componentName(t)
+	ref := &Schema{Ref: "#/components/schemas/" + name}
+	if _, ok := d.Components.Schemas[name]; ok {
+		return ref
+	}
+
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	// registered before the fields so recursive types end
+	d.Components.Schemas[name] = s
+
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := d.schema(f.Type)
+		rules := f.Tag.Get("validate")
+		// without rules the field is a response field, always sent unless omitempty
+		required := applyRules(prop, strings.Split(rules, ","))
+		if rules == "" {
+			required = !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer
+		}
+		if required {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = prop
+	}
+
+	return ref
+}
+
+// applyRules adds the validate rules to s and reports whether the field is required
+func applyRules(s *Schema, rules []string) bool {
+	required := false
+	for i, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "dive":
+			// the remaining rules apply to the items
+			if s.Items != nil {
+				applyRules(s.Items, rules[i+1:])
+			}
+			return required
+		case "required":
+			required = true
+		case "email":
+			s.Format = "email"
+		case "max", "min":
+			n, err := strconv.Atoi(param)
+			if err != nil {
+				continue
+			}
+			switch {
+			case s.Type == "array" && name == "min":
+				s.MinItems = &n
+			case s.Type == "string" && name == "min":
+				s.MinLength = &n
+			case s.Type == "string" && name == "max":
+				s.MaxLength = &n
+			}
+		case "oneof":
+			s.Enum = strings.Fields(param)
+		}
+	}
+	return required
+}
+
+// componentName is the package qualified name of t, like user.User
+func componentName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndexByte(pkg, '/'); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	if pkg == "" {
+		return t.Name()
+	}
+	return pkg + "." + t.Name()
+}
+
+// QueryParams documents the fields of v tagged with query as query parameters
+func (d *Document) QueryParams(v any) []Parameter {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var params []Parameter
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name := f.Tag.Get("query")
+		if name == "" {
+			continue
+		}
+
+		s := d.schema(f.Type)
+		params = append(params, Parameter{
+			Name:     name,
+			In:       "query",
+			Required: applyRules(s, strings.Split(f.Tag.Get("validate"), ",")),
+			Schema:   s,
+		})
+	}
+	return params
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+type BoltStore struct {
+	db *bolt.DB
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func OpenBolt(path string, opts Options) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{
+		Timeout:  opts.Timeout,
+		ReadOnly: opts.ReadOnly,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt db > %w", err)
+	}
+
+	return &BoltStore{
+		db: db,
+	}, nil
+}
+
+func (s *BoltStore) View(fn func(tx Tx) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx: tx})
+	})
+}
+
+func (s *BoltStore) Update(fn func(tx Tx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx: tx})
+	})
+}
+
+func (s *BoltStore) SnapshotFile(path string) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(path, 0600)
+	})
+}
+
+func (s *BoltStore) Backend() string {
+	return BackendBolt
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func (t *boltTx) CreateBucket(name []byte) error {
+	_, err := t.tx.CreateBucketIfNotExists(name)
+	return err
+}
+
+func (t *boltTx) ForEachBucket(fn func(name []byte) error) error {
+	return t.tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+		return fn(name)
+	})
+}
+
+func (t *boltTx) Get(bucket []byte, key []byte) ([]byte, error) {
+	b := t.tx.Bucket(bucket)
+	if b == nil {
+		return nil, fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+	}
+
+	return b.Get(key), nil
+}
+
+func (t *boltTx) Put(bucket []byte, key []byte, value []byte) error {
+	b := t.tx.Bucket(bucket)
+	if b == nil {
+		return fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+	}
+
+	return b.Put(key, value)
+}
+
+func (t *boltTx) Delete(bucket []byte, key []byte) error {
+	b := t.tx.Bucket(bucket)
+	if b == nil {
+		return fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+	}
+
+	return b.Delete(key)
+}
+
+func (t *boltTx) ForEach(bucket []byte, fn func(k, v []byte) error) error {
+	b := t.tx.Bucket(bucket)
+	if b == nil {
+		return fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+	}
+
+	return b.ForEach(fn)
+}
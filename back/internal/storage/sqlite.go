@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+type sqliteTx struct {
+	tx *sql.Tx
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS buckets (
+	name BLOB PRIMARY KEY
+);
+CREATE TABLE IF NOT EXISTS kv (
+	bucket BLOB NOT NULL REFERENCES buckets(name),
+	key    BLOB NOT NULL,
+	value  BLOB NOT NULL,
+	PRIMARY KEY (bucket, key)
+);`
+
+func OpenSQLite(path string, opts Options) (*SQLiteStore, error) {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = math.MaxInt32 * time.Millisecond
+	}
+
+	params := url.Values{}
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", timeout.Milliseconds()))
+	params.Add("_txlock", "immediate")
+	if opts.ReadOnly {
+		params.Add("mode", "ro")
+	} else {
+		params.Add("_pragma", "journal_mode(WAL)")
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite db > %w", err)
+	}
+	// a single writer, as with bolt
+	db.SetMaxOpenConns(1)
+
+	if !opts.ReadOnly {
+		if _, err := db.Exec(sqliteSchema); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create sqlite schema > %w", err)
+		}
+	}
+
+	return &SQLiteStore{
+		db: db,
+	}, nil
+}
+
+func (s *SQLiteStore) View(fn func(tx Tx) error) error {
+	return s.run(&sql.TxOptions{ReadOnly: true}, fn)
+}
+
+func (s *SQLiteStore) Update(fn func(tx Tx) error) error {
+	return s.run(nil, fn)
+}
+
+func (s *SQLiteStore) run(opts *sql.TxOptions, fn func(tx Tx) error) error {
+	tx, err := s.db.BeginTx(context.Background(), opts)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction > %w", err)
+	}
+
+	if err := fn(&sqliteTx{tx: tx}); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) SnapshotFile(path string) error {
+	_, err := s.db.Exec("VACUUM INTO ?", path)
+	return err
+}
+
+func (s *SQLiteStore) Backend() string {
+	return BackendSQLite
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func (t *sqliteTx) CreateBucket(name []byte) error {
+	_, err := t.tx.Exec("INSERT OR IGNORE INTO buckets (name) VALUES (?)", name)
+	return err
+}
+
+func (t *sqliteTx) ForEachBucket(fn func(name []byte) error) error {
+	rows, err := t.tx.Query("SELECT name FROM buckets ORDER BY name")
+	if err != nil {
+		return err
+	}
+
+	names := [][]byte{}
+	for rows.Next() {
+		var name []byte
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		names = append(names, name)
+	}
+	if err := errors.Join(rows.Err(), rows.Close()); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := fn(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *sqliteTx) bucketExists(bucket []byte) error {
+	var n int
+	err := t.tx.QueryRow("SELECT count(*) FROM buckets WHERE name = ?", bucket).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+	}
+	return nil
+}
+
+func (t *sqliteTx) Get(bucket []byte, key []byte) ([]byte, error) {
+	if err := t.bucketExists(bucket); err != nil {
+		return nil, err
+	}
+
+	var value []byte
+	err := t.tx.QueryRow("SELECT value FROM kv WHERE bucket = ? AND key = ?", bucket, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	return value, err
+}
+
+func (t *sqliteTx) Put(bucket []byte, key []byte, value []byte) error {
+	if err := t.bucketExists(bucket); err != nil {
+		return err
+	}
+
+	_, err := t.tx.Exec("INSERT OR REPLACE INTO kv (bucket, key, value) VALUES (?, ?, ?)", bucket, key, value)
+	return err
+}
+
+func (t *sqliteTx) Delete(bucket []byte, key []byte) error {
+	if err := t.bucketExists(bucket); err != nil {
+		return err
+	}
+
+	_, err := t.tx.Exec("DELETE FROM kv WHERE bucket = ? AND key = ?", bucket, key)
+	return err
+}
+
+// ForEach reads the whole bucket before calling fn, so fn can write to the same transaction
+func (t *sqliteTx) ForEach(bucket []byte, fn func(k, v []byte) error) error {
+	if err := t.bucketExists(bucket); err != nil {
+		return err
+	}
+
+	rows, err := t.tx.Query("SELECT key, value FROM kv WHERE bucket = ? ORDER BY key", bucket)
+	if err != nil {
+		return err
+	}
+
+	type pair struct{ k, v []byte }
+	pairs := []pair{}
+	for rows.Next() {
+		var p pair
+		if err := rows.Scan(&p.k, &p.v); err != nil {
+			rows.Close()
+			return err
+		}
+		pairs = append(pairs, p)
+	}
+	if err := errors.Join(rows.Err(), rows.Close()); err != nil {
+		return err
+	}
+
+	for _, p := range pairs {
+		if err := fn(p.k, p.v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
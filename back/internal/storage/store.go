@@ -0,0 +1,75 @@
+// Package storage abstracts the key/value store the repositories are built on
+//
+// Data is organised in buckets of sorted keys, as in bolt. Every read or write
+// happens inside a transaction.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	BackendBolt   = "bolt"
+	BackendSQLite = "sqlite"
+)
+
+var (
+	Backends = []string{BackendBolt, BackendSQLite}
+
+	ErrBucketNotFound = errors.New("bucket not found")
+)
+
+type Store interface {
+	View(fn func(tx Tx) error) error
+	Update(fn func(tx Tx) error) error
+	// SnapshotFile writes a consistent copy of the store to path
+	SnapshotFile(path string) error
+	Backend() string
+	Close() error
+}
+
+type Tx interface {
+	CreateBucket(name []byte) error
+	ForEachBucket(fn func(name []byte) error) error
+	// Get returns nil when the key does not exist
+	Get(bucket []byte, key []byte) ([]byte, error)
+	Put(bucket []byte, key []byte, value []byte) error
+	Delete(bucket []byte, key []byte) error
+	// ForEach calls fn for every key of bucket in order
+	ForEach(bucket []byte, fn func(k, v []byte) error) error
+}
+
+type Options struct {
+	ReadOnly bool
+	// Timeout is how long to wait for the file lock, 0 waits forever
+	Timeout time.Duration
+}
+
+// Open opens the store of the given backend at path
+func Open(backend string, path string, opts Options) (Store, error) {
+	switch backend {
+	case BackendBolt:
+		return OpenBolt(path, opts)
+	case BackendSQLite:
+		return OpenSQLite(path, opts)
+	}
+	return nil, fmt.Errorf("unknown storage backend: %s", backend)
+}
+
+// Copy copies every bucket of src into dst in a single transaction
+func Copy(dst Store, src Store) error {
+	return src.View(func(stx Tx) error {
+		return dst.Update(func(dtx Tx) error {
+			return stx.ForEachBucket(func(name []byte) error {
+				if err := dtx.CreateBucket(name); err != nil {
+					return err
+				}
+				return stx.ForEach(name, func(k, v []byte) error {
+					return dtx.Put(name, k, v)
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,47 @@
+package testutil
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"sync"
+
+	"github.com/pzolo85/todo-app/back/internal/mail"
+)
+
+// MailRecorder is a mail transport that keeps the mails in memory
+type MailRecorder struct {
+	mu    sync.Mutex
+	mails []mail.Mail
+}
+
+func (r *MailRecorder) Send(ctx context.Context, m mail.Mail) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mails = append(r.mails, m)
+	return nil
+}
+
+// Mails returns the mails sent to email, the oldest first
+func (r *MailRecorder) Mails(email string) []mail.Mail {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.DeleteFunc(slices.Clone(r.mails), func(m mail.Mail) bool {
+		return m.To != email
+	})
+}
+
+// Challenge returns the challenge of the last verification mail sent to email
+func (r *MailRecorder) Challenge(email string) (string, bool) {
+	mails := r.Mails(email)
+	for i := len(mails) - 1; i >= 0; i-- {
+		link, err := url.Parse(mails[i].Link)
+		if err != nil {
+			continue
+		}
+		if challenge := link.Query().Get("challenge"); challenge != "" {
+			return challenge, true
+		}
+	}
+	return "", false
+}
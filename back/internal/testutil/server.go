@@ -0,0 +1,131 @@
+// Package testutil runs the whole app in tests
+package testutil
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/app"
+	"github.com/pzolo85/todo-app/back/internal/claim"
+	"github.com/pzolo85/todo-app/back/internal/config"
+	"github.com/pzolo85/todo-app/back/pkg/client"
+
+	"github.com/google/uuid"
+)
+
+const password = "secret"
+
+// Server is the app served by an httptest.Server from a temp bolt db
+type Server struct {
+	*httptest.Server
+	Config   *config.Config
+	Services *app.Services
+	Mails    *MailRecorder
+}
+
+// NewServer starts the app with the default config, a new key and a temp db.
+// It is closed with the test.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	cfg := config.Defaults()
+	cfg.Key = config.Secret(uuid.NewString())
+	cfg.DBPath = filepath.Join(t.TempDir(), "test.bolt")
+	cfg.Level = "error"
+	// the metrics are registered globally, they would be registered once per server
+	cfg.MetricsEnabled = false
+
+	mails := &MailRecorder{}
+	svc, err := app.Load(cfg, app.Options{MailTransport: mails})
+	if err != nil {
+		t.Fatalf("failed to load the app > %s", err)
+	}
+
+	srv := httptest.NewServer(svc.Server.Handler())
+	t.Cleanup(func() {
+		srv.Close()
+		svc.Exporter.Shutdown(context.Background())
+		svc.Store.Close()
+	})
+
+	return &Server{
+		Server:   srv,
+		Config:   cfg,
+		Services: svc,
+		Mails:    mails,
+	}
+}
+
+// Client returns a client of the server
+func (s *Server) Client(opts ...client.Option) *client.Client {
+	return client.New(s.URL, opts...)
+}
+
+// AdminToken signs an admin token valid for d, like todo-app token sign
+func (s *Server) AdminToken(t testing.TB, d time.Duration) string {
+	t.Helper()
+
+	token, err := s.signAdminToken(context.Background(), d)
+	if err != nil {
+		t.Fatalf("failed to sign admin token > %s", err)
+	}
+	return token
+}
+
+func (s *Server) signAdminToken(ctx context.Context, d time.Duration) (string, error) {
+	now := time.Now()
+	return s.Services.AuthSvc.GetJWT(ctx, &claim.UserClaim{
+		Email:     "admin@localhost",
+		CreatedAt: now,
+		ExpiresAt: now.Add(d),
+		IsAdmin:   true,
+		ClaimID:   uuid.NewString(),
+		SourceIP:  "127.0.0.1",
+		UserAgent: "testutil",
+	})
+}
+
+// AdminClient returns a client that signs a new admin token for every call
+func (s *Server) AdminClient() *client.Client {
+	return s.Client(client.WithTokenSource(func(ctx context.Context) (string, error) {
+		return s.signAdminToken(ctx, time.Minute)
+	}))
+}
+
+// NewUser creates a user with a validated email and returns a client logged in as it
+func (s *Server) NewUser(t testing.TB, email string) *client.Client {
+	t.Helper()
+	return s.newUser(t, email, false)
+}
+
+// NewAdmin creates a user with the admin role and returns a client logged in as it
+func (s *Server) NewAdmin(t testing.TB, email string) *client.Client {
+	t.Helper()
+	return s.newUser(t, email, true)
+}
+
+func (s *Server) newUser(t testing.TB, email string, admin bool) *client.Client {
+	t.Helper()
+
+	salt := uuid.NewString()
+	hash := client.HashPassword(salt, password)
+	_, err := s.AdminClient().AdminCreateUser(context.Background(), client.AdminCreateUserRequest{
+		Email:      email,
+		Salt:       salt,
+		HashedPass: hash,
+		Admin:      admin,
+		Verified:   true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create user %s > %s", email, err)
+	}
+
+	c := s.Client(client.WithCredentials(email, hash))
+	if _, err := c.Login(context.Background(), email, hash); err != nil {
+		t.Fatalf("failed to log in as %s > %s", email, err)
+	}
+	return c
+}
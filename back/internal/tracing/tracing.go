@@ -0,0 +1,91 @@
+// Package tracing sets up the OpenTelemetry tracer provider of the app
+//
+// Spans are propagated with W3C trace context headers (traceparent). The
+// exporter is one of:
+//
+//	otlp-grpc // OTLP over gRPC, the endpoint defaults to localhost:4317
+//	otlp-http // OTLP over HTTP, the endpoint defaults to localhost:4318
+//	stdout    // pretty printed spans on stdout, for tests and debugging
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const (
+	ServiceName = "todo-app"
+
+	ExporterNone     = ""
+	ExporterOTLPGRPC = "otlp-grpc"
+	ExporterOTLPHTTP = "otlp-http"
+	ExporterStdout   = "stdout"
+)
+
+// Setup installs the global tracer provider and propagator. The returned
+// function flushes the pending spans and must be called before exiting.
+// With ExporterNone spans are propagated but not recorded.
+func Setup(ctx context.Context, exporter string, endpoint string, sampleRatio float64, version string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if exporter == ExporterNone {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exp, err := newExporter(ctx, exporter, endpoint, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(ServiceName),
+		semconv.ServiceVersion(version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource > %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+func newExporter(ctx context.Context, exporter string, endpoint string, stdout io.Writer) (sdktrace.SpanExporter, error) {
+	switch exporter {
+	case ExporterOTLPGRPC:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithInsecure()}
+		if endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(endpoint))
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	case ExporterOTLPHTTP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithInsecure()}
+		if endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(endpoint))
+		}
+		return otlptracehttp.New(ctx, opts...)
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(stdout), stdouttrace.WithPrettyPrint())
+	}
+	return nil, fmt.Errorf("unknown trace exporter: %s", exporter)
+}
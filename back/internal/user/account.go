@@ -0,0 +1,95 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/apperr"
+)
+
+var ErrSuspended = apperr.Forbidden("account_suspended", "the account is suspended")
+
+// Summary is the view of a user shown to admins, without credentials or tokens
+type Summary struct {
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	ValidEmail bool       `json:"valid_email"`
+	Suspended  bool       `json:"suspended"`
+	Sessions   int        `json:"sessions"`
+	CreatedAt  time.Time  `json:"created_at"`
+	DeleteAt   *time.Time `json:"delete_at,omitempty"`
+}
+
+func (u *User) Summary() Summary {
+	return Summary{
+		Email:      u.Email,
+		Role:       u.Role,
+		ValidEmail: u.ValidEmail,
+		Suspended:  u.Suspended,
+		Sessions:   len(u.ActiveJWT),
+		CreatedAt:  u.CreatedAt,
+		DeleteAt:   u.DeleteAt,
+	}
+}
+
+// HashPassword returns the hash a client sends on login for password. The server
+// stores and compares the hash as given, this is the scheme of the passwords set by admins.
+func HashPassword(salt string, password string) string {
+	sum := sha256.Sum256([]byte(salt + password))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewPassword returns a random password and salt
+func NewPassword() (password string, salt string, err error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("failed to generate password > %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf[:16]), hex.EncodeToString(buf[16:]), nil
+}
+
+// SuspendUser blocks the login of the user and revokes its sessions
+func (r *DefaultRepo) SuspendUser(ctx context.Context, email string) error {
+	_, err := r.UpdateUser(ctx, email, func(u *User) error {
+		u.Suspended = true
+		u.ActiveJWT = []string{}
+		return nil
+	})
+	return err
+}
+
+func (r *DefaultRepo) ResumeUser(ctx context.Context, email string) error {
+	_, err := r.UpdateUser(ctx, email, func(u *User) error {
+		u.Suspended = false
+		return nil
+	})
+	return err
+}
+
+// SetPassword replaces the credentials of the user and revokes its sessions
+func (r *DefaultRepo) SetPassword(ctx context.Context, email string, salt string, hash string) error {
+	_, err := r.UpdateUser(ctx, email, func(u *User) error {
+		u.Salt = salt
+		u.PassHash = hash
+		u.ActiveJWT = []string{}
+		return nil
+	})
+	return err
+}
+
+// RevokeSessions removes every token of the user, it returns how many were revoked
+func (r *DefaultRepo) RevokeSessions(ctx context.Context, email string) (int, error) {
+	revoked := 0
+	_, err := r.UpdateUser(ctx, email, func(u *User) error {
+		revoked = len(u.ActiveJWT)
+		u.ActiveJWT = []string{}
+		return nil
+	})
+	return revoked, err
+}
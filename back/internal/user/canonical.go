@@ -0,0 +1,230 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/pzolo85/todo-app/back/internal/apperr"
+	"github.com/pzolo85/todo-app/back/internal/storage"
+)
+
+var (
+	// DuplicateBucket maps a canonical address to the keys of the accounts that share it
+	DuplicateBucket = []byte("user_duplicates")
+
+	ErrNotDuplicate = apperr.BadRequest("not_duplicate", "accounts do not share the same canonical address")
+)
+
+// CanonicalizeEmails moves every user stored under a non canonical address to
+// its canonical one. Accounts that share a canonical address are left alone and
+// recorded in DuplicateBucket, to be merged by an admin with MergeUsers. The
+// duplicates recorded before are replaced. The lists of a moved user follow it.
+func CanonicalizeEmails(tx storage.Tx, normalize func(string) (string, error)) (map[string][]string, error) {
+	for _, bucket := range [][]byte{DuplicateBucket, ListBucket} {
+		if err := tx.CreateBucket(bucket); err != nil {
+			return nil, err
+		}
+	}
+
+	var stale [][]byte
+	err := tx.ForEach(DuplicateBucket, func(k, v []byte) error {
+		stale = append(stale, append([]byte{}, k...))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range stale {
+		if err := tx.Delete(DuplicateBucket, k); err != nil {
+			return nil, fmt.Errorf("failed to delete duplicates of %s > %w", k, err)
+		}
+	}
+
+	groups := map[string][]string{}
+	err = tx.ForEach(UserBucket, func(k, v []byte) error {
+		canonical, err := normalize(string(k))
+		if err != nil {
+			// nothing can log in with an invalid address, leave it for the purge
+			return nil
+		}
+		groups[canonical] = append(groups[canonical], string(k))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	duplicates := map[string][]string{}
+	for canonical, keys := range groups {
+		if len(keys) > 1 {
+			duplicates[canonical] = keys
+			if err := putDuplicates(tx, canonical, keys); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if keys[0] == canonical {
+			continue
+		}
+
+		u, err := getUser(tx, keys[0])
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Delete(UserBucket, []byte(keys[0])); err != nil {
+			return nil, fmt.Errorf("failed to delete user %s > %w", keys[0], err)
+		}
+		u.Email = canonical
+		u.Revision++
+		if err := putUser(tx, u); err != nil {
+			return nil, err
+		}
+		err = updateLists(tx, slices.Concat(u.Notes, u.SharedWithMe), func(l *List) {
+			l.renameMember(keys[0], canonical)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to move the lists of %s > %w", keys[0], err)
+		}
+	}
+
+	return duplicates, nil
+}
+
+func putDuplicates(tx storage.Tx, canonical string, keys []string) error {
+	if len(keys) < 2 {
+		return tx.Delete(DuplicateBucket, []byte(canonical))
+	}
+
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("failed to marshal duplicates > %w", err)
+	}
+	return tx.Put(DuplicateBucket, []byte(canonical), data)
+}
+
+// ListDuplicates returns the accounts waiting to be merged, by canonical address
+func (r *DefaultRepo) ListDuplicates(ctx context.Context) (map[string][]string, error) {
+	duplicates := map[string][]string{}
+	err := r.view(ctx, "ListDuplicates", "", func(tx storage.Tx) error {
+		return tx.ForEach(DuplicateBucket, func(k, v []byte) error {
+			var keys []string
+			if err := json.Unmarshal(v, &keys); err != nil {
+				return fmt.Errorf("failed to unmarshal duplicates of %s > %w", k, err)
+			}
+			duplicates[string(k)] = keys
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list duplicate users > %w", err)
+	}
+
+	return duplicates, nil
+}
+
+// MergeUsers folds the accounts stored under others into primary, and stores the
+// result under canonical. primary keeps its credentials and role, lists, shares,
+// sessions and the validated flag are combined. Every other key is deleted.
+func (r *DefaultRepo) MergeUsers(ctx context.Context, canonical string, primary string, others []string) (*User, error) {
+	var merged *User
+	keys := append([]string{primary}, others...)
+	generation := r.cacheGeneration()
+	err := r.update(ctx, "MergeUsers", canonical, func(tx storage.Tx) error {
+		users := make([]*User, 0, len(keys))
+		for _, k := range keys {
+			u, err := getUser(tx, k)
+			if err != nil {
+				return fmt.Errorf("failed to get user %s > %w", k, err)
+			}
+			users = append(users, u)
+		}
+
+		// the canonical key may hold an account that is not part of the merge
+		if !slices.Contains(keys, canonical) {
+			existing, err := tx.Get(UserBucket, []byte(canonical))
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				return fmt.Errorf("%w: %s", ErrExists, canonical)
+			}
+		}
+
+		merged = users[0].Clone()
+		for _, u := range users[1:] {
+			merged.ValidEmail = merged.ValidEmail || u.ValidEmail
+			merged.ActiveJWT = appendMissing(merged.ActiveJWT, u.ActiveJWT)
+			merged.Notes = appendMissing(merged.Notes, u.Notes)
+			merged.SharedWithMe = appendMissing(merged.SharedWithMe, u.SharedWithMe)
+			if u.CreatedAt.Before(merged.CreatedAt) {
+				merged.CreatedAt = u.CreatedAt
+			}
+			merged.Revision = max(merged.Revision, u.Revision)
+		}
+
+		// a list shared between merged accounts is now owned by the reader
+		merged.SharedWithMe = slices.DeleteFunc(merged.SharedWithMe, func(l string) bool {
+			return slices.Contains(merged.Notes, l)
+		})
+
+		for _, k := range keys {
+			if err := tx.Delete(UserBucket, []byte(k)); err != nil {
+				return fmt.Errorf("failed to delete user %s > %w", k, err)
+			}
+			err := updateLists(tx, slices.Concat(merged.Notes, merged.SharedWithMe), func(l *List) {
+				l.renameMember(k, canonical)
+			})
+			if err != nil {
+				return fmt.Errorf("failed to move the lists of %s > %w", k, err)
+			}
+		}
+		merged.Email = canonical
+		merged.Revision++
+		if err := putUser(tx, merged); err != nil {
+			return err
+		}
+
+		return forgetDuplicates(tx, canonical, keys)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge users > %w", err)
+	}
+
+	for _, k := range keys {
+		r.cacheDelete(k)
+	}
+	r.cachePut(merged, generation)
+	return merged.Clone(), nil
+}
+
+// forgetDuplicates removes the merged keys from the duplicates report
+func forgetDuplicates(tx storage.Tx, canonical string, merged []string) error {
+	data, err := tx.Get(DuplicateBucket, []byte(canonical))
+	if err != nil || data == nil {
+		return err
+	}
+
+	var keys []string
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("failed to unmarshal duplicates of %s > %w", canonical, err)
+	}
+	keys = slices.DeleteFunc(keys, func(k string) bool {
+		return slices.Contains(merged, k)
+	})
+	if len(keys) > 0 {
+		keys = append(keys, canonical)
+	}
+	return putDuplicates(tx, canonical, keys)
+}
+
+func appendMissing(dst []string, src []string) []string {
+	for _, s := range src {
+		if !slices.Contains(dst, s) {
+			dst = append(dst, s)
+		}
+	}
+	return dst
+}
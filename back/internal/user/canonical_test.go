@@ -0,0 +1,77 @@
+package user
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pzolo85/todo-app/back/internal/emailaddr"
+	"github.com/pzolo85/todo-app/back/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalizeAndMerge(t *testing.T) {
+	ctx := context.Background()
+	for backend, repo := range newTestRepos(t) {
+		t.Run(backend, func(t *testing.T) {
+			jon := newTestUser("Jon@Test.com")
+			jon.Notes = []string{"a"}
+			jon.ActiveJWT = []string{"t1"}
+			lower := newTestUser("jon@test.com")
+			lower.Notes = []string{"b"}
+			lower.ValidEmail = true
+			for _, u := range []*User{jon, lower, newTestUser("Mary@Test.com"), newTestUser("invalid")} {
+				assert.Nil(t, repo.SaveUser(ctx, u, false))
+			}
+
+			var duplicates map[string][]string
+			err := repo.store.Update(func(tx storage.Tx) error {
+				var err error
+				duplicates, err = CanonicalizeEmails(tx, emailaddr.Default.Normalize)
+				return err
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, map[string][]string{"jon@test.com": {"Jon@Test.com", "jon@test.com"}}, duplicates)
+
+			t.Run("unique accounts are moved", func(t *testing.T) {
+				repo.cache.Flush()
+				u, err := repo.GetUser(ctx, "mary@test.com")
+				assert.Nil(t, err)
+				assert.Equal(t, "mary@test.com", u.Email)
+
+				_, err = repo.GetUser(ctx, "Mary@Test.com")
+				assert.ErrorIs(t, err, ErrNotFound)
+
+				_, err = repo.GetUser(ctx, "invalid")
+				assert.Nil(t, err)
+			})
+
+			t.Run("duplicates are listed", func(t *testing.T) {
+				listed, err := repo.ListDuplicates(ctx)
+				assert.Nil(t, err)
+				assert.Equal(t, duplicates, listed)
+			})
+
+			t.Run("merge", func(t *testing.T) {
+				merged, err := repo.MergeUsers(ctx, "jon@test.com", "Jon@Test.com", []string{"jon@test.com"})
+				assert.Nil(t, err)
+				assert.Equal(t, "jon@test.com", merged.Email)
+				assert.Equal(t, []string{"a", "b"}, merged.Notes)
+				assert.Equal(t, []string{"t1"}, merged.ActiveJWT)
+				assert.True(t, merged.ValidEmail)
+
+				_, err = repo.GetUser(ctx, "Jon@Test.com")
+				assert.ErrorIs(t, err, ErrNotFound)
+
+				listed, err := repo.ListDuplicates(ctx)
+				assert.Nil(t, err)
+				assert.Empty(t, listed)
+			})
+
+			t.Run("merge into an unrelated account", func(t *testing.T) {
+				_, err := repo.MergeUsers(ctx, "mary@test.com", "invalid", nil)
+				assert.ErrorIs(t, err, ErrExists)
+			})
+		})
+	}
+}
@@ -1,40 +1,145 @@
 package user
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"net/http"
+	"os"
+	"sync/atomic"
 	"time"
 
+	"github.com/pzolo85/todo-app/back/internal/apperr"
 	"github.com/pzolo85/todo-app/back/internal/claim"
+	"github.com/pzolo85/todo-app/back/internal/emailaddr"
+	"github.com/pzolo85/todo-app/back/internal/log"
 	"github.com/pzolo85/todo-app/back/internal/mail"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
 type DefaultHandler struct {
-	repo     Repo
-	logger   *slog.Logger
-	mailSvc  mail.Service
-	userRole string
+	repo            Repo
+	logger          *slog.Logger
+	mailSvc         mail.Service
+	adminRole       string
+	userRole        string
+	exporter        *Exporter
+	exportThreshold atomic.Int64
+	deletionGrace   atomic.Int64
+	emails          emailaddr.Normalizer
+}
+
+var (
+	ErrExportNotFound       = apperr.NotFound("export_not_found", "export not found")
+	ErrDeletionNotConfirmed = apperr.BadRequest("confirmation_required", "account deletion must be confirmed with confirm=true")
+
+	errMissingClaim = apperr.Internal(fmt.Errorf("user claim missing from context"))
+)
+
+type ExportResponse struct {
+	ExportID string `json:"export_id"`
+}
+
+type DeleteUserResponse struct {
+	DeleteAt time.Time `json:"delete_at"`
 }
 
 type UserCreateRequest struct {
-	Email      string `json:"email,omitempty"`
-	Salt       string `json:"salt,omitempty"`
-	HashedPass string `json:"hashed_pass,omitempty"`
+	Email      string `json:"email,omitempty" validate:"required,email,max=254" normalize:"email"`
+	Salt       string `json:"salt,omitempty" validate:"required,max=256"`
+	HashedPass string `json:"hashed_pass,omitempty" validate:"required,max=512"`
 }
+
 type ModifyUserRequest struct {
-	Email string `json:"email,omitempty"`
+	Email string `json:"email,omitempty" validate:"required,email,max=254" normalize:"email"`
 }
 
-func NewDefaultHandler(repo Repo, logger *slog.Logger, mailSvc mail.Service, userRole string) *DefaultHandler {
-	return &DefaultHandler{
-		repo:     repo,
-		logger:   logger.WithGroup("user_handler"),
-		mailSvc:  mailSvc,
-		userRole: userRole,
+type ValidateUserRequest struct {
+	Email     string `query:"email" validate:"required,email,max=254" normalize:"email"`
+	Challenge string `query:"challenge" validate:"required,max=128"`
+}
+
+// MergeUsersRequest names the stored keys of the accounts to merge, so they are not normalized.
+// Primary keeps its credentials and role.
+type MergeUsersRequest struct {
+	Primary    string   `json:"primary" validate:"required,max=254"`
+	Duplicates []string `json:"duplicates" validate:"required,min=1,dive,required,max=254"`
+}
+
+type DuplicatesResponse struct {
+	Duplicates map[string][]string `json:"duplicates"`
+}
+
+// AdminCreateUserRequest creates a user without the email challenge
+type AdminCreateUserRequest struct {
+	Email      string `json:"email" validate:"required,email,max=254" normalize:"email"`
+	Salt       string `json:"salt" validate:"required,max=256"`
+	HashedPass string `json:"hashed_pass" validate:"required,max=512"`
+	Admin      bool   `json:"admin"`
+	Verified   bool   `json:"verified"`
+}
+
+type SetPasswordRequest struct {
+	Email      string `json:"email" validate:"required,email,max=254" normalize:"email"`
+	Salt       string `json:"salt" validate:"required,max=256"`
+	HashedPass string `json:"hashed_pass" validate:"required,max=512"`
+}
+
+type ListUsersResponse struct {
+	Users []Summary `json:"users"`
+}
+
+type RevokeSessionsResponse struct {
+	Revoked int `json:"revoked"`
+}
+
+type CreateListRequest struct {
+	Name string `json:"name" validate:"required,max=256"`
+}
+
+type AddItemRequest struct {
+	Text string `json:"text" validate:"required,max=1024"`
+}
+
+type CheckItemRequest struct {
+	Done bool `json:"done"`
+}
+
+type ShareListRequest struct {
+	Email string `json:"email" validate:"required,email,max=254" normalize:"email"`
+}
+
+type ListsResponse struct {
+	Lists []*List `json:"lists"`
+}
+
+func NewDefaultHandler(repo Repo, logger *slog.Logger, mailSvc mail.Service, adminRole string, userRole string, exporter *Exporter, exportThreshold int, deletionGrace time.Duration, emails emailaddr.Normalizer) *DefaultHandler {
+	h := &DefaultHandler{
+		repo:      repo,
+		logger:    logger.WithGroup("user_handler"),
+		mailSvc:   mailSvc,
+		adminRole: adminRole,
+		userRole:  userRole,
+		exporter:  exporter,
+		emails:    emails,
 	}
+	h.SetLimits(exportThreshold, deletionGrace)
+	return h
+}
+
+// SetLimits changes the size of the largest export built in the request, and
+// the grace period of account deletions. It is safe to call while serving.
+func (h *DefaultHandler) SetLimits(exportThreshold int, deletionGrace time.Duration) {
+	h.exportThreshold.Store(int64(exportThreshold))
+	h.deletionGrace.Store(int64(deletionGrace))
+}
+
+// requestLogger returns the request logger, see log.Middleware
+func (h *DefaultHandler) requestLogger(c echo.Context) *slog.Logger {
+	return log.FromContext(c, h.logger, "user_handler")
 }
 
 func (h *DefaultHandler) AddHandler(userGroup *echo.Group, adminGroup *echo.Group, claimMW echo.MiddlewareFunc, validMW echo.MiddlewareFunc) {
@@ -43,22 +148,38 @@ func (h *DefaultHandler) AddHandler(userGroup *echo.Group, adminGroup *echo.Grou
 	userGroup.GET("/info", h.Info, claimMW, validMW)
 	userGroup.GET("/resend-challenge", h.ResendChallenge, claimMW)
 	userGroup.DELETE("/", h.DeleteUser, claimMW)
+	userGroup.GET("/export", h.Export, claimMW, validMW)
+	userGroup.GET("/export/:id", h.DownloadExport, claimMW, validMW)
+	userGroup.GET("/lists", h.ListLists, claimMW, validMW)
+	userGroup.POST("/lists", h.CreateList, claimMW, validMW)
+	userGroup.GET("/lists/:id", h.GetList, claimMW, validMW)
+	userGroup.POST("/lists/:id/items", h.AddItem, claimMW, validMW)
+	userGroup.PUT("/lists/:id/items/:item", h.CheckItem, claimMW, validMW)
+	userGroup.PUT("/lists/:id/share", h.ShareList, claimMW, validMW)
 
 	adminUserGroup := adminGroup.Group("/user")
 	adminUserGroup.PUT("/disable", h.DisableUser)
 	adminUserGroup.PUT("/make-admin", h.MakeAdmin)
 	adminUserGroup.PUT("/disable-admin", h.DisableAdmin)
+	adminUserGroup.GET("/duplicates", h.ListDuplicates)
+	adminUserGroup.POST("/merge", h.MergeUsers)
+	adminUserGroup.GET("/list", h.ListUsers)
+	adminUserGroup.POST("/create", h.AdminCreateUser)
+	adminUserGroup.PUT("/suspend", h.SuspendUser)
+	adminUserGroup.PUT("/resume", h.ResumeUser)
+	adminUserGroup.PUT("/password", h.SetPassword)
+	adminUserGroup.PUT("/revoke-sessions", h.RevokeSessions)
 }
 
 func (h *DefaultHandler) ResendChallenge(c echo.Context) error {
 	clm := c.Get(claim.UserClaimContextKey)
 	claim, ok := clm.(*claim.UserClaim)
 	if !ok {
-		h.logger.Error("failed to parse claim from context", "claim", clm)
-		return echo.NewHTTPError(http.StatusBadRequest)
+		h.requestLogger(c).Error("failed to parse claim from context", "claim", clm)
+		return errMissingClaim
 	}
 
-	err := h.mailSvc.SendChallenge(claim.Email)
+	err := h.mailSvc.SendChallenge(c.Request().Context(), claim.Email)
 	if err != nil {
 		return fmt.Errorf("failed to send challenge > %w", err)
 	}
@@ -71,32 +192,253 @@ func (h *DefaultHandler) Info(c echo.Context) error {
 
 	claim, ok := clm.(*claim.UserClaim)
 	if !ok {
-		h.logger.Error("failed to parse claim from context", "claim", clm)
-		return echo.NewHTTPError(http.StatusBadRequest)
+		h.requestLogger(c).Error("failed to parse claim from context", "claim", clm)
+		return errMissingClaim
 	}
 
-	u, err := h.repo.GetUser(claim.Email)
+	u, err := h.repo.GetUser(c.Request().Context(), claim.Email)
 	if err != nil {
-		h.logger.Error("failed to get user", "err", err.Error())
-		return echo.NewHTTPError(http.StatusBadGateway, err)
+		h.requestLogger(c).Error("failed to get user", "err", err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusOK, u)
 }
 
+func (h *DefaultHandler) Export(c echo.Context) error {
+	clm := c.Get(claim.UserClaimContextKey)
+
+	claim, ok := clm.(*claim.UserClaim)
+	if !ok {
+		h.requestLogger(c).Error("failed to parse claim from context", "claim", clm)
+		return errMissingClaim
+	}
+
+	u, err := h.repo.GetUser(c.Request().Context(), claim.Email)
+	if err != nil {
+		h.requestLogger(c).Error("failed to get user", "err", err.Error())
+		return err
+	}
+
+	lists, err := h.repo.ListLists(c.Request().Context(), claim.Email)
+	if err != nil {
+		h.requestLogger(c).Error("failed to list lists", "err", err.Error())
+		return err
+	}
+
+	exp := NewExport(u, lists)
+	if int64(exp.Size()) <= h.exportThreshold.Load() {
+		path, err := exp.ZipFile()
+		if err != nil {
+			h.requestLogger(c).Error("failed to build export", "err", err.Error())
+			return apperr.Internal(err)
+		}
+		defer os.Remove(path)
+		return h.sendExport(c, path)
+	}
+
+	// large accounts are built in the background and the link is sent by mail
+	exportID := h.exporter.Start(c.Request().Context(), h.requestLogger(c), exp)
+
+	return c.JSON(http.StatusAccepted, ExportResponse{
+		ExportID: exportID,
+	})
+}
+
+func (h *DefaultHandler) DownloadExport(c echo.Context) error {
+	clm := c.Get(claim.UserClaimContextKey)
+
+	claim, ok := clm.(*claim.UserClaim)
+	if !ok {
+		h.requestLogger(c).Error("failed to parse claim from context", "claim", clm)
+		return errMissingClaim
+	}
+
+	path, found := h.exporter.Get(c.Param("id"), claim.Email)
+	if !found {
+		h.requestLogger(c).Warn("export not found", "email", claim.Email, "export_id", c.Param("id"))
+		return ErrExportNotFound
+	}
+
+	return h.sendExport(c, path)
+}
+
+// sendExport streams the archive at path. An archive that expired meanwhile is
+// still sent, it is only unlinked.
+func (h *DefaultHandler) sendExport(c echo.Context, path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrExportNotFound
+	}
+	if err != nil {
+		h.requestLogger(c).Error("failed to open export", "err", err.Error())
+		return apperr.Internal(err)
+	}
+	defer f.Close()
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="export.zip"`)
+	return c.Stream(http.StatusOK, "application/zip", f)
+}
+
+// userClaim returns the claim added by the claim middleware
+func (h *DefaultHandler) userClaim(c echo.Context) (*claim.UserClaim, error) {
+	clm := c.Get(claim.UserClaimContextKey)
+	claim, ok := clm.(*claim.UserClaim)
+	if !ok {
+		h.requestLogger(c).Error("failed to parse claim from context", "claim", clm)
+		return nil, errMissingClaim
+	}
+	return claim, nil
+}
+
+func (h *DefaultHandler) ListLists(c echo.Context) error {
+	claim, err := h.userClaim(c)
+	if err != nil {
+		return err
+	}
+
+	lists, err := h.repo.ListLists(c.Request().Context(), claim.Email)
+	if err != nil {
+		h.requestLogger(c).Error("failed to list lists", "err", err.Error())
+		return err
+	}
+
+	return c.JSON(http.StatusOK, ListsResponse{Lists: lists})
+}
+
+func (h *DefaultHandler) CreateList(c echo.Context) error {
+	claim, err := h.userClaim(c)
+	if err != nil {
+		return err
+	}
+
+	var req CreateListRequest
+	if err := c.Bind(&req); err != nil {
+		h.requestLogger(c).Warn("failed to decode create list request", "err", err.Error())
+		return err
+	}
+
+	l, err := h.repo.CreateList(c.Request().Context(), claim.Email, req.Name)
+	if err != nil {
+		h.requestLogger(c).Error("failed to create list", "err", err.Error())
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, l)
+}
+
+func (h *DefaultHandler) GetList(c echo.Context) error {
+	claim, err := h.userClaim(c)
+	if err != nil {
+		return err
+	}
+
+	l, err := h.repo.GetList(c.Request().Context(), claim.Email, c.Param("id"))
+	if err != nil {
+		h.requestLogger(c).Warn("failed to get list", "err", err.Error())
+		return err
+	}
+
+	return c.JSON(http.StatusOK, l)
+}
+
+func (h *DefaultHandler) AddItem(c echo.Context) error {
+	claim, err := h.userClaim(c)
+	if err != nil {
+		return err
+	}
+
+	var req AddItemRequest
+	if err := c.Bind(&req); err != nil {
+		h.requestLogger(c).Warn("failed to decode add item request", "err", err.Error())
+		return err
+	}
+
+	l, err := h.repo.UpdateList(c.Request().Context(), claim.Email, c.Param("id"), func(l *List) error {
+		l.Items = append(l.Items, Item{
+			ID:        uuid.NewString(),
+			Text:      req.Text,
+			CreatedAt: time.Now(),
+		})
+		return nil
+	})
+	if err != nil {
+		h.requestLogger(c).Warn("failed to add item", "err", err.Error())
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, l)
+}
+
+// CheckItem checks off an item of the list, or unchecks it
+func (h *DefaultHandler) CheckItem(c echo.Context) error {
+	claim, err := h.userClaim(c)
+	if err != nil {
+		return err
+	}
+
+	var req CheckItemRequest
+	if err := c.Bind(&req); err != nil {
+		h.requestLogger(c).Warn("failed to decode check item request", "err", err.Error())
+		return err
+	}
+
+	l, err := h.repo.UpdateList(c.Request().Context(), claim.Email, c.Param("id"), func(l *List) error {
+		item, err := l.Item(c.Param("item"))
+		if err != nil {
+			return err
+		}
+		item.Done = req.Done
+		return nil
+	})
+	if err != nil {
+		h.requestLogger(c).Warn("failed to check item", "err", err.Error())
+		return err
+	}
+
+	return c.JSON(http.StatusOK, l)
+}
+
+func (h *DefaultHandler) ShareList(c echo.Context) error {
+	claim, err := h.userClaim(c)
+	if err != nil {
+		return err
+	}
+
+	var req ShareListRequest
+	if err := c.Bind(&req); err != nil {
+		h.requestLogger(c).Warn("failed to decode share list request", "err", err.Error())
+		return err
+	}
+
+	l, err := h.repo.ShareList(c.Request().Context(), claim.Email, c.Param("id"), req.Email)
+	if err != nil {
+		h.requestLogger(c).Warn("failed to share list", "err", err.Error())
+		return err
+	}
+
+	h.requestLogger(c).Info("list shared", "list", l.ID, "with", req.Email)
+	return c.JSON(http.StatusOK, l)
+}
+
 func (h *DefaultHandler) ValidateUser(c echo.Context) error {
-	email := c.QueryParam("email")
-	challenge := c.QueryParam("challenge")
-	err := h.mailSvc.VerifyChallenge(email, challenge)
+	var req ValidateUserRequest
+	err := c.Bind(&req)
+	if err != nil {
+		h.requestLogger(c).Warn("failed to decode validate user request", "err", err.Error())
+		return err
+	}
+
+	err = h.mailSvc.VerifyChallenge(c.Request().Context(), req.Email, req.Challenge)
 	if err != nil {
-		h.logger.Warn("invalid challenge validation", "email", email, "challenge", challenge)
-		return echo.NewHTTPError(http.StatusBadRequest, "invalid challenge validation")
+		h.requestLogger(c).Warn("invalid challenge validation", "email", req.Email, "challenge", req.Challenge)
+		return err
 	}
 
-	err = h.repo.EnableUser(email)
+	err = h.repo.EnableUser(c.Request().Context(), req.Email)
 	if err != nil {
-		h.logger.Error("failed to enable user", "err", err.Error())
-		return echo.NewHTTPError(http.StatusBadGateway, err)
+		h.requestLogger(c).Error("failed to enable user", "err", err.Error())
+		return err
 	}
 
 	return c.NoContent(http.StatusOK)
@@ -106,14 +448,14 @@ func (h *DefaultHandler) MakeAdmin(c echo.Context) error {
 	var req ModifyUserRequest
 	err := c.Bind(&req)
 	if err != nil {
-		h.logger.Error("failed to decode modify user request", "err", err.Error())
-		return echo.NewHTTPError(http.StatusBadRequest, err)
+		h.requestLogger(c).Warn("failed to decode modify user request", "err", err.Error())
+		return err
 	}
 
-	err = h.repo.MakeAdmin(req.Email)
+	err = h.repo.MakeAdmin(c.Request().Context(), req.Email)
 	if err != nil {
-		h.logger.Error("failed to make user admin", "err", err.Error())
-		return echo.NewHTTPError(http.StatusBadGateway, err)
+		h.requestLogger(c).Error("failed to make user admin", "err", err.Error())
+		return err
 	}
 
 	return nil
@@ -123,14 +465,14 @@ func (h *DefaultHandler) DisableUser(c echo.Context) error {
 	var req ModifyUserRequest
 	err := c.Bind(&req)
 	if err != nil {
-		h.logger.Error("failed to decode user create request", "err", err.Error())
-		return echo.NewHTTPError(http.StatusBadRequest, err)
+		h.requestLogger(c).Warn("failed to decode user create request", "err", err.Error())
+		return err
 	}
 
-	err = h.repo.DisableUser(req.Email)
+	err = h.repo.DisableUser(c.Request().Context(), req.Email)
 	if err != nil {
-		h.logger.Error("failed to disable user", "err", err.Error())
-		return echo.NewHTTPError(http.StatusBadGateway, err)
+		h.requestLogger(c).Error("failed to disable user", "err", err.Error())
+		return err
 	}
 
 	return nil
@@ -140,44 +482,212 @@ func (h *DefaultHandler) DisableAdmin(c echo.Context) error {
 	var req ModifyUserRequest
 	err := c.Bind(&req)
 	if err != nil {
-		h.logger.Error("failed to decode user modify request", "err", err.Error())
-		return echo.NewHTTPError(http.StatusBadRequest, err)
+		h.requestLogger(c).Warn("failed to decode user modify request", "err", err.Error())
+		return err
+	}
+
+	err = h.repo.DisableAdmin(c.Request().Context(), req.Email)
+	if err != nil {
+		h.requestLogger(c).Error("failed to disable admin access", "err", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (h *DefaultHandler) ListDuplicates(c echo.Context) error {
+	duplicates, err := h.repo.ListDuplicates(c.Request().Context())
+	if err != nil {
+		h.requestLogger(c).Error("failed to list duplicate users", "err", err.Error())
+		return err
+	}
+
+	return c.JSON(http.StatusOK, DuplicatesResponse{
+		Duplicates: duplicates,
+	})
+}
+
+func (h *DefaultHandler) MergeUsers(c echo.Context) error {
+	var req MergeUsersRequest
+	err := c.Bind(&req)
+	if err != nil {
+		h.requestLogger(c).Warn("failed to decode merge users request", "err", err.Error())
+		return err
+	}
+
+	canonical, err := h.emails.Normalize(req.Primary)
+	if err != nil {
+		return ErrNotDuplicate.Wrap(err)
+	}
+	for _, d := range req.Duplicates {
+		if d == req.Primary || !h.emails.Equal(d, canonical) {
+			h.requestLogger(c).Warn("merge of unrelated accounts", "primary", req.Primary, "duplicate", d)
+			return ErrNotDuplicate
+		}
+	}
+
+	merged, err := h.repo.MergeUsers(c.Request().Context(), canonical, req.Primary, req.Duplicates)
+	if err != nil {
+		h.requestLogger(c).Error("failed to merge users", "err", err.Error())
+		return err
+	}
+
+	h.requestLogger(c).Info("users merged", "email", canonical, "primary", req.Primary, "duplicates", req.Duplicates)
+	return c.JSON(http.StatusOK, merged)
+}
+
+func (h *DefaultHandler) ListUsers(c echo.Context) error {
+	users, err := h.repo.ListUsers(c.Request().Context())
+	if err != nil {
+		h.requestLogger(c).Error("failed to list users", "err", err.Error())
+		return err
+	}
+
+	res := ListUsersResponse{Users: make([]Summary, 0, len(users))}
+	for _, u := range users {
+		res.Users = append(res.Users, u.Summary())
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *DefaultHandler) AdminCreateUser(c echo.Context) error {
+	var req AdminCreateUserRequest
+	err := c.Bind(&req)
+	if err != nil {
+		h.requestLogger(c).Warn("failed to decode admin create user request", "err", err.Error())
+		return err
+	}
+
+	role := h.userRole
+	if req.Admin {
+		role = h.adminRole
+	}
+
+	var user = User{
+		Email:        req.Email,
+		PassHash:     req.HashedPass,
+		Salt:         req.Salt,
+		Role:         role,
+		CreatedAt:    time.Now(),
+		ValidEmail:   req.Verified,
+		ActiveJWT:    []string{},
+		Notes:        []string{},
+		SharedWithMe: []string{},
+	}
+	err = h.repo.SaveUser(c.Request().Context(), &user, false)
+	if err != nil {
+		h.requestLogger(c).Error("failed to save user to db", "err", err.Error())
+		return err
+	}
+
+	h.requestLogger(c).Info("user created by admin", "email", req.Email, "admin", req.Admin)
+	return c.JSON(http.StatusOK, user.Summary())
+}
+
+func (h *DefaultHandler) SuspendUser(c echo.Context) error {
+	var req ModifyUserRequest
+	err := c.Bind(&req)
+	if err != nil {
+		h.requestLogger(c).Warn("failed to decode user modify request", "err", err.Error())
+		return err
+	}
+
+	err = h.repo.SuspendUser(c.Request().Context(), req.Email)
+	if err != nil {
+		h.requestLogger(c).Error("failed to suspend user", "err", err.Error())
+		return err
+	}
+
+	h.requestLogger(c).Info("user suspended", "email", req.Email)
+	return nil
+}
+
+func (h *DefaultHandler) ResumeUser(c echo.Context) error {
+	var req ModifyUserRequest
+	err := c.Bind(&req)
+	if err != nil {
+		h.requestLogger(c).Warn("failed to decode user modify request", "err", err.Error())
+		return err
+	}
+
+	err = h.repo.ResumeUser(c.Request().Context(), req.Email)
+	if err != nil {
+		h.requestLogger(c).Error("failed to resume user", "err", err.Error())
+		return err
+	}
+
+	h.requestLogger(c).Info("user resumed", "email", req.Email)
+	return nil
+}
+
+func (h *DefaultHandler) SetPassword(c echo.Context) error {
+	var req SetPasswordRequest
+	err := c.Bind(&req)
+	if err != nil {
+		h.requestLogger(c).Warn("failed to decode set password request", "err", err.Error())
+		return err
 	}
 
-	err = h.repo.DisableAdmin(req.Email)
+	err = h.repo.SetPassword(c.Request().Context(), req.Email, req.Salt, req.HashedPass)
 	if err != nil {
-		h.logger.Error("failed to disable admin access", "err", err.Error())
-		return echo.NewHTTPError(http.StatusBadGateway, err)
+		h.requestLogger(c).Error("failed to set password", "err", err.Error())
+		return err
 	}
 
+	h.requestLogger(c).Info("password reset by admin", "email", req.Email)
 	return nil
 }
 
+func (h *DefaultHandler) RevokeSessions(c echo.Context) error {
+	var req ModifyUserRequest
+	err := c.Bind(&req)
+	if err != nil {
+		h.requestLogger(c).Warn("failed to decode user modify request", "err", err.Error())
+		return err
+	}
+
+	revoked, err := h.repo.RevokeSessions(c.Request().Context(), req.Email)
+	if err != nil {
+		h.requestLogger(c).Error("failed to revoke sessions", "err", err.Error())
+		return err
+	}
+
+	h.requestLogger(c).Info("sessions revoked", "email", req.Email, "revoked", revoked)
+	return c.JSON(http.StatusOK, RevokeSessionsResponse{Revoked: revoked})
+}
+
 func (h *DefaultHandler) DeleteUser(c echo.Context) error {
 	clm := c.Get(claim.UserClaimContextKey)
 
 	claim, ok := clm.(*claim.UserClaim)
 	if !ok {
-		h.logger.Error("failed to parse claim from context", "claim", clm)
-		return echo.NewHTTPError(http.StatusBadRequest)
+		h.requestLogger(c).Error("failed to parse claim from context", "claim", clm)
+		return errMissingClaim
 	}
 
-	err := h.repo.DeleteUser(claim.Email)
-	if err != nil {
-		h.logger.Error("failed to delete user", "err", err.Error())
-		return echo.NewHTTPError(http.StatusBadGateway, err)
+	if c.QueryParam("confirm") != "true" {
+		return ErrDeletionNotConfirmed
 	}
 
-	return nil
+	deleteAt := time.Now().Add(time.Duration(h.deletionGrace.Load()))
+	err := h.repo.MarkForDeletion(c.Request().Context(), claim.Email, deleteAt)
+	if err != nil {
+		h.requestLogger(c).Error("failed to mark user for deletion", "err", err.Error())
+		return err
+	}
 
+	h.requestLogger(c).Info("user marked for deletion", "email", claim.Email, "delete_at", deleteAt)
+	return c.JSON(http.StatusAccepted, DeleteUserResponse{
+		DeleteAt: deleteAt,
+	})
 }
 
 func (h *DefaultHandler) CreateUser(c echo.Context) error {
 	var req UserCreateRequest
 	err := c.Bind(&req)
 	if err != nil {
-		h.logger.Error("failed to decode user create request", "err", err.Error())
-		return echo.NewHTTPError(http.StatusBadRequest, err)
+		h.requestLogger(c).Warn("failed to decode user create request", "err", err.Error())
+		return err
 	}
 
 	var user = User{
@@ -192,16 +702,16 @@ func (h *DefaultHandler) CreateUser(c echo.Context) error {
 		SharedWithMe: []string{},
 	}
 
-	err = h.mailSvc.SendChallenge(req.Email)
+	err = h.mailSvc.SendChallenge(c.Request().Context(), req.Email)
 	if err != nil {
-		h.logger.Error("failed to send email challenge", "err", err.Error())
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		h.requestLogger(c).Error("failed to send email challenge", "err", err.Error())
+		return err
 	}
 
-	err = h.repo.SaveUser(&user, false)
+	err = h.repo.SaveUser(c.Request().Context(), &user, false)
 	if err != nil {
-		h.logger.Error("failed to save user to db", "err", err.Error())
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		h.requestLogger(c).Error("failed to save user to db", "err", err.Error())
+		return err
 	}
 
 	return c.JSON(http.StatusOK, user)
@@ -0,0 +1,323 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/apperr"
+	"github.com/pzolo85/todo-app/back/internal/claim"
+	"github.com/pzolo85/todo-app/back/internal/config"
+	"github.com/pzolo85/todo-app/back/internal/emailaddr"
+	"github.com/pzolo85/todo-app/back/internal/mail"
+	"github.com/pzolo85/todo-app/back/internal/storage"
+	"github.com/pzolo85/todo-app/back/internal/validate"
+
+	"github.com/labstack/echo/v4"
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+)
+
+// mailbox is a mail.Transport that queues the mails
+type mailbox chan mail.Mail
+
+func (m mailbox) Send(ctx context.Context, ml mail.Mail) error {
+	m <- ml
+	return nil
+}
+
+func newTestMailService(transport mail.Transport) *mail.DefaultService {
+	return mail.NewDefaultService(slog.Default(), cache.New(time.Hour, time.Hour), config.Defaults(), transport)
+}
+
+type testHandler struct {
+	*DefaultHandler
+	repo     *DefaultRepo
+	exporter *Exporter
+	mails    mailbox
+	echo     *echo.Echo
+}
+
+func newTestHandler(t *testing.T, exportThreshold int) *testHandler {
+	store, err := storage.OpenBolt(filepath.Join(t.TempDir(), "test.bolt"), storage.Options{})
+	assert.Nil(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	repo, err := NewDefaultRepo(store, cache.New(time.Hour, time.Hour), "admin", "user")
+	assert.Nil(t, err)
+
+	mails := make(mailbox, 10)
+	mailSvc := newTestMailService(mails)
+	exporter := NewExporter(cache.New(time.Hour, time.Hour), mailSvc)
+	t.Cleanup(func() { exporter.Shutdown(context.Background()) })
+
+	e := echo.New()
+	e.Binder = validate.NewBinder(emailaddr.Default)
+
+	return &testHandler{
+		DefaultHandler: NewDefaultHandler(repo, slog.Default(), mailSvc, "admin", "user", exporter, exportThreshold, time.Hour, emailaddr.Default),
+		repo:           repo,
+		exporter:       exporter,
+		mails:          mails,
+		echo:           e,
+	}
+}
+
+// serve runs handler with the claim of email, unless it is empty, and the path params
+func (h *testHandler) serve(handler echo.HandlerFunc, method string, body string, email string, params ...string) (*httptest.ResponseRecorder, error) {
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	c := h.echo.NewContext(req, rec)
+	if email != "" {
+		c.Set(claim.UserClaimContextKey, &claim.UserClaim{Email: email})
+	}
+	var names, values []string
+	for i := 0; i+1 < len(params); i += 2 {
+		names = append(names, params[i])
+		values = append(values, params[i+1])
+	}
+	c.SetParamNames(names...)
+	c.SetParamValues(values...)
+	return rec, handler(c)
+}
+
+func TestHandler_Export(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("small export", func(t *testing.T) {
+		h := newTestHandler(t, 10)
+		assert.Nil(t, h.repo.SaveUser(ctx, newTestUser("jon@test.com"), false))
+
+		rec, err := h.serve(h.Export, http.MethodGet, "", "jon@test.com")
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/zip", rec.Header().Get(echo.HeaderContentType))
+		assert.Empty(t, h.mails)
+	})
+
+	t.Run("large export", func(t *testing.T) {
+		h := newTestHandler(t, 0)
+		assert.Nil(t, h.repo.SaveUser(ctx, newTestUser("jon@test.com"), false))
+		_, err := h.repo.CreateList(ctx, "jon@test.com", "groceries")
+		assert.Nil(t, err)
+
+		rec, err := h.serve(h.Export, http.MethodGet, "", "jon@test.com")
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Contains(t, rec.Body.String(), "export_id")
+
+		m := <-h.mails
+		assert.Equal(t, "jon@test.com", m.To)
+		exportID := m.Link[strings.LastIndex(m.Link, "/")+1:]
+		assert.Contains(t, rec.Body.String(), exportID)
+
+		rec, err = h.serve(h.DownloadExport, http.MethodGet, "", "jon@test.com", "id", exportID)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/zip", rec.Header().Get(echo.HeaderContentType))
+
+		// the archive of another user is not found
+		_, err = h.serve(h.DownloadExport, http.MethodGet, "", "mary@test.com", "id", exportID)
+		assert.ErrorIs(t, err, ErrExportNotFound)
+
+		_, err = h.serve(h.DownloadExport, http.MethodGet, "", "jon@test.com", "id", "unknown")
+		assert.ErrorIs(t, err, ErrExportNotFound)
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		h := newTestHandler(t, 10)
+		_, err := h.serve(h.Export, http.MethodGet, "", "jon@test.com")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("missing claim", func(t *testing.T) {
+		h := newTestHandler(t, 10)
+		_, err := h.serve(h.Export, http.MethodGet, "", "")
+		assert.ErrorIs(t, err, errMissingClaim)
+	})
+}
+
+func TestHandler_Admin(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHandler(t, 10)
+	jon := newTestUser("jon@test.com")
+	jon.ActiveJWT = []string{"t1", "t2"}
+	assert.Nil(t, h.repo.SaveUser(ctx, jon, false))
+
+	t.Run("create", func(t *testing.T) {
+		rec, err := h.serve(h.AdminCreateUser, http.MethodPost, `{"email":"Mary@Test.com","salt":"s","hashed_pass":"h","admin":true,"verified":true}`, "root@test.com")
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var summary Summary
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &summary))
+		assert.Equal(t, "mary@test.com", summary.Email)
+		assert.Equal(t, "admin", summary.Role)
+		assert.True(t, summary.ValidEmail)
+
+		mary, err := h.repo.GetUser(ctx, "mary@test.com")
+		assert.Nil(t, err)
+		assert.Equal(t, "admin", mary.Role)
+		assert.Equal(t, "h", mary.PassHash)
+
+		rec, err = h.serve(h.AdminCreateUser, http.MethodPost, `{"email":"ana@test.com","salt":"s","hashed_pass":"h"}`, "root@test.com")
+		assert.Nil(t, err)
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &summary))
+		assert.Equal(t, "user", summary.Role)
+		assert.False(t, summary.ValidEmail)
+
+		_, err = h.serve(h.AdminCreateUser, http.MethodPost, `{"email":"jon@test.com","salt":"s","hashed_pass":"h"}`, "root@test.com")
+		assert.ErrorIs(t, err, ErrExists)
+
+		_, err = h.serve(h.AdminCreateUser, http.MethodPost, `{"email":"not-an-email","salt":"s"}`, "root@test.com")
+		var appErr *apperr.Error
+		assert.True(t, errors.As(err, &appErr))
+		assert.Equal(t, apperr.KindValidation, appErr.Kind)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		rec, err := h.serve(h.ListUsers, http.MethodGet, "", "root@test.com")
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var res ListUsersResponse
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		emails := []string{}
+		for _, u := range res.Users {
+			emails = append(emails, u.Email)
+		}
+		assert.ElementsMatch(t, []string{"jon@test.com", "mary@test.com", "ana@test.com"}, emails)
+		assert.NotContains(t, rec.Body.String(), "hash")
+	})
+
+	t.Run("suspend and resume", func(t *testing.T) {
+		_, err := h.serve(h.SuspendUser, http.MethodPost, `{"email":"Jon@Test.com"}`, "root@test.com")
+		assert.Nil(t, err)
+		u, err := h.repo.GetUser(ctx, "jon@test.com")
+		assert.Nil(t, err)
+		assert.True(t, u.Suspended)
+		assert.Empty(t, u.ActiveJWT)
+
+		_, err = h.serve(h.ResumeUser, http.MethodPost, `{"email":"jon@test.com"}`, "root@test.com")
+		assert.Nil(t, err)
+		u, err = h.repo.GetUser(ctx, "jon@test.com")
+		assert.Nil(t, err)
+		assert.False(t, u.Suspended)
+
+		_, err = h.serve(h.SuspendUser, http.MethodPost, `{"email":"nobody@test.com"}`, "root@test.com")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("set password", func(t *testing.T) {
+		_, err := h.repo.UpdateUser(ctx, "jon@test.com", func(u *User) error {
+			u.ActiveJWT = []string{"t3"}
+			return nil
+		})
+		assert.Nil(t, err)
+
+		_, err = h.serve(h.SetPassword, http.MethodPost, `{"email":"jon@test.com","salt":"s2","hashed_pass":"h2"}`, "root@test.com")
+		assert.Nil(t, err)
+		u, err := h.repo.GetUser(ctx, "jon@test.com")
+		assert.Nil(t, err)
+		assert.Equal(t, "s2", u.Salt)
+		assert.Equal(t, "h2", u.PassHash)
+		assert.Empty(t, u.ActiveJWT)
+
+		_, err = h.serve(h.SetPassword, http.MethodPost, `{"email":"jon@test.com"}`, "root@test.com")
+		var appErr *apperr.Error
+		assert.True(t, errors.As(err, &appErr))
+		assert.Equal(t, apperr.KindValidation, appErr.Kind)
+	})
+
+	t.Run("revoke sessions", func(t *testing.T) {
+		_, err := h.repo.UpdateUser(ctx, "jon@test.com", func(u *User) error {
+			u.ActiveJWT = []string{"t4", "t5"}
+			return nil
+		})
+		assert.Nil(t, err)
+
+		rec, err := h.serve(h.RevokeSessions, http.MethodPost, `{"email":"jon@test.com"}`, "root@test.com")
+		assert.Nil(t, err)
+		var res RevokeSessionsResponse
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, 2, res.Revoked)
+
+		u, err := h.repo.GetUser(ctx, "jon@test.com")
+		assert.Nil(t, err)
+		assert.Empty(t, u.ActiveJWT)
+	})
+}
+
+func TestHandler_Lists(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHandler(t, 10)
+	for _, email := range []string{"jon@test.com", "mary@test.com"} {
+		assert.Nil(t, h.repo.SaveUser(ctx, newTestUser(email), false))
+	}
+
+	rec, err := h.serve(h.CreateList, http.MethodPost, `{"name":"groceries"}`, "jon@test.com")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var l List
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &l))
+	assert.Equal(t, "groceries", l.Name)
+
+	t.Run("add and check items", func(t *testing.T) {
+		rec, err := h.serve(h.AddItem, http.MethodPost, `{"text":"milk"}`, "jon@test.com", "id", l.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &l))
+		assert.Len(t, l.Items, 1)
+		assert.False(t, l.Items[0].Done)
+
+		rec, err = h.serve(h.CheckItem, http.MethodPut, `{"done":true}`, "jon@test.com", "id", l.ID, "item", l.Items[0].ID)
+		assert.Nil(t, err)
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &l))
+		assert.True(t, l.Items[0].Done)
+
+		_, err = h.serve(h.CheckItem, http.MethodPut, `{"done":true}`, "jon@test.com", "id", l.ID, "item", "unknown")
+		assert.ErrorIs(t, err, ErrItemNotFound)
+
+		_, err = h.serve(h.AddItem, http.MethodPost, `{"text":""}`, "jon@test.com", "id", l.ID)
+		var appErr *apperr.Error
+		assert.True(t, errors.As(err, &appErr))
+		assert.Equal(t, apperr.KindValidation, appErr.Kind)
+	})
+
+	t.Run("share", func(t *testing.T) {
+		_, err := h.serve(h.GetList, http.MethodGet, "", "mary@test.com", "id", l.ID)
+		assert.ErrorIs(t, err, ErrListNotFound)
+
+		rec, err := h.serve(h.ShareList, http.MethodPut, `{"email":"Mary@Test.com"}`, "jon@test.com", "id", l.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		rec, err = h.serve(h.ListLists, http.MethodGet, "", "mary@test.com")
+		assert.Nil(t, err)
+		var res ListsResponse
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Len(t, res.Lists, 1)
+		assert.Equal(t, l.ID, res.Lists[0].ID)
+
+		// readers check items off, only the owner shares
+		_, err = h.serve(h.CheckItem, http.MethodPut, `{"done":false}`, "mary@test.com", "id", l.ID, "item", l.Items[0].ID)
+		assert.Nil(t, err)
+
+		_, err = h.serve(h.ShareList, http.MethodPut, `{"email":"jon@test.com"}`, "mary@test.com", "id", l.ID)
+		assert.ErrorIs(t, err, ErrNotListOwner)
+	})
+
+	t.Run("missing claim", func(t *testing.T) {
+		_, err := h.serve(h.ListLists, http.MethodGet, "", "")
+		assert.ErrorIs(t, err, errMissingClaim)
+	})
+}
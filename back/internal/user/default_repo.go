@@ -1,23 +1,44 @@
 package user
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/boltdb/bolt"
+	"github.com/pzolo85/todo-app/back/internal/apperr"
+	"github.com/pzolo85/todo-app/back/internal/storage"
+	"github.com/pzolo85/todo-app/back/internal/tracing"
+
 	"github.com/patrickmn/go-cache"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/pzolo85/todo-app/back/internal/user")
+
 type DefaultRepo struct {
-	db        *bolt.DB
+	store     storage.Store
 	cache     *cache.Cache
+	cacheMu   sync.Mutex
+	hits      atomic.Uint64
+	misses    atomic.Uint64
 	adminRole string
 	userRole  string
+	// deletions counts the cache deletions, it is guarded by cacheMu
+	deletions uint64
 }
 
 var (
 	UserBucket = []byte("user")
+
+	ErrNotFound = apperr.NotFound("user_not_found", "user not found")
+	ErrExists   = apperr.Conflict("user_exists", "user already exists")
+	ErrConflict = apperr.Conflict("user_conflict", "user was modified concurrently")
 )
 
 type User struct {
@@ -30,158 +51,408 @@ type User struct {
 	ActiveJWT    []string  `json:"active_jwt,omitempty"`
 	Notes        []string  `json:"notes,omitempty"`
 	SharedWithMe []string  `json:"shared_with_me,omitempty"`
+	// DeleteAt is set while the account is pending deletion
+	DeleteAt *time.Time `json:"delete_at,omitempty"`
+	// Suspended accounts cannot log in, see SuspendUser
+	Suspended bool `json:"suspended,omitempty"`
+	// Revision is increased on every write, a save with a stale revision fails with ErrConflict
+	Revision uint64 `json:"revision"`
 }
 
-func NewDefaultRepo(db *bolt.DB, cache *cache.Cache, adminRole string, userRole string) (*DefaultRepo, error) {
-	err := db.Update(func(tx *bolt.Tx) error {
-		if _, err := tx.CreateBucketIfNotExists(UserBucket); err != nil {
-			return err
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// Clone returns a deep copy of u
+func (u *User) Clone() *User {
+	c := *u
+	c.ActiveJWT = slices.Clone(u.ActiveJWT)
+	c.Notes = slices.Clone(u.Notes)
+	c.SharedWithMe = slices.Clone(u.SharedWithMe)
+	if u.DeleteAt != nil {
+		deleteAt := *u.DeleteAt
+		c.DeleteAt = &deleteAt
+	}
+	return &c
+}
+
+func NewDefaultRepo(store storage.Store, cache *cache.Cache, adminRole string, userRole string) (*DefaultRepo, error) {
+	err := store.Update(func(tx storage.Tx) error {
+		for _, bucket := range [][]byte{UserBucket, DuplicateBucket, ListBucket} {
+			if err := tx.CreateBucket(bucket); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
 	return &DefaultRepo{
-		db:        db,
+		store:     store,
 		cache:     cache,
 		adminRole: adminRole,
 		userRole:  userRole,
 	}, err
 }
 
-func (r *DefaultRepo) GetUser(email string) (*User, error) {
-	var user User
+// NewReadOnlyRepo returns a repo over a store opened read-only, the buckets are not
+// created and every write fails
+func NewReadOnlyRepo(store storage.Store, cache *cache.Cache, adminRole string, userRole string) *DefaultRepo {
+	return &DefaultRepo{
+		store:     store,
+		cache:     cache,
+		adminRole: adminRole,
+		userRole:  userRole,
+	}
+}
+
+// GetUser returns a copy of the user, changes must be stored with SaveUser or UpdateUser
+func (r *DefaultRepo) GetUser(ctx context.Context, email string) (*User, error) {
 	cachedUser, found := r.cache.Get(email)
 	if found {
-		return cachedUser.(*User), nil
+		r.hits.Add(1)
+		return cachedUser.(*User).Clone(), nil
 	}
-
-	err := r.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(UserBucket)
-		if b == nil {
-			return fmt.Errorf("user bucket not found")
-		}
-
-		userBytes := b.Get([]byte(email))
-		if userBytes == nil {
-			return fmt.Errorf("user not found")
-		}
-
-		err := json.Unmarshal(userBytes, &user)
-		if err != nil {
-			return fmt.Errorf("failed to unmarshal user > %w", err)
-		}
-
-		return nil
+	r.misses.Add(1)
+
+	generation := r.cacheGeneration()
+	var user *User
+	err := r.view(ctx, "GetUser", email, func(tx storage.Tx) error {
+		var err error
+		user, err = getUser(tx, email)
+		return err
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user from db > %w", err)
 	}
 
-	r.cache.Set(email, &user, cache.DefaultExpiration)
-	return &user, err
+	r.cachePut(user, generation)
+	return user.Clone(), nil
 }
 
-func (r *DefaultRepo) SaveUser(u *User, force bool) error {
-	r.cache.Delete(u.Email)
-	key := []byte(u.Email)
+func (r *DefaultRepo) CacheStats() CacheStats {
+	return CacheStats{
+		Hits:   r.hits.Load(),
+		Misses: r.misses.Load(),
+	}
+}
 
-	err := r.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(UserBucket)
-		if b == nil {
-			return fmt.Errorf("user bucket not found")
-		}
+// cacheGeneration returns the number of cache deletions so far. It is read
+// before the db, and handed to cachePut with the user read or written.
+func (r *DefaultRepo) cacheGeneration() uint64 {
+	r.cacheMu.Lock()
+	defer r.cacheMu.Unlock()
 
-		// Try to create a user with only email set to delete existing user
-		if u.CreatedAt.IsZero() {
-			return b.Delete(key)
-		}
+	return r.deletions
+}
 
-		existing := b.Get(key)
-		if existing != nil && !force {
-			return fmt.Errorf("user %s already exists", u.Email)
-		}
+// cachePut stores a copy of u unless the cache already holds a newer revision,
+// so a slow reader cannot overwrite the result of a later write. If a user was
+// deleted since generation, u may be that user and is evicted instead, or a
+// purged account would come back from the cache.
+func (r *DefaultRepo) cachePut(u *User, generation uint64) {
+	r.cacheMu.Lock()
+	defer r.cacheMu.Unlock()
+
+	if r.deletions != generation {
+		r.cache.Delete(u.Email)
+		return
+	}
+	if cached, found := r.cache.Get(u.Email); found && cached.(*User).Revision > u.Revision {
+		return
+	}
+	r.cache.Set(u.Email, u.Clone(), cache.DefaultExpiration)
+}
 
-		userBytes, err := json.Marshal(u)
-		if err != nil {
-			return fmt.Errorf("failed to marshal user > %w", err)
-		}
+func (r *DefaultRepo) cacheDelete(email string) {
+	r.cacheMu.Lock()
+	defer r.cacheMu.Unlock()
 
-		return b.Put([]byte(u.Email), userBytes)
-	})
-	if err != nil {
-		return fmt.Errorf("failed to store user in db > %w", err)
-	}
+	r.deletions++
+	r.cache.Delete(email)
+}
 
-	return nil
+// view runs fn in a read transaction traced as op
+func (r *DefaultRepo) view(ctx context.Context, op string, email string, fn func(tx storage.Tx) error) error {
+	span := r.startSpan(ctx, op, email)
+	err := r.store.View(fn)
+	tracing.End(span, err)
+	return err
+}
+
+// update runs fn in a write transaction traced as op
+func (r *DefaultRepo) update(ctx context.Context, op string, email string, fn func(tx storage.Tx) error) error {
+	span := r.startSpan(ctx, op, email)
+	err := r.store.Update(fn)
+	tracing.End(span, err)
+	return err
 }
 
-func (r *DefaultRepo) DeleteUser(email string) error {
-	u := &User{
-		Email: email,
+func (r *DefaultRepo) startSpan(ctx context.Context, op string, email string) trace.Span {
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", r.store.Backend()),
+		attribute.String("db.operation", op),
 	}
-	err := r.SaveUser(u, true)
-	if err != nil {
-		return fmt.Errorf("failed to delete user > %w", err)
+	if email != "" {
+		attrs = append(attrs, attribute.String("user.email", email))
 	}
 
-	return nil
+	_, span := tracer.Start(ctx, "user.repo."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+	return span
 }
 
-func (r *DefaultRepo) DisableUser(email string) error {
-	usr, err := r.GetUser(email)
+func getUser(tx storage.Tx, email string) (*User, error) {
+	userBytes, err := tx.Get(UserBucket, []byte(email))
 	if err != nil {
-		return fmt.Errorf("failed to get user > %w", err)
+		return nil, err
+	}
+	if userBytes == nil {
+		return nil, ErrNotFound
 	}
-	usr.ValidEmail = false
 
-	err = r.SaveUser(usr, true)
+	var user User
+	err = json.Unmarshal(userBytes, &user)
 	if err != nil {
-		return fmt.Errorf("failed to save user > %w", err)
+		return nil, fmt.Errorf("failed to unmarshal user > %w", err)
 	}
 
-	return nil
+	return &user, nil
+}
+
+func putUser(tx storage.Tx, u *User) error {
+	userBytes, err := json.Marshal(u)
+	if err != nil {
+		return fmt.Errorf("failed to marshal user > %w", err)
+	}
+
+	return tx.Put(UserBucket, []byte(u.Email), userBytes)
 }
 
-func (r *DefaultRepo) MakeAdmin(email string) error {
-	usr, err := r.GetUser(email)
+func (r *DefaultRepo) ListUsers(ctx context.Context) ([]*User, error) {
+	users := []*User{}
+	err := r.view(ctx, "ListUsers", "", func(tx storage.Tx) error {
+		return tx.ForEach(UserBucket, func(k, v []byte) error {
+			var u User
+			if err := json.Unmarshal(v, &u); err != nil {
+				return fmt.Errorf("failed to unmarshal user %s > %w", k, err)
+			}
+			users = append(users, &u)
+			return nil
+		})
+	})
 	if err != nil {
-		return fmt.Errorf("failed to get user > %w", err)
+		return nil, fmt.Errorf("failed to list users from db > %w", err)
 	}
-	usr.Role = r.adminRole
 
-	err = r.SaveUser(usr, true)
+	return users, nil
+}
+
+// SaveUser stores u. An existing user is only replaced with force, and only if
+// u holds its current revision. On success u.Revision is increased.
+func (r *DefaultRepo) SaveUser(ctx context.Context, u *User, force bool) error {
+	saved := u.Clone()
+	generation := r.cacheGeneration()
+	err := r.update(ctx, "SaveUser", u.Email, func(tx storage.Tx) error {
+		existing, err := tx.Get(UserBucket, []byte(u.Email))
+		if err != nil {
+			return err
+		}
+
+		if existing != nil {
+			if !force {
+				return fmt.Errorf("%w: %s", ErrExists, u.Email)
+			}
+
+			current, err := getUser(tx, u.Email)
+			if err != nil {
+				return err
+			}
+			if current.Revision != u.Revision {
+				return fmt.Errorf("%w: %s has revision %d, got %d", ErrConflict, u.Email, current.Revision, u.Revision)
+			}
+		}
+
+		saved.Revision++
+		return putUser(tx, saved)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to save user > %w", err)
+		r.cacheDelete(u.Email)
+		return fmt.Errorf("failed to store user in db > %w", err)
 	}
 
+	u.Revision = saved.Revision
+	r.cachePut(saved, generation)
 	return nil
 }
 
-func (r *DefaultRepo) DisableAdmin(email string) error {
-	usr, err := r.GetUser(email)
+// UpdateUser reads the user, applies fn and stores the result in a single transaction
+func (r *DefaultRepo) UpdateUser(ctx context.Context, email string, fn func(u *User) error) (*User, error) {
+	generation := r.cacheGeneration()
+	var user *User
+	err := r.update(ctx, "UpdateUser", email, func(tx storage.Tx) error {
+		var err error
+		user, err = getUser(tx, email)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(user); err != nil {
+			return err
+		}
+
+		user.Email = email
+		user.Revision++
+		return putUser(tx, user)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to get user > %w", err)
+		return nil, fmt.Errorf("failed to update user > %w", err)
 	}
-	usr.Role = r.userRole
 
-	err = r.SaveUser(usr, true)
+	r.cachePut(user, generation)
+	return user.Clone(), nil
+}
+
+func (r *DefaultRepo) DeleteUser(ctx context.Context, email string) error {
+	err := r.update(ctx, "DeleteUser", email, func(tx storage.Tx) error {
+		return tx.Delete(UserBucket, []byte(email))
+	})
+	r.cacheDelete(email)
 	if err != nil {
-		return fmt.Errorf("failed to save user > %w", err)
+		return fmt.Errorf("failed to delete user > %w", err)
 	}
 
 	return nil
 }
 
-func (r *DefaultRepo) EnableUser(email string) error {
-	usr, err := r.GetUser(email)
+func (r *DefaultRepo) MarkForDeletion(ctx context.Context, email string, deleteAt time.Time) error {
+	_, err := r.UpdateUser(ctx, email, func(u *User) error {
+		u.DeleteAt = &deleteAt
+		// logging in again is the only way to cancel the deletion
+		u.ActiveJWT = []string{}
+		return nil
+	})
+	return err
+}
+
+func (r *DefaultRepo) CancelDeletion(ctx context.Context, email string) error {
+	_, err := r.UpdateUser(ctx, email, func(u *User) error {
+		u.DeleteAt = nil
+		return nil
+	})
+	return err
+}
+
+// PurgeUsers deletes every user whose grace period ended before now with their
+// lists, and removes them from the lists of the others, in a single transaction.
+func (r *DefaultRepo) PurgeUsers(ctx context.Context, now time.Time) ([]string, error) {
+	purged := []string{}
+	updated := []*User{}
+	generation := r.cacheGeneration()
+	err := r.update(ctx, "PurgeUsers", "", func(tx storage.Tx) error {
+		users := map[string]*User{}
+		err := tx.ForEach(UserBucket, func(k, v []byte) error {
+			var u User
+			if err := json.Unmarshal(v, &u); err != nil {
+				return fmt.Errorf("failed to unmarshal user %s > %w", k, err)
+			}
+			users[string(k)] = &u
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		lists := map[string]bool{}
+		for email, u := range users {
+			if u.DeleteAt == nil || u.DeleteAt.After(now) {
+				continue
+			}
+
+			for _, l := range u.Notes {
+				lists[l] = true
+				if err := tx.Delete(ListBucket, []byte(l)); err != nil {
+					return fmt.Errorf("failed to delete list %s > %w", l, err)
+				}
+			}
+			err := updateLists(tx, u.SharedWithMe, func(l *List) {
+				l.SharedWith = slices.DeleteFunc(l.SharedWith, func(s string) bool { return s == email })
+			})
+			if err != nil {
+				return fmt.Errorf("failed to leave the lists of %s > %w", email, err)
+			}
+			if err := tx.Delete(UserBucket, []byte(email)); err != nil {
+				return fmt.Errorf("failed to delete user %s > %w", email, err)
+			}
+			delete(users, email)
+			purged = append(purged, email)
+		}
+
+		if len(lists) == 0 {
+			return nil
+		}
+
+		for email, u := range users {
+			shared := slices.DeleteFunc(slices.Clone(u.SharedWithMe), func(l string) bool {
+				return lists[l]
+			})
+			if len(shared) == len(u.SharedWithMe) {
+				continue
+			}
+
+			u.SharedWithMe = shared
+			u.Revision++
+			if err := putUser(tx, u); err != nil {
+				return fmt.Errorf("failed to update user %s > %w", email, err)
+			}
+			updated = append(updated, u)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to get user > %w", err)
+		return nil, fmt.Errorf("failed to purge users > %w", err)
 	}
-	usr.ValidEmail = true
 
-	err = r.SaveUser(usr, true)
-	if err != nil {
-		return fmt.Errorf("failed to save user > %w", err)
+	for _, email := range purged {
+		r.cacheDelete(email)
+	}
+	for _, u := range updated {
+		r.cachePut(u, generation)
 	}
 
-	return nil
+	return purged, nil
+}
+
+func (r *DefaultRepo) DisableUser(ctx context.Context, email string) error {
+	_, err := r.UpdateUser(ctx, email, func(u *User) error {
+		u.ValidEmail = false
+		return nil
+	})
+	return err
+}
+
+func (r *DefaultRepo) MakeAdmin(ctx context.Context, email string) error {
+	_, err := r.UpdateUser(ctx, email, func(u *User) error {
+		u.Role = r.adminRole
+		return nil
+	})
+	return err
+}
+
+func (r *DefaultRepo) DisableAdmin(ctx context.Context, email string) error {
+	_, err := r.UpdateUser(ctx, email, func(u *User) error {
+		u.Role = r.userRole
+		return nil
+	})
+	return err
+}
+
+func (r *DefaultRepo) EnableUser(ctx context.Context, email string) error {
+	_, err := r.UpdateUser(ctx, email, func(u *User) error {
+		u.ValidEmail = true
+		return nil
+	})
+	return err
 }
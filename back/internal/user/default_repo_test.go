@@ -0,0 +1,322 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/storage"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestRepos returns a repo for every storage backend
+func newTestRepos(t *testing.T) map[string]*DefaultRepo {
+	repos := map[string]*DefaultRepo{}
+	for _, backend := range storage.Backends {
+		store, err := storage.Open(backend, filepath.Join(t.TempDir(), "test.db"), storage.Options{})
+		assert.Nil(t, err)
+		t.Cleanup(func() { store.Close() })
+
+		repo, err := NewDefaultRepo(store, cache.New(time.Hour, time.Hour), "admin", "user")
+		assert.Nil(t, err)
+		repos[backend] = repo
+	}
+	return repos
+}
+
+func newTestUser(email string) *User {
+	return &User{
+		Email:     email,
+		PassHash:  "hash",
+		Salt:      "salt",
+		Role:      "user",
+		CreatedAt: time.Now(),
+	}
+}
+
+func TestDefaultRepo(t *testing.T) {
+	ctx := context.Background()
+	for backend, repo := range newTestRepos(t) {
+		t.Run(backend, func(t *testing.T) {
+			t.Run("save and get", func(t *testing.T) {
+				assert.Nil(t, repo.SaveUser(ctx, newTestUser("jon@test.com"), false))
+
+				u, err := repo.GetUser(ctx, "jon@test.com")
+				assert.Nil(t, err)
+				assert.Equal(t, "jon@test.com", u.Email)
+				assert.Equal(t, "hash", u.PassHash)
+			})
+
+			t.Run("save existing without force", func(t *testing.T) {
+				assert.ErrorIs(t, repo.SaveUser(ctx, newTestUser("jon@test.com"), false), ErrExists)
+			})
+
+			t.Run("get unknown", func(t *testing.T) {
+				_, err := repo.GetUser(ctx, "unknown@test.com")
+				assert.ErrorIs(t, err, ErrNotFound)
+			})
+
+			t.Run("role and status changes", func(t *testing.T) {
+				assert.Nil(t, repo.MakeAdmin(ctx, "jon@test.com"))
+				assert.Nil(t, repo.EnableUser(ctx, "jon@test.com"))
+
+				u, err := repo.GetUser(ctx, "jon@test.com")
+				assert.Nil(t, err)
+				assert.Equal(t, "admin", u.Role)
+				assert.True(t, u.ValidEmail)
+
+				assert.Nil(t, repo.DisableAdmin(ctx, "jon@test.com"))
+				assert.Nil(t, repo.DisableUser(ctx, "jon@test.com"))
+
+				u, err = repo.GetUser(ctx, "jon@test.com")
+				assert.Nil(t, err)
+				assert.Equal(t, "user", u.Role)
+				assert.False(t, u.ValidEmail)
+			})
+
+			t.Run("suspend, password and sessions", func(t *testing.T) {
+				_, err := repo.UpdateUser(ctx, "jon@test.com", func(u *User) error {
+					u.ActiveJWT = []string{"t1", "t2"}
+					return nil
+				})
+				assert.Nil(t, err)
+
+				revoked, err := repo.RevokeSessions(ctx, "jon@test.com")
+				assert.Nil(t, err)
+				assert.Equal(t, 2, revoked)
+
+				assert.Nil(t, repo.SetPassword(ctx, "jon@test.com", "salt2", HashPassword("salt2", "secret")))
+				assert.Nil(t, repo.SuspendUser(ctx, "jon@test.com"))
+
+				u, err := repo.GetUser(ctx, "jon@test.com")
+				assert.Nil(t, err)
+				assert.True(t, u.Suspended)
+				assert.Empty(t, u.ActiveJWT)
+				assert.Equal(t, HashPassword("salt2", "secret"), u.PassHash)
+				assert.Equal(t, 0, u.Summary().Sessions)
+
+				assert.Nil(t, repo.ResumeUser(ctx, "jon@test.com"))
+				u, err = repo.GetUser(ctx, "jon@test.com")
+				assert.Nil(t, err)
+				assert.False(t, u.Suspended)
+
+				_, err = repo.RevokeSessions(ctx, "unknown@test.com")
+				assert.ErrorIs(t, err, ErrNotFound)
+			})
+
+			t.Run("list", func(t *testing.T) {
+				assert.Nil(t, repo.SaveUser(ctx, newTestUser("mary@test.com"), false))
+
+				users, err := repo.ListUsers(ctx)
+				assert.Nil(t, err)
+				assert.Len(t, users, 2)
+				assert.Equal(t, "jon@test.com", users[0].Email)
+				assert.Equal(t, "mary@test.com", users[1].Email)
+			})
+
+			t.Run("delete", func(t *testing.T) {
+				assert.Nil(t, repo.DeleteUser(ctx, "mary@test.com"))
+
+				_, err := repo.GetUser(ctx, "mary@test.com")
+				assert.NotNil(t, err)
+			})
+
+			t.Run("cancel deletion", func(t *testing.T) {
+				assert.Nil(t, repo.MarkForDeletion(ctx, "jon@test.com", time.Now().Add(time.Hour)))
+				assert.Nil(t, repo.CancelDeletion(ctx, "jon@test.com"))
+
+				purged, err := repo.PurgeUsers(ctx, time.Now().Add(2*time.Hour))
+				assert.Nil(t, err)
+				assert.Empty(t, purged)
+			})
+
+			t.Run("purge", func(t *testing.T) {
+				owner := newTestUser("owner@test.com")
+				owner.Notes = []string{"list-1"}
+				assert.Nil(t, repo.SaveUser(ctx, owner, false))
+
+				reader := newTestUser("reader@test.com")
+				reader.SharedWithMe = []string{"list-1", "list-2"}
+				assert.Nil(t, repo.SaveUser(ctx, reader, false))
+
+				assert.Nil(t, repo.MarkForDeletion(ctx, "owner@test.com", time.Now().Add(time.Hour)))
+
+				purged, err := repo.PurgeUsers(ctx, time.Now())
+				assert.Nil(t, err)
+				assert.Empty(t, purged)
+
+				purged, err = repo.PurgeUsers(ctx, time.Now().Add(2*time.Hour))
+				assert.Nil(t, err)
+				assert.Equal(t, []string{"owner@test.com"}, purged)
+
+				_, err = repo.GetUser(ctx, "owner@test.com")
+				assert.NotNil(t, err)
+
+				u, err := repo.GetUser(ctx, "reader@test.com")
+				assert.Nil(t, err)
+				assert.Equal(t, []string{"list-2"}, u.SharedWithMe)
+			})
+		})
+	}
+}
+
+func TestDefaultRepo_SaveUserConflict(t *testing.T) {
+	ctx := context.Background()
+	for backend, repo := range newTestRepos(t) {
+		t.Run(backend, func(t *testing.T) {
+			assert.Nil(t, repo.SaveUser(ctx, newTestUser("jon@test.com"), false))
+
+			first, err := repo.GetUser(ctx, "jon@test.com")
+			assert.Nil(t, err)
+			second, err := repo.GetUser(ctx, "jon@test.com")
+			assert.Nil(t, err)
+
+			first.Role = "admin"
+			assert.Nil(t, repo.SaveUser(ctx, first, true))
+
+			second.ValidEmail = true
+			assert.ErrorIs(t, repo.SaveUser(ctx, second, true), ErrConflict)
+
+			u, err := repo.GetUser(ctx, "jon@test.com")
+			assert.Nil(t, err)
+			assert.Equal(t, "admin", u.Role)
+			assert.False(t, u.ValidEmail)
+			assert.Equal(t, first.Revision, u.Revision)
+		})
+	}
+}
+
+func TestDefaultRepo_CacheCopies(t *testing.T) {
+	ctx := context.Background()
+	for backend, repo := range newTestRepos(t) {
+		t.Run(backend, func(t *testing.T) {
+			assert.Nil(t, repo.SaveUser(ctx, newTestUser("jon@test.com"), false))
+
+			u, err := repo.GetUser(ctx, "jon@test.com")
+			assert.Nil(t, err)
+			u.Role = "admin"
+			u.ActiveJWT = append(u.ActiveJWT, "token")
+
+			cached, err := repo.GetUser(ctx, "jon@test.com")
+			assert.Nil(t, err)
+			assert.Equal(t, "user", cached.Role)
+			assert.Empty(t, cached.ActiveJWT)
+
+			stats := repo.CacheStats()
+			assert.Equal(t, uint64(2), stats.Hits)
+			assert.Equal(t, uint64(0), stats.Misses)
+		})
+	}
+}
+
+// run with -race
+func TestDefaultRepo_ConcurrentUpdates(t *testing.T) {
+	ctx := context.Background()
+	const workers = 50
+
+	for backend, repo := range newTestRepos(t) {
+		t.Run(backend, func(t *testing.T) {
+			assert.Nil(t, repo.SaveUser(ctx, newTestUser("jon@test.com"), false))
+
+			var wg sync.WaitGroup
+			for i := range workers {
+				wg.Add(3)
+				go func() {
+					defer wg.Done()
+					_, err := repo.UpdateUser(ctx, "jon@test.com", func(u *User) error {
+						u.ActiveJWT = append(u.ActiveJWT, fmt.Sprintf("token-%d", i))
+						return nil
+					})
+					assert.Nil(t, err)
+				}()
+				go func() {
+					defer wg.Done()
+					if i%2 == 0 {
+						assert.Nil(t, repo.MakeAdmin(ctx, "jon@test.com"))
+					} else {
+						assert.Nil(t, repo.DisableAdmin(ctx, "jon@test.com"))
+					}
+				}()
+				go func() {
+					defer wg.Done()
+					u, err := repo.GetUser(ctx, "jon@test.com")
+					assert.Nil(t, err)
+					u.ActiveJWT = append(u.ActiveJWT, "local")
+					u.Role = "local"
+				}()
+			}
+			wg.Wait()
+
+			u, err := repo.GetUser(ctx, "jon@test.com")
+			assert.Nil(t, err)
+			assert.Len(t, u.ActiveJWT, workers)
+			assert.NotContains(t, u.ActiveJWT, "local")
+			assert.Equal(t, uint64(1+2*workers), u.Revision)
+		})
+	}
+}
+
+// hookStore calls afterView once a read transaction is done
+type hookStore struct {
+	storage.Store
+	afterView func()
+}
+
+func (s *hookStore) View(fn func(tx storage.Tx) error) error {
+	err := s.Store.View(fn)
+	if hook := s.afterView; hook != nil {
+		s.afterView = nil
+		hook()
+	}
+	return err
+}
+
+func TestDefaultRepo_DeleteDuringCacheMiss(t *testing.T) {
+	ctx := context.Background()
+	for _, backend := range storage.Backends {
+		t.Run(backend, func(t *testing.T) {
+			db, err := storage.Open(backend, filepath.Join(t.TempDir(), "test.db"), storage.Options{})
+			assert.Nil(t, err)
+			defer db.Close()
+
+			store := &hookStore{Store: db}
+			repo, err := NewDefaultRepo(store, cache.New(time.Hour, time.Hour), "admin", "user")
+			assert.Nil(t, err)
+
+			deletions := map[string]func(email string) error{
+				"delete": func(email string) error {
+					return repo.DeleteUser(ctx, email)
+				},
+				"purge": func(email string) error {
+					if err := repo.MarkForDeletion(ctx, email, time.Now()); err != nil {
+						return err
+					}
+					_, err := repo.PurgeUsers(ctx, time.Now().Add(time.Second))
+					return err
+				},
+			}
+			for name, deleteUser := range deletions {
+				t.Run(name, func(t *testing.T) {
+					assert.Nil(t, repo.SaveUser(ctx, newTestUser("jon@test.com"), false))
+					repo.cache.Flush()
+
+					// the user is deleted between the read of the miss and its cache put
+					store.afterView = func() {
+						assert.Nil(t, deleteUser("jon@test.com"))
+					}
+					u, err := repo.GetUser(ctx, "jon@test.com")
+					assert.Nil(t, err)
+					assert.Equal(t, "jon@test.com", u.Email)
+
+					_, err = repo.GetUser(ctx, "jon@test.com")
+					assert.ErrorIs(t, err, ErrNotFound)
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package user
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/claim"
+	"github.com/pzolo85/todo-app/back/internal/mail"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/patrickmn/go-cache"
+)
+
+// Profile is the part of a User that is safe to hand back in an export
+type Profile struct {
+	Email      string    `json:"email"`
+	Role       string    `json:"role"`
+	CreatedAt  time.Time `json:"created_at"`
+	ValidEmail bool      `json:"valid_email"`
+}
+
+// Share is a list of Owner shared with With. Lists are only unique by owner and
+// id, the names are picked by the users.
+type Share struct {
+	List  string `json:"list"`
+	Owner string `json:"owner"`
+	With  string `json:"with"`
+}
+
+type Session struct {
+	ClaimID   string    `json:"claim_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	SourceIP  string    `json:"source_address"`
+	UserAgent string    `json:"user_agent"`
+}
+
+// Export holds every piece of data owned by or referencing a user
+type Export struct {
+	Profile        Profile   `json:"profile"`
+	Lists          []*List   `json:"lists"`
+	SharesGiven    []Share   `json:"shares_given"`
+	SharesReceived []Share   `json:"shares_received"`
+	Sessions       []Session `json:"sessions"`
+}
+
+// NewExport collects the data of u. lists are the lists u owns or that are
+// shared with u, see Repo.ListLists.
+func NewExport(u *User, lists []*List) *Export {
+	exp := &Export{
+		Profile: Profile{
+			Email:      u.Email,
+			Role:       u.Role,
+			CreatedAt:  u.CreatedAt,
+			ValidEmail: u.ValidEmail,
+		},
+		Lists:          append([]*List{}, lists...),
+		SharesGiven:    []Share{},
+		SharesReceived: []Share{},
+		Sessions:       make([]Session, 0, len(u.ActiveJWT)),
+	}
+
+	for _, l := range lists {
+		if l.Owner != u.Email {
+			exp.SharesReceived = append(exp.SharesReceived, Share{List: l.ID, Owner: l.Owner, With: u.Email})
+			continue
+		}
+		for _, with := range l.SharedWith {
+			exp.SharesGiven = append(exp.SharesGiven, Share{List: l.ID, Owner: u.Email, With: with})
+		}
+	}
+
+	// tokens are secrets, only their claims are exported
+	parser := jwt.Parser{}
+	for _, token := range u.ActiveJWT {
+		var clm claim.UserClaim
+		if _, _, err := parser.ParseUnverified(token, &clm); err != nil {
+			continue
+		}
+		exp.Sessions = append(exp.Sessions, Session{
+			ClaimID:   clm.ClaimID,
+			CreatedAt: clm.CreatedAt,
+			ExpiresAt: clm.ExpiresAt,
+			SourceIP:  clm.SourceIP,
+			UserAgent: clm.UserAgent,
+		})
+	}
+
+	return exp
+}
+
+// Size is the number of records in the export
+func (e *Export) Size() int {
+	size := len(e.Lists) + len(e.SharesGiven) + len(e.SharesReceived) + len(e.Sessions)
+	for _, l := range e.Lists {
+		size += len(l.Items)
+	}
+	return size
+}
+
+// WriteZip writes every section of the export as a json file in a zip archive
+func (e *Export) WriteZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", e.Profile},
+		{"lists.json", e.Lists},
+		{"shares_given.json", e.SharesGiven},
+		{"shares_received.json", e.SharesReceived},
+		{"sessions.json", e.Sessions},
+	}
+
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return fmt.Errorf("failed to add %s to archive > %w", f.name, err)
+		}
+
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return fmt.Errorf("failed to encode %s > %w", f.name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to close archive > %w", err)
+	}
+	return nil
+}
+
+// ZipFile writes the archive of the export to a temp file and returns its path.
+// The caller removes the file.
+func (e *Export) ZipFile() (string, error) {
+	f, err := os.CreateTemp("", "todo-app-export-*.zip")
+	if err != nil {
+		return "", fmt.Errorf("failed to create archive > %w", err)
+	}
+
+	err = e.WriteZip(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+type exportArchive struct {
+	email string
+	path  string
+}
+
+// Exporter builds the large exports in the background, mails their link and
+// keeps the archives on disk until they expire
+type Exporter struct {
+	archives *cache.Cache
+	mailSvc  mail.Service
+	jobs     sync.WaitGroup
+	// ctx is cancelled when Shutdown gives up waiting for the jobs
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewExporter(archives *cache.Cache, mailSvc mail.Service) *Exporter {
+	// the files go with the entries, expired or deleted
+	archives.OnEvicted(func(_ string, v any) {
+		if archive, ok := v.(*exportArchive); ok {
+			os.Remove(archive.path)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Exporter{
+		archives: archives,
+		mailSvc:  mailSvc,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Start builds the archive of exp in the background and mails its link to the
+// owner of the export. It returns the id of the archive. The job keeps the
+// values of ctx, the request context, but outlives it.
+func (x *Exporter) Start(ctx context.Context, logger *slog.Logger, exp *Export) string {
+	exportID := uuid.NewString()
+	email := exp.Profile.Email
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(x.ctx, cancel)
+
+	x.jobs.Add(1)
+	go func() {
+		defer x.jobs.Done()
+		defer cancel()
+		defer stop()
+
+		path, err := exp.ZipFile()
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to build export", "email", email, "err", err.Error())
+			return
+		}
+		if ctx.Err() != nil {
+			os.Remove(path)
+			return
+		}
+
+		x.archives.Set(exportID, &exportArchive{email: email, path: path}, cache.DefaultExpiration)
+		if err := x.mailSvc.SendExportLink(ctx, email, exportID); err != nil {
+			logger.ErrorContext(ctx, "failed to send export link", "email", email, "err", err.Error())
+		}
+	}()
+
+	return exportID
+}
+
+// Get returns the path of the archive exportID of email
+func (x *Exporter) Get(exportID string, email string) (string, bool) {
+	cached, found := x.archives.Get(exportID)
+	if !found {
+		return "", false
+	}
+
+	archive, ok := cached.(*exportArchive)
+	if !ok || archive.email != email {
+		return "", false
+	}
+	return archive.path, true
+}
+
+// Emails returns the owners of the archives, see PurgeJob
+func (x *Exporter) Emails() []string {
+	emails := []string{}
+	for _, v := range x.archives.Items() {
+		if archive, ok := v.Object.(*exportArchive); ok && !slices.Contains(emails, archive.email) {
+			emails = append(emails, archive.email)
+		}
+	}
+	return emails
+}
+
+// Delete drops the archives of email, see PurgeJob
+func (x *Exporter) Delete(email string) {
+	for exportID, v := range x.archives.Items() {
+		if archive, ok := v.Object.(*exportArchive); ok && archive.email == email {
+			x.archives.Delete(exportID)
+		}
+	}
+}
+
+// Shutdown waits for the running exports until ctx is done, then cancels them,
+// and removes the archives. The server must not accept requests anymore.
+func (x *Exporter) Shutdown(ctx context.Context) error {
+	defer x.deleteAll()
+
+	done := make(chan struct{})
+	go func() {
+		x.jobs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		x.cancel()
+		return fmt.Errorf("failed to finish the exports > %w", ctx.Err())
+	}
+}
+
+func (x *Exporter) deleteAll() {
+	for exportID := range x.archives.Items() {
+		x.archives.Delete(exportID)
+	}
+}
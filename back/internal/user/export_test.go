@@ -0,0 +1,108 @@
+package user
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/claim"
+	"github.com/pzolo85/todo-app/back/internal/mail"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewExport(t *testing.T) {
+	created := time.Now().Truncate(time.Second).UTC()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claim.UserClaim{
+		Email:     "jon@test.com",
+		CreatedAt: created,
+		SourceIP:  "127.0.0.1",
+		UserAgent: "test",
+		ClaimID:   "claim-1",
+	}).SignedString([]byte("key"))
+	assert.Nil(t, err)
+
+	jon := newTestUser("jon@test.com")
+	jon.ActiveJWT = []string{token, "not-a-token"}
+	lists := []*List{
+		{ID: "list-1", Owner: "jon@test.com", Name: "groceries", Items: []Item{{ID: "milk", Text: "milk"}}},
+		// mary picked the same name, the shares tell the lists apart by owner and id
+		{ID: "list-2", Owner: "jon@test.com", Name: "books", SharedWith: []string{"mary@test.com"}},
+		{ID: "list-3", Owner: "mary@test.com", Name: "books", SharedWith: []string{"jon@test.com", "bob@test.com"}},
+	}
+
+	exp := NewExport(jon, lists)
+	assert.Equal(t, "jon@test.com", exp.Profile.Email)
+	assert.Equal(t, lists, exp.Lists)
+	assert.Equal(t, []Share{{List: "list-2", Owner: "jon@test.com", With: "mary@test.com"}}, exp.SharesGiven)
+	assert.Equal(t, []Share{{List: "list-3", Owner: "mary@test.com", With: "jon@test.com"}}, exp.SharesReceived)
+	assert.Equal(t, []Session{{ClaimID: "claim-1", CreatedAt: created, SourceIP: "127.0.0.1", UserAgent: "test"}}, exp.Sessions)
+	assert.Equal(t, 7, exp.Size())
+
+	var buf bytes.Buffer
+	assert.Nil(t, exp.WriteZip(&buf))
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Nil(t, err)
+
+	names := []string{}
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"profile.json", "lists.json", "shares_given.json", "shares_received.json", "sessions.json"}, names)
+}
+
+// blockingTransport holds every mail until its context is done
+type blockingTransport struct {
+	started chan struct{}
+}
+
+func (b *blockingTransport) Send(ctx context.Context, m mail.Mail) error {
+	close(b.started)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestExporter_Shutdown(t *testing.T) {
+	transport := &blockingTransport{started: make(chan struct{})}
+	x := NewExporter(cache.New(time.Hour, time.Hour), newTestMailService(transport))
+
+	exp := NewExport(newTestUser("jon@test.com"), nil)
+	exportID := x.Start(context.Background(), slog.Default(), exp)
+	<-transport.started
+
+	// the archive is stored before the link is sent
+	_, found := x.Get(exportID, "jon@test.com")
+	assert.True(t, found)
+	_, found = x.Get(exportID, "mary@test.com")
+	assert.False(t, found)
+
+	path, _ := x.Get(exportID, "jon@test.com")
+	assert.FileExists(t, path)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, x.Shutdown(ctx), context.DeadlineExceeded)
+
+	// the cancelled job returns, and the archives are removed
+	assert.Nil(t, x.Shutdown(context.Background()))
+	assert.NoFileExists(t, path)
+	_, found = x.Get(exportID, "jon@test.com")
+	assert.False(t, found)
+}
+
+func TestExport_ZipFile(t *testing.T) {
+	path, err := NewExport(newTestUser("jon@test.com"), nil).ZipFile()
+	assert.Nil(t, err)
+	defer os.Remove(path)
+
+	zr, err := zip.OpenReader(path)
+	assert.Nil(t, err)
+	defer zr.Close()
+	assert.Len(t, zr.File, 5)
+}
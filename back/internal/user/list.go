@@ -0,0 +1,280 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/apperr"
+	"github.com/pzolo85/todo-app/back/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ListBucket holds the lists by id. The owner of a list keeps its id in
+	// User.Notes, the users it is shared with in User.SharedWithMe.
+	ListBucket = []byte("list")
+
+	ErrListNotFound  = apperr.NotFound("list_not_found", "list not found")
+	ErrItemNotFound  = apperr.NotFound("item_not_found", "item not found")
+	ErrNotListOwner  = apperr.Forbidden("not_list_owner", "only the owner of a list can share it")
+	ErrShareWithSelf = apperr.BadRequest("share_with_owner", "a list cannot be shared with its owner")
+)
+
+type Item struct {
+	ID        string    `json:"id"`
+	Text      string    `json:"text"`
+	Done      bool      `json:"done"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type List struct {
+	ID         string    `json:"id"`
+	Owner      string    `json:"owner"`
+	Name       string    `json:"name"`
+	Items      []Item    `json:"items"`
+	SharedWith []string  `json:"shared_with"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Member reports whether email owns the list or it is shared with email
+func (l *List) Member(email string) bool {
+	return l.Owner == email || slices.Contains(l.SharedWith, email)
+}
+
+// Item returns the item id of the list
+func (l *List) Item(id string) (*Item, error) {
+	i := slices.IndexFunc(l.Items, func(it Item) bool { return it.ID == id })
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrItemNotFound, id)
+	}
+	return &l.Items[i], nil
+}
+
+func getList(tx storage.Tx, id string) (*List, error) {
+	data, err := tx.Get(ListBucket, []byte(id))
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("%w: %s", ErrListNotFound, id)
+	}
+
+	var l List
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal list %s > %w", id, err)
+	}
+	return &l, nil
+}
+
+func putList(tx storage.Tx, l *List) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return fmt.Errorf("failed to marshal list > %w", err)
+	}
+	return tx.Put(ListBucket, []byte(l.ID), data)
+}
+
+// getLists returns the stored lists of ids. Ids without a list are skipped, the
+// notes of users created before lists were stored are plain names.
+func getLists(tx storage.Tx, ids []string) ([]*List, error) {
+	lists := make([]*List, 0, len(ids))
+	for _, id := range ids {
+		l, err := getList(tx, id)
+		if errors.Is(err, ErrListNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, l)
+	}
+	return lists, nil
+}
+
+// updateLists applies fn to the stored lists of ids
+func updateLists(tx storage.Tx, ids []string, fn func(l *List)) error {
+	lists, err := getLists(tx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range lists {
+		fn(l)
+		if err := putList(tx, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renameMember replaces from with to as the owner or a reader of the list,
+// see CanonicalizeEmails and MergeUsers
+func (l *List) renameMember(from string, to string) {
+	if l.Owner == from {
+		l.Owner = to
+	}
+	shared := []string{}
+	for _, email := range l.SharedWith {
+		if email == from {
+			email = to
+		}
+		if email != l.Owner && !slices.Contains(shared, email) {
+			shared = append(shared, email)
+		}
+	}
+	l.SharedWith = shared
+}
+
+// CreateList stores a new list of owner and adds it to the notes of owner
+func (r *DefaultRepo) CreateList(ctx context.Context, owner string, name string) (*List, error) {
+	l := &List{
+		ID:         uuid.NewString(),
+		Owner:      owner,
+		Name:       name,
+		Items:      []Item{},
+		SharedWith: []string{},
+		CreatedAt:  time.Now(),
+	}
+
+	generation := r.cacheGeneration()
+	var u *User
+	err := r.update(ctx, "CreateList", owner, func(tx storage.Tx) error {
+		var err error
+		u, err = getUser(tx, owner)
+		if err != nil {
+			return err
+		}
+
+		u.Notes = append(u.Notes, l.ID)
+		u.Revision++
+		if err := putUser(tx, u); err != nil {
+			return err
+		}
+		return putList(tx, l)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create list > %w", err)
+	}
+
+	r.cachePut(u, generation)
+	return l, nil
+}
+
+// GetList returns the list id, if email owns it or it is shared with email
+func (r *DefaultRepo) GetList(ctx context.Context, email string, id string) (*List, error) {
+	var l *List
+	err := r.view(ctx, "GetList", email, func(tx storage.Tx) error {
+		var err error
+		l, err = getList(tx, id)
+		if err != nil {
+			return err
+		}
+		if !l.Member(email) {
+			return fmt.Errorf("%w: %s", ErrListNotFound, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get list > %w", err)
+	}
+
+	return l, nil
+}
+
+// ListLists returns the lists email owns, then the ones shared with email
+func (r *DefaultRepo) ListLists(ctx context.Context, email string) ([]*List, error) {
+	var lists []*List
+	err := r.view(ctx, "ListLists", email, func(tx storage.Tx) error {
+		u, err := getUser(tx, email)
+		if err != nil {
+			return err
+		}
+
+		lists, err = getLists(tx, slices.Concat(u.Notes, u.SharedWithMe))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list lists > %w", err)
+	}
+
+	return lists, nil
+}
+
+// UpdateList reads the list id, applies fn and stores the result in a single
+// transaction. The owner and the users the list is shared with can update it.
+func (r *DefaultRepo) UpdateList(ctx context.Context, email string, id string, fn func(l *List) error) (*List, error) {
+	var l *List
+	err := r.update(ctx, "UpdateList", email, func(tx storage.Tx) error {
+		var err error
+		l, err = getList(tx, id)
+		if err != nil {
+			return err
+		}
+		if !l.Member(email) {
+			return fmt.Errorf("%w: %s", ErrListNotFound, id)
+		}
+
+		owner, shared := l.Owner, l.SharedWith
+		if err := fn(l); err != nil {
+			return err
+		}
+		// shares go through ShareList, they are kept on the user too
+		l.ID, l.Owner, l.SharedWith = id, owner, shared
+		return putList(tx, l)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update list > %w", err)
+	}
+
+	return l, nil
+}
+
+// ShareList shares the list id of owner with the user with
+func (r *DefaultRepo) ShareList(ctx context.Context, owner string, id string, with string) (*List, error) {
+	generation := r.cacheGeneration()
+	var l *List
+	var reader *User
+	err := r.update(ctx, "ShareList", owner, func(tx storage.Tx) error {
+		var err error
+		l, err = getList(tx, id)
+		if err != nil {
+			return err
+		}
+		if !l.Member(owner) {
+			return fmt.Errorf("%w: %s", ErrListNotFound, id)
+		}
+		if l.Owner != owner {
+			return fmt.Errorf("%w: %s", ErrNotListOwner, id)
+		}
+		if with == owner {
+			return ErrShareWithSelf
+		}
+
+		reader, err = getUser(tx, with)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(l.SharedWith, with) {
+			return nil
+		}
+
+		l.SharedWith = append(l.SharedWith, with)
+		reader.SharedWithMe = append(reader.SharedWithMe, id)
+		reader.Revision++
+		if err := putUser(tx, reader); err != nil {
+			return err
+		}
+		return putList(tx, l)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to share list > %w", err)
+	}
+
+	r.cachePut(reader, generation)
+	return l, nil
+}
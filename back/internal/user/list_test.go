@@ -0,0 +1,168 @@
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/emailaddr"
+	"github.com/pzolo85/todo-app/back/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultRepo_Lists(t *testing.T) {
+	ctx := context.Background()
+	for backend, repo := range newTestRepos(t) {
+		t.Run(backend, func(t *testing.T) {
+			for _, email := range []string{"jon@test.com", "mary@test.com", "bob@test.com"} {
+				assert.Nil(t, repo.SaveUser(ctx, newTestUser(email), false))
+			}
+
+			l, err := repo.CreateList(ctx, "jon@test.com", "groceries")
+			assert.Nil(t, err)
+			assert.Equal(t, "jon@test.com", l.Owner)
+
+			t.Run("create adds the list to the notes of the owner", func(t *testing.T) {
+				u, err := repo.GetUser(ctx, "jon@test.com")
+				assert.Nil(t, err)
+				assert.Equal(t, []string{l.ID}, u.Notes)
+			})
+
+			t.Run("update", func(t *testing.T) {
+				updated, err := repo.UpdateList(ctx, "jon@test.com", l.ID, func(l *List) error {
+					l.Items = append(l.Items, Item{ID: "milk", Text: "milk"})
+					l.Owner = "mary@test.com"
+					return nil
+				})
+				assert.Nil(t, err)
+				assert.Len(t, updated.Items, 1)
+				assert.Equal(t, "jon@test.com", updated.Owner)
+
+				_, err = repo.UpdateList(ctx, "jon@test.com", l.ID, func(l *List) error {
+					_, err := l.Item("unknown")
+					return err
+				})
+				assert.ErrorIs(t, err, ErrItemNotFound)
+			})
+
+			t.Run("other users do not see the list", func(t *testing.T) {
+				_, err := repo.GetList(ctx, "mary@test.com", l.ID)
+				assert.ErrorIs(t, err, ErrListNotFound)
+
+				_, err = repo.UpdateList(ctx, "mary@test.com", l.ID, func(l *List) error { return nil })
+				assert.ErrorIs(t, err, ErrListNotFound)
+
+				_, err = repo.ShareList(ctx, "mary@test.com", l.ID, "bob@test.com")
+				assert.ErrorIs(t, err, ErrListNotFound)
+			})
+
+			t.Run("share", func(t *testing.T) {
+				shared, err := repo.ShareList(ctx, "jon@test.com", l.ID, "mary@test.com")
+				assert.Nil(t, err)
+				assert.Equal(t, []string{"mary@test.com"}, shared.SharedWith)
+
+				// sharing twice is a no-op
+				_, err = repo.ShareList(ctx, "jon@test.com", l.ID, "mary@test.com")
+				assert.Nil(t, err)
+
+				u, err := repo.GetUser(ctx, "mary@test.com")
+				assert.Nil(t, err)
+				assert.Equal(t, []string{l.ID}, u.SharedWithMe)
+
+				got, err := repo.GetList(ctx, "mary@test.com", l.ID)
+				assert.Nil(t, err)
+				assert.Equal(t, "groceries", got.Name)
+
+				_, err = repo.ShareList(ctx, "mary@test.com", l.ID, "bob@test.com")
+				assert.ErrorIs(t, err, ErrNotListOwner)
+
+				_, err = repo.ShareList(ctx, "jon@test.com", l.ID, "jon@test.com")
+				assert.ErrorIs(t, err, ErrShareWithSelf)
+
+				_, err = repo.ShareList(ctx, "jon@test.com", l.ID, "unknown@test.com")
+				assert.ErrorIs(t, err, ErrNotFound)
+			})
+
+			t.Run("list owned then shared", func(t *testing.T) {
+				own, err := repo.CreateList(ctx, "mary@test.com", "books")
+				assert.Nil(t, err)
+
+				lists, err := repo.ListLists(ctx, "mary@test.com")
+				assert.Nil(t, err)
+				assert.Len(t, lists, 2)
+				assert.Equal(t, own.ID, lists[0].ID)
+				assert.Equal(t, l.ID, lists[1].ID)
+			})
+
+			t.Run("purge removes the lists of the user and its shares", func(t *testing.T) {
+				assert.Nil(t, repo.MarkForDeletion(ctx, "mary@test.com", time.Now()))
+				purged, err := repo.PurgeUsers(ctx, time.Now().Add(time.Hour))
+				assert.Nil(t, err)
+				assert.Equal(t, []string{"mary@test.com"}, purged)
+
+				got, err := repo.GetList(ctx, "jon@test.com", l.ID)
+				assert.Nil(t, err)
+				assert.Empty(t, got.SharedWith)
+
+				assert.Nil(t, repo.MarkForDeletion(ctx, "jon@test.com", time.Now()))
+				_, err = repo.PurgeUsers(ctx, time.Now().Add(time.Hour))
+				assert.Nil(t, err)
+
+				err = repo.store.View(func(tx storage.Tx) error {
+					_, err := getList(tx, l.ID)
+					return err
+				})
+				assert.ErrorIs(t, err, ErrListNotFound)
+			})
+		})
+	}
+}
+
+func TestCanonicalizeAndMerge_Lists(t *testing.T) {
+	ctx := context.Background()
+	for backend, repo := range newTestRepos(t) {
+		t.Run(backend, func(t *testing.T) {
+			for _, email := range []string{"Jon@Test.com", "jon@test.com", "Mary@Test.com"} {
+				assert.Nil(t, repo.SaveUser(ctx, newTestUser(email), false))
+			}
+			marys, err := repo.CreateList(ctx, "Mary@Test.com", "books")
+			assert.Nil(t, err)
+			_, err = repo.ShareList(ctx, "Mary@Test.com", marys.ID, "Jon@Test.com")
+			assert.Nil(t, err)
+			jons, err := repo.CreateList(ctx, "Jon@Test.com", "groceries")
+			assert.Nil(t, err)
+			_, err = repo.ShareList(ctx, "Jon@Test.com", jons.ID, "jon@test.com")
+			assert.Nil(t, err)
+
+			err = repo.store.Update(func(tx storage.Tx) error {
+				_, err := CanonicalizeEmails(tx, emailaddr.Default.Normalize)
+				return err
+			})
+			assert.Nil(t, err)
+			repo.cache.Flush()
+
+			t.Run("lists follow a moved user", func(t *testing.T) {
+				l, err := repo.GetList(ctx, "mary@test.com", marys.ID)
+				assert.Nil(t, err)
+				assert.Equal(t, "mary@test.com", l.Owner)
+			})
+
+			t.Run("lists follow a merged user", func(t *testing.T) {
+				merged, err := repo.MergeUsers(ctx, "jon@test.com", "Jon@Test.com", []string{"jon@test.com"})
+				assert.Nil(t, err)
+				assert.Equal(t, []string{jons.ID}, merged.Notes)
+				assert.Equal(t, []string{marys.ID}, merged.SharedWithMe)
+
+				l, err := repo.GetList(ctx, "jon@test.com", jons.ID)
+				assert.Nil(t, err)
+				assert.Equal(t, "jon@test.com", l.Owner)
+				assert.Empty(t, l.SharedWith)
+
+				l, err = repo.GetList(ctx, "jon@test.com", marys.ID)
+				assert.Nil(t, err)
+				assert.Equal(t, []string{"jon@test.com"}, l.SharedWith)
+			})
+		})
+	}
+}
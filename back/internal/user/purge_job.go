@@ -0,0 +1,90 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/mail"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PurgeJob periodically removes the users whose deletion grace period is over
+type PurgeJob struct {
+	repo     Repo
+	mailSvc  mail.Service
+	exporter *Exporter
+	logger   *slog.Logger
+	interval time.Duration
+}
+
+func NewPurgeJob(repo Repo, mailSvc mail.Service, exporter *Exporter, logger *slog.Logger, interval time.Duration) *PurgeJob {
+	return &PurgeJob{
+		repo:     repo,
+		mailSvc:  mailSvc,
+		exporter: exporter,
+		logger:   logger.WithGroup("purge_job"),
+		interval: interval,
+	}
+}
+
+// Run purges users every interval until ctx is done
+func (j *PurgeJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		j.Purge(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge runs one purge in its own trace
+func (j *PurgeJob) Purge(ctx context.Context, now time.Time) {
+	ctx, span := tracer.Start(ctx, "user.PurgeJob", trace.WithNewRoot())
+	defer span.End()
+
+	purged, err := j.repo.PurgeUsers(ctx, now)
+	if err != nil {
+		j.logger.ErrorContext(ctx, "failed to purge users", "err", err.Error())
+	}
+	for _, email := range purged {
+		j.logger.InfoContext(ctx, "user purged", "email", email)
+	}
+
+	j.sweep(ctx)
+}
+
+// sweep drops the challenges and exports of every email without a user. They
+// are not stored with the users, so they are swept on every run: a run that
+// failed after PurgeUsers, or a user deleted by other means, leaves none behind.
+func (j *PurgeJob) sweep(ctx context.Context) {
+	emails := map[string]bool{}
+	for _, email := range j.mailSvc.ListChallenges() {
+		emails[email] = true
+	}
+	for _, email := range j.exporter.Emails() {
+		emails[email] = true
+	}
+
+	for email := range emails {
+		_, err := j.repo.GetUser(ctx, email)
+		if !errors.Is(err, ErrNotFound) {
+			if err != nil {
+				j.logger.ErrorContext(ctx, "failed to get user", "email", email, "err", err.Error())
+			}
+			continue
+		}
+
+		j.mailSvc.DeleteChallenges(email)
+		j.exporter.Delete(email)
+		j.logger.InfoContext(ctx, "challenges and exports removed", "email", email)
+	}
+}
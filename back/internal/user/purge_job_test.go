@@ -0,0 +1,60 @@
+package user
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurgeJob(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHandler(t, 0)
+	for _, email := range []string{"jon@test.com", "mary@test.com"} {
+		u := newTestUser(email)
+		u.Notes = []string{"list-1"}
+		assert.Nil(t, h.repo.SaveUser(ctx, u, false))
+	}
+
+	jonExport := h.exporter.Start(ctx, slog.Default(), NewExport(newTestUser("jon@test.com"), nil))
+	maryExport := h.exporter.Start(ctx, slog.Default(), NewExport(newTestUser("mary@test.com"), nil))
+	// the link is mailed once the archive is stored
+	<-h.mails
+	<-h.mails
+	jonPath, _ := h.exporter.Get(jonExport, "jon@test.com")
+	assert.FileExists(t, jonPath)
+
+	deleteAt := time.Now().Add(time.Hour)
+	assert.Nil(t, h.repo.MarkForDeletion(ctx, "jon@test.com", deleteAt))
+
+	job := NewPurgeJob(h.repo, h.mailSvc, h.exporter, slog.Default(), time.Hour)
+	job.Purge(ctx, deleteAt.Add(time.Second))
+
+	_, err := h.repo.GetUser(ctx, "jon@test.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, found := h.exporter.Get(jonExport, "jon@test.com")
+	assert.False(t, found)
+	assert.NoFileExists(t, jonPath)
+
+	_, err = h.repo.GetUser(ctx, "mary@test.com")
+	assert.Nil(t, err)
+	_, found = h.exporter.Get(maryExport, "mary@test.com")
+	assert.True(t, found)
+
+	t.Run("leftovers of users deleted earlier are swept", func(t *testing.T) {
+		assert.Nil(t, h.mailSvc.SendChallenge(ctx, "mary@test.com"))
+		<-h.mails
+		assert.Nil(t, h.repo.DeleteUser(ctx, "mary@test.com"))
+
+		job.Purge(ctx, time.Now())
+		assert.Empty(t, h.mailSvc.ListChallenges())
+		_, found := h.exporter.Get(maryExport, "mary@test.com")
+		assert.False(t, found)
+
+		// nothing left, the next run is a no-op
+		job.Purge(ctx, time.Now())
+		assert.Empty(t, h.exporter.Emails())
+	})
+}
@@ -1,11 +1,33 @@
 package user
 
+import (
+	"context"
+	"time"
+)
+
 type Repo interface {
-	GetUser(email string) (*User, error)
-	SaveUser(u *User, force bool) error
-	DeleteUser(email string) error
-	DisableUser(email string) error
-	MakeAdmin(email string) error
-	DisableAdmin(email string) error
-	EnableUser(email string) error
+	GetUser(ctx context.Context, email string) (*User, error)
+	ListUsers(ctx context.Context) ([]*User, error)
+	SaveUser(ctx context.Context, u *User, force bool) error
+	UpdateUser(ctx context.Context, email string, fn func(u *User) error) (*User, error)
+	DeleteUser(ctx context.Context, email string) error
+	DisableUser(ctx context.Context, email string) error
+	MakeAdmin(ctx context.Context, email string) error
+	DisableAdmin(ctx context.Context, email string) error
+	EnableUser(ctx context.Context, email string) error
+	SuspendUser(ctx context.Context, email string) error
+	ResumeUser(ctx context.Context, email string) error
+	SetPassword(ctx context.Context, email string, salt string, hash string) error
+	RevokeSessions(ctx context.Context, email string) (int, error)
+	MarkForDeletion(ctx context.Context, email string, deleteAt time.Time) error
+	CancelDeletion(ctx context.Context, email string) error
+	PurgeUsers(ctx context.Context, now time.Time) ([]string, error)
+	ListDuplicates(ctx context.Context) (map[string][]string, error)
+	MergeUsers(ctx context.Context, canonical string, primary string, others []string) (*User, error)
+	CreateList(ctx context.Context, owner string, name string) (*List, error)
+	GetList(ctx context.Context, email string, id string) (*List, error)
+	ListLists(ctx context.Context, email string) ([]*List, error)
+	UpdateList(ctx context.Context, email string, id string, fn func(l *List) error) (*List, error)
+	ShareList(ctx context.Context, owner string, id string, with string) (*List, error)
+	CacheStats() CacheStats
 }
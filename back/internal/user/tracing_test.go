@@ -0,0 +1,38 @@
+package user
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestDefaultRepo_Spans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	for backend, repo := range newTestRepos(t) {
+		t.Run(backend, func(t *testing.T) {
+			before := len(recorder.Ended())
+			ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+			assert.Nil(t, repo.SaveUser(ctx, newTestUser("jon@test.com"), false))
+			_, err := repo.GetUser(ctx, "unknown@test.com")
+			assert.NotNil(t, err)
+			parent.End()
+
+			spans := recorder.Ended()[before:]
+			assert.Len(t, spans, 3)
+
+			names := []string{}
+			for _, s := range spans[:2] {
+				names = append(names, s.Name())
+				assert.Equal(t, parent.SpanContext().SpanID(), s.Parent().SpanID())
+			}
+			assert.Equal(t, []string{"user.repo.SaveUser", "user.repo.GetUser"}, names)
+			assert.Equal(t, "Error", spans[1].Status().Code.String())
+		})
+	}
+}
@@ -0,0 +1,144 @@
+// Package validate binds request bodies and checks them against their struct tags
+//
+// Request types declare their rules with `validate` tags, for example
+//
+//	Email string `json:"email" validate:"required,email,max=254"`
+//
+// String fields tagged `normalize:"email"` are replaced by their canonical
+// address before the checks run, and requests can implement Normalizer for
+// any other clean up. Failed checks are returned as an apperr validation error listing every field.
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/pzolo85/todo-app/back/internal/apperr"
+	"github.com/pzolo85/todo-app/back/internal/emailaddr"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// Normalizer is implemented by requests that clean up their fields before validation
+type Normalizer interface {
+	Normalize()
+}
+
+// Binder is an echo.Binder that normalizes and validates what it binds
+type Binder struct {
+	binder   echo.DefaultBinder
+	validate *validator.Validate
+	emails   emailaddr.Normalizer
+}
+
+func NewBinder(emails emailaddr.Normalizer) *Binder {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(fieldName)
+
+	return &Binder{
+		validate: v,
+		emails:   emails,
+	}
+}
+
+// fieldName reports fields by their json name, or their query name for query params
+func fieldName(f reflect.StructField) string {
+	for _, tag := range []string{"json", "query"} {
+		name, _, _ := strings.Cut(f.Tag.Get(tag), ",")
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+func (b *Binder) Bind(i any, c echo.Context) error {
+	if err := b.binder.Bind(i, c); err != nil {
+		return apperr.ErrInvalidBody.Wrap(err)
+	}
+
+	return b.Struct(i)
+}
+
+// Struct normalizes and validates i
+func (b *Binder) Struct(i any) error {
+	fields := b.normalizeEmails(i)
+	if n, ok := i.(Normalizer); ok {
+		n.Normalize()
+	}
+
+	err := b.validate.Struct(i)
+	if err == nil && len(fields) == 0 {
+		return nil
+	}
+
+	var verrs validator.ValidationErrors
+	if err != nil && !errors.As(err, &verrs) {
+		return apperr.Internal(fmt.Errorf("failed to validate request > %w", err))
+	}
+
+	for _, fe := range verrs {
+		// an address that failed to normalize is already reported
+		if slices.ContainsFunc(fields, func(f apperr.FieldError) bool { return f.Field == fe.Field() }) {
+			continue
+		}
+		fields = append(fields, apperr.FieldError{
+			Field:   fe.Field(),
+			Code:    fe.Tag(),
+			Message: message(fe),
+		})
+	}
+
+	return apperr.Validation(fields...)
+}
+
+// normalizeEmails replaces the fields tagged normalize:"email" with their canonical address
+func (b *Binder) normalizeEmails(i any) []apperr.FieldError {
+	v := reflect.ValueOf(i)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	v = v.Elem()
+
+	var fields []apperr.FieldError
+	for n := 0; n < v.NumField(); n++ {
+		f := v.Type().Field(n)
+		if f.Tag.Get("normalize") != "email" || f.Type.Kind() != reflect.String || v.Field(n).String() == "" {
+			continue
+		}
+
+		addr, err := b.emails.Normalize(v.Field(n).String())
+		if err != nil {
+			name := fieldName(f)
+			fields = append(fields, apperr.FieldError{
+				Field:   name,
+				Code:    "email",
+				Message: fmt.Sprintf("%s must be a valid email address", name),
+			})
+			continue
+		}
+		v.Field(n).SetString(addr)
+	}
+	return fields
+}
+
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", fe.Field())
+	case "email":
+		return fmt.Sprintf("%s must be a valid email address", fe.Field())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s characters long", fe.Field(), fe.Param())
+	case "min":
+		return fmt.Sprintf("%s must be at least %s characters long", fe.Field(), fe.Param())
+	}
+	return fmt.Sprintf("%s failed the %s check", fe.Field(), fe.Tag())
+}
@@ -0,0 +1,89 @@
+package validate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pzolo85/todo-app/back/internal/apperr"
+	"github.com/pzolo85/todo-app/back/internal/emailaddr"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type testRequest struct {
+	Email string `json:"email" validate:"required,email,max=254" normalize:"email"`
+	Name  string `json:"name" validate:"max=5"`
+}
+
+type testQuery struct {
+	Email string `query:"email" validate:"required,email" normalize:"email"`
+}
+
+func TestBinder(t *testing.T) {
+	e := echo.New()
+	b := NewBinder(emailaddr.Normalizer{})
+
+	bind := func(body string) (*testRequest, error) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+		var r testRequest
+		err := b.Bind(&r, e.NewContext(req, httptest.NewRecorder()))
+		return &r, err
+	}
+
+	t.Run("valid request is normalized", func(t *testing.T) {
+		r, err := bind(`{"email":"  Jon@Bücher.DE "}`)
+		assert.Nil(t, err)
+		assert.Equal(t, "jon@xn--bcher-kva.de", r.Email)
+	})
+
+	t.Run("query params are normalized", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?email=Jon@Test.com", nil)
+
+		var q testQuery
+		err := b.Bind(&q, e.NewContext(req, httptest.NewRecorder()))
+		assert.Nil(t, err)
+		assert.Equal(t, "jon@test.com", q.Email)
+	})
+
+	t.Run("address that cannot be normalized", func(t *testing.T) {
+		_, err := bind(`{"email":"jon@"}`)
+
+		e, ok := apperr.As(err)
+		assert.True(t, ok)
+		assert.Equal(t, []apperr.FieldError{
+			{Field: "email", Code: "email", Message: "email must be a valid email address"},
+		}, e.Fields)
+	})
+
+	t.Run("invalid fields are listed", func(t *testing.T) {
+		_, err := bind(`{"email":"not-an-email","name":"too long"}`)
+
+		e, ok := apperr.As(err)
+		assert.True(t, ok)
+		assert.Equal(t, apperr.KindValidation, e.Kind)
+		assert.Equal(t, []apperr.FieldError{
+			{Field: "email", Code: "email", Message: "email must be a valid email address"},
+			{Field: "name", Code: "max", Message: "name must be at most 5 characters long"},
+		}, e.Fields)
+	})
+
+	t.Run("missing fields", func(t *testing.T) {
+		_, err := bind(`{}`)
+
+		e, ok := apperr.As(err)
+		assert.True(t, ok)
+		assert.Equal(t, []apperr.FieldError{
+			{Field: "email", Code: "required", Message: "email is required"},
+		}, e.Fields)
+	})
+
+	t.Run("malformed body", func(t *testing.T) {
+		_, err := bind(`{"email":`)
+		assert.ErrorIs(t, err, apperr.ErrInvalidBody)
+	})
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// the admin calls need a token of an admin
+
+// ListUsers returns every account
+func (c *Client) ListUsers(ctx context.Context) ([]Summary, error) {
+	var res listUsersResponse
+	if err := c.call(ctx, request{method: http.MethodGet, path: "/admin/user/list", auth: true}, &res); err != nil {
+		return nil, err
+	}
+	return res.Users, nil
+}
+
+// AdminCreateUser creates a user without the email challenge
+func (c *Client) AdminCreateUser(ctx context.Context, req AdminCreateUserRequest) (*Summary, error) {
+	var s Summary
+	if err := c.call(ctx, request{method: http.MethodPost, path: "/admin/user/create", body: req, auth: true}, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// modifyUser sends email to the admin user action at path
+func (c *Client) modifyUser(ctx context.Context, path string, email string) error {
+	return c.call(ctx, request{
+		method: http.MethodPut,
+		path:   "/admin/user" + path,
+		body:   modifyUserRequest{Email: email},
+		auth:   true,
+	}, nil)
+}
+
+func (c *Client) DisableUser(ctx context.Context, email string) error {
+	return c.modifyUser(ctx, "/disable", email)
+}
+
+func (c *Client) MakeAdmin(ctx context.Context, email string) error {
+	return c.modifyUser(ctx, "/make-admin", email)
+}
+
+func (c *Client) DisableAdmin(ctx context.Context, email string) error {
+	return c.modifyUser(ctx, "/disable-admin", email)
+}
+
+// SuspendUser blocks the logins of the user and revokes its sessions
+func (c *Client) SuspendUser(ctx context.Context, email string) error {
+	return c.modifyUser(ctx, "/suspend", email)
+}
+
+func (c *Client) ResumeUser(ctx context.Context, email string) error {
+	return c.modifyUser(ctx, "/resume", email)
+}
+
+// SetPassword replaces the password of the user and revokes its sessions
+func (c *Client) SetPassword(ctx context.Context, email string, salt string, hash string) error {
+	return c.call(ctx, request{
+		method: http.MethodPut,
+		path:   "/admin/user/password",
+		body:   setPasswordRequest{Email: email, Salt: salt, HashedPass: hash},
+		auth:   true,
+	}, nil)
+}
+
+// RevokeSessions revokes every token of the user and returns how many there were
+func (c *Client) RevokeSessions(ctx context.Context, email string) (int, error) {
+	var res revokeSessionsResponse
+	err := c.call(ctx, request{
+		method: http.MethodPut,
+		path:   "/admin/user/revoke-sessions",
+		body:   modifyUserRequest{Email: email},
+		auth:   true,
+	}, &res)
+	return res.Revoked, err
+}
+
+// Duplicates returns the stored keys of the accounts sharing an address, by address
+func (c *Client) Duplicates(ctx context.Context) (map[string][]string, error) {
+	var res duplicatesResponse
+	if err := c.call(ctx, request{method: http.MethodGet, path: "/admin/user/duplicates", auth: true}, &res); err != nil {
+		return nil, err
+	}
+	return res.Duplicates, nil
+}
+
+// MergeUsers merges the duplicates into the primary account and returns it
+func (c *Client) MergeUsers(ctx context.Context, req MergeUsersRequest) (*User, error) {
+	var u User
+	if err := c.call(ctx, request{method: http.MethodPost, path: "/admin/user/merge", body: req, auth: true}, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// Mails returns the mails sent by the server, including the pending challenges
+func (c *Client) Mails(ctx context.Context) ([]Mail, error) {
+	var res mailsResponse
+	if err := c.call(ctx, request{method: http.MethodGet, path: "/admin/mail/list", auth: true}, &res); err != nil {
+		return nil, err
+	}
+	return res.Mails, nil
+}
+
+// ReloadConfig applies the runtime part of the config file of the server and returns it
+func (c *Client) ReloadConfig(ctx context.Context) (*Runtime, error) {
+	var rt Runtime
+	if err := c.call(ctx, request{method: http.MethodPost, path: "/admin/config/reload", auth: true}, &rt); err != nil {
+		return nil, err
+	}
+	return &rt, nil
+}
+
+// Backup writes a gzipped snapshot of the db to w
+func (c *Client) Backup(ctx context.Context, w io.Writer) error {
+	return c.download(ctx, request{method: http.MethodGet, path: "/admin/db/backup", auth: true}, w)
+}
@@ -0,0 +1,23 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// Login exchanges the email and the hash of the password for a token, which
+// is sent by the next calls. See HashPassword.
+func (c *Client) Login(ctx context.Context, email string, hash string) (string, error) {
+	var res loginResponse
+	err := c.call(ctx, request{
+		method: http.MethodPost,
+		path:   "/auth/login",
+		body:   loginRequest{Email: email, Hash: hash},
+	}, &res)
+	if err != nil {
+		return "", err
+	}
+
+	c.setToken(res.Token)
+	return res.Token, nil
+}
@@ -0,0 +1,308 @@
+// Package client is a typed Go client of the todo-app API
+//
+// A Client sends the token of its session in the x-auth-token header. With
+// WithCredentials it logs in on the first call and again when the token is
+// rejected, so long running services keep working after a token is revoked.
+// Idempotent calls are retried with backoff when the server is unreachable or
+// answers 502, 503 or 504. Errors answered by the server are *Error values that
+// match the sentinel errors of this package with errors.Is.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	apiPrefix        = "/api/v1"
+	defaultUserAgent = "todo-app-client"
+)
+
+// TokenSource returns the token to send, it is called before every request
+type TokenSource func(ctx context.Context) (string, error)
+
+type Client struct {
+	baseURL   string
+	http      *http.Client
+	userAgent string
+
+	// retries is the number of extra attempts of idempotent calls
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	tokenSource TokenSource
+	email       string
+	hash        string
+
+	mu    sync.Mutex
+	token string
+}
+
+type Option func(*Client)
+
+// WithToken sends token, it is replaced by Login
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithTokenSource asks src for the token of every request, as to sign short
+// lived admin tokens. Login and WithCredentials are ignored when it is set.
+func WithTokenSource(src TokenSource) Option {
+	return func(c *Client) {
+		c.tokenSource = src
+	}
+}
+
+// WithCredentials logs in with email and the hash of the password when there
+// is no token yet, or the server rejects it. See HashPassword.
+func WithCredentials(email string, hash string) Option {
+	return func(c *Client) {
+		c.email = email
+		c.hash = hash
+	}
+}
+
+// WithHTTPClient sends the requests with hc, to set timeouts or trust a private CA
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithRetries retries idempotent calls up to n times, the wait between attempts
+// doubles from minBackoff to maxBackoff. n = 0 disables retries.
+func WithRetries(n int, minBackoff time.Duration, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = n
+		c.minBackoff = minBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// New returns a client of the server at baseURL, as https://todo.example.com
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		http:       &http.Client{Timeout: time.Minute},
+		userAgent:  defaultUserAgent,
+		retries:    3,
+		minBackoff: 100 * time.Millisecond,
+		maxBackoff: 2 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Token returns the token of the session, empty until Login
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+func (c *Client) setToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+// request describes a call to the API
+type request struct {
+	method string
+	// path is relative to the API prefix unless raw is set
+	path  string
+	query url.Values
+	body  any
+	raw   bool
+	// auth sends the token of the session
+	auth bool
+}
+
+// call sends req and decodes the json response into out, when it is not nil
+func (c *Client) call(ctx context.Context, req request, out any) error {
+	res, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response > %w", err)
+	}
+	return nil
+}
+
+// download copies the body of the response to w
+func (c *Client) download(ctx context.Context, req request, w io.Writer) error {
+	res, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if _, err := io.Copy(w, res.Body); err != nil {
+		return fmt.Errorf("failed to download %s > %w", req.path, err)
+	}
+	return nil
+}
+
+// send returns the response of req when its status is below 300, the body
+// must be closed. A rejected token is renewed once with the credentials.
+func (c *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	var body []byte
+	if req.body != nil {
+		data, err := json.Marshal(req.body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request > %w", err)
+		}
+		body = data
+	}
+
+	res, err := c.sendWithRetries(ctx, req, body)
+	if err == nil || !req.auth || !c.canLogin() || !tokenRejected(err) {
+		return res, err
+	}
+
+	if _, err := c.Login(ctx, c.email, c.hash); err != nil {
+		return nil, err
+	}
+	return c.sendWithRetries(ctx, req, body)
+}
+
+func (c *Client) canLogin() bool {
+	return c.tokenSource == nil && c.email != ""
+}
+
+func tokenRejected(err error) bool {
+	return errors.Is(err, ErrBadToken) || errors.Is(err, ErrMissingToken)
+}
+
+func (c *Client) sendWithRetries(ctx context.Context, req request, body []byte) (*http.Response, error) {
+	attempts := 1
+	if idempotent(req.method) {
+		attempts += c.retries
+	}
+
+	backoff := c.minBackoff
+	for i := 1; ; i++ {
+		res, err := c.do(ctx, req, body)
+		if i >= attempts || !retryable(err) || ctx.Err() != nil {
+			return res, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, c.maxBackoff)
+	}
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryable reports whether the attempt failed before reaching the app
+func retryable(err error) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		switch e.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	// the transport failed, as when the server is restarting
+	var ue *url.Error
+	return errors.As(err, &ue)
+}
+
+// do sends a single attempt of req
+func (c *Client) do(ctx context.Context, req request, body []byte) (*http.Response, error) {
+	u := c.baseURL + req.path
+	if !req.raw {
+		u = c.baseURL + apiPrefix + req.path
+	}
+	if len(req.query) > 0 {
+		u += "?" + req.query.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	hr, err := http.NewRequestWithContext(ctx, req.method, u, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request > %w", err)
+	}
+	hr.Header.Set("User-Agent", c.userAgent)
+	hr.Header.Set("Accept", "application/json")
+	if body != nil {
+		hr.Header.Set("Content-Type", "application/json")
+	}
+
+	if req.auth {
+		token, err := c.authToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			hr.Header.Set(authHeader, token)
+		}
+	}
+
+	res, err := c.http.Do(hr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s %s > %w", req.method, req.path, err)
+	}
+
+	if res.StatusCode >= 300 {
+		defer res.Body.Close()
+		return nil, decodeError(res)
+	}
+	return res, nil
+}
+
+// authToken returns the token of the request, it logs in when there is none yet
+func (c *Client) authToken(ctx context.Context) (string, error) {
+	if c.tokenSource != nil {
+		token, err := c.tokenSource(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to get token > %w", err)
+		}
+		return token, nil
+	}
+
+	if token := c.Token(); token != "" || !c.canLogin() {
+		return token, nil
+	}
+	return c.Login(ctx, c.email, c.hash)
+}
@@ -0,0 +1,230 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pzolo85/todo-app/back/internal/testutil"
+	"github.com/pzolo85/todo-app/back/pkg/client"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// challenge returns the challenge mailed to email
+func challenge(t *testing.T, srv *testutil.Server, email string) string {
+	c, ok := srv.Mails.Challenge(email)
+	assert.True(t, ok)
+	return c
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	srv := testutil.NewServer(t)
+	admin := srv.AdminClient()
+
+	t.Run("signup, validate and login", func(t *testing.T) {
+		c := srv.Client()
+		hash := client.HashPassword("salt", "secret")
+
+		u, err := c.CreateUser(ctx, "jon@test.com", "salt", hash)
+		assert.Nil(t, err)
+		assert.False(t, u.ValidEmail)
+
+		_, err = c.CreateUser(ctx, "jon@test.com", "salt", hash)
+		assert.ErrorIs(t, err, client.ErrUserExists)
+
+		err = c.ValidateUser(ctx, "jon@test.com", "wrong")
+		assert.ErrorIs(t, err, client.ErrInvalidChallenge)
+		assert.Nil(t, c.ValidateUser(ctx, "jon@test.com", challenge(t, srv, "jon@test.com")))
+
+		_, err = c.Login(ctx, "jon@test.com", client.HashPassword("salt", "wrong"))
+		assert.ErrorIs(t, err, client.ErrInvalidCredentials)
+		var e *client.Error
+		if assert.True(t, errors.As(err, &e)) {
+			assert.Equal(t, http.StatusUnauthorized, e.StatusCode)
+			assert.Equal(t, "invalid_credentials", e.Problem.Code)
+		}
+
+		token, err := c.Login(ctx, "jon@test.com", hash)
+		assert.Nil(t, err)
+		assert.Equal(t, token, c.Token())
+
+		info, err := c.Info(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, "jon@test.com", info.Email)
+		assert.True(t, info.ValidEmail)
+
+		var zip bytes.Buffer
+		exp, err := c.Export(ctx, &zip)
+		assert.Nil(t, err)
+		assert.Nil(t, exp)
+		assert.NotZero(t, zip.Len())
+	})
+
+	t.Run("validation errors", func(t *testing.T) {
+		_, err := srv.Client().CreateUser(ctx, "not-an-email", "salt", "hash")
+		assert.ErrorIs(t, err, client.ErrValidation)
+		var e *client.Error
+		if assert.True(t, errors.As(err, &e)) {
+			assert.Equal(t, "email", e.Problem.Errors[0].Field)
+		}
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		_, err := srv.Client().Info(ctx)
+		assert.ErrorIs(t, err, client.ErrMissingToken)
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		s, err := admin.AdminCreateUser(ctx, client.AdminCreateUserRequest{
+			Email:      "ana@test.com",
+			Salt:       "salt",
+			HashedPass: client.HashPassword("salt", "secret"),
+			Verified:   true,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "user", s.Role)
+
+		users, err := admin.ListUsers(ctx)
+		assert.Nil(t, err)
+		assert.Len(t, users, 2)
+
+		assert.Nil(t, admin.SuspendUser(ctx, "ana@test.com"))
+		_, err = srv.Client().Login(ctx, "ana@test.com", client.HashPassword("salt", "secret"))
+		assert.ErrorIs(t, err, client.ErrSuspended)
+		assert.Nil(t, admin.ResumeUser(ctx, "ana@test.com"))
+
+		assert.ErrorIs(t, admin.SuspendUser(ctx, "nobody@test.com"), client.ErrUserNotFound)
+
+		_, err = srv.Client(client.WithToken("not-a-token")).ListUsers(ctx)
+		assert.ErrorIs(t, err, client.ErrBadToken)
+	})
+
+	t.Run("token refresh", func(t *testing.T) {
+		hash := client.HashPassword("salt", "secret")
+		c := srv.Client(client.WithCredentials("ana@test.com", hash))
+
+		// the first call logs in
+		_, err := c.Info(ctx)
+		assert.Nil(t, err)
+		first := c.Token()
+		assert.NotEmpty(t, first)
+
+		revoked, err := admin.RevokeSessions(ctx, "ana@test.com")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, revoked)
+
+		info, err := c.Info(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, "ana@test.com", info.Email)
+		assert.NotEqual(t, first, c.Token())
+
+		// a rejected password is not retried forever
+		assert.Nil(t, admin.SetPassword(ctx, "ana@test.com", "salt", client.HashPassword("salt", "other")))
+		_, err = c.Info(ctx)
+		assert.ErrorIs(t, err, client.ErrInvalidCredentials)
+	})
+
+	t.Run("lists", func(t *testing.T) {
+		bob := srv.NewUser(t, "bob@test.com")
+		eve := srv.NewUser(t, "eve@test.com")
+
+		l, err := bob.CreateList(ctx, "groceries")
+		assert.Nil(t, err)
+		assert.Equal(t, "bob@test.com", l.Owner)
+
+		l, err = bob.AddItem(ctx, l.ID, "milk")
+		assert.Nil(t, err)
+		l, err = bob.CheckItem(ctx, l.ID, l.Items[0].ID, true)
+		assert.Nil(t, err)
+		assert.True(t, l.Items[0].Done)
+		_, err = bob.CheckItem(ctx, l.ID, "unknown", true)
+		assert.ErrorIs(t, err, client.ErrItemNotFound)
+
+		_, err = eve.GetList(ctx, l.ID)
+		assert.ErrorIs(t, err, client.ErrListNotFound)
+		_, err = bob.ShareList(ctx, l.ID, "bob@test.com")
+		assert.ErrorIs(t, err, client.ErrShareWithOwner)
+
+		l, err = bob.ShareList(ctx, l.ID, "eve@test.com")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"eve@test.com"}, l.SharedWith)
+		_, err = eve.ShareList(ctx, l.ID, "jon@test.com")
+		assert.ErrorIs(t, err, client.ErrNotListOwner)
+
+		lists, err := eve.Lists(ctx)
+		assert.Nil(t, err)
+		if assert.Len(t, lists, 1) {
+			assert.Equal(t, "groceries", lists[0].Name)
+			assert.True(t, lists[0].Items[0].Done)
+		}
+	})
+
+	t.Run("health", func(t *testing.T) {
+		assert.Nil(t, admin.Healthz(ctx))
+
+		// the workers only run under serve, the report comes with the error
+		report, err := srv.Client(client.WithRetries(0, 0, 0)).Readyz(ctx)
+		var e *client.Error
+		if assert.True(t, errors.As(err, &e)) {
+			assert.Equal(t, http.StatusServiceUnavailable, e.StatusCode)
+		}
+		if assert.NotNil(t, report) {
+			assert.Equal(t, "ok", report.Checks["db"].Status)
+			assert.Equal(t, "fail", report.Checks["workers"].Status)
+		}
+
+		v, err := admin.Version(ctx)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, v.GoVersion)
+	})
+
+	t.Run("backup", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.Nil(t, admin.Backup(ctx, &buf))
+		// gzip magic number
+		assert.Equal(t, []byte{0x1f, 0x8b}, buf.Bytes()[:2])
+	})
+}
+
+func TestClient_Retries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer srv.Close()
+
+	c := client.New(srv.URL, client.WithRetries(3, time.Millisecond, time.Millisecond))
+	assert.Nil(t, c.Healthz(context.Background()))
+	assert.Equal(t, int32(3), calls.Load())
+
+	t.Run("not idempotent", func(t *testing.T) {
+		calls.Store(0)
+		_, err := c.Login(context.Background(), "jon@test.com", "hash")
+		var e *client.Error
+		if assert.True(t, errors.As(err, &e)) {
+			assert.Equal(t, http.StatusServiceUnavailable, e.StatusCode)
+			assert.Equal(t, "service_unavailable", e.Problem.Code)
+		}
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("context", func(t *testing.T) {
+		calls.Store(-100)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		err := client.New(srv.URL, client.WithRetries(100, 10*time.Millisecond, 10*time.Millisecond)).Healthz(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
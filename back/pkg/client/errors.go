@@ -0,0 +1,86 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxErrorBody bounds the error responses read into memory
+const maxErrorBody = 1 << 20
+
+// errors answered by the server, match them with errors.Is
+var (
+	ErrInvalidBody          = serverError(http.StatusBadRequest, "invalid_body")
+	ErrValidation           = serverError(http.StatusUnprocessableEntity, "validation_failed")
+	ErrMissingToken         = serverError(http.StatusUnauthorized, "missing_token")
+	ErrBadToken             = serverError(http.StatusUnauthorized, "invalid_token")
+	ErrInvalidCredentials   = serverError(http.StatusUnauthorized, "invalid_credentials")
+	ErrRoleNotAllowed       = serverError(http.StatusForbidden, "role_not_allowed")
+	ErrAccountNotValidated  = serverError(http.StatusForbidden, "account_not_validated")
+	ErrSuspended            = serverError(http.StatusForbidden, "account_suspended")
+	ErrUserNotFound         = serverError(http.StatusNotFound, "user_not_found")
+	ErrUserExists           = serverError(http.StatusConflict, "user_exists")
+	ErrUserConflict         = serverError(http.StatusConflict, "user_conflict")
+	ErrNotDuplicate         = serverError(http.StatusBadRequest, "not_duplicate")
+	ErrExportNotFound       = serverError(http.StatusNotFound, "export_not_found")
+	ErrListNotFound         = serverError(http.StatusNotFound, "list_not_found")
+	ErrItemNotFound         = serverError(http.StatusNotFound, "item_not_found")
+	ErrNotListOwner         = serverError(http.StatusForbidden, "not_list_owner")
+	ErrShareWithOwner       = serverError(http.StatusBadRequest, "share_with_owner")
+	ErrDeletionNotConfirmed = serverError(http.StatusBadRequest, "confirmation_required")
+	ErrInvalidChallenge     = serverError(http.StatusBadRequest, "invalid_challenge")
+	ErrInvalidConfig        = serverError(http.StatusBadRequest, "invalid_config")
+)
+
+// serverError returns the sentinel error of the responses with status and code
+func serverError(status int, code string) *Error {
+	return &Error{StatusCode: status, Problem: Problem{Status: status, Code: code}}
+}
+
+// Error is a response of the server with a status of 300 or more
+type Error struct {
+	StatusCode int
+	// Problem is the problem+json body, responses of proxies without one get
+	// a problem built from the status
+	Problem Problem
+
+	body []byte
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("server answered %d %s", e.StatusCode, e.Problem.Code)
+	if e.Problem.Detail != "" {
+		msg += ": " + e.Problem.Detail
+	}
+	for _, f := range e.Problem.Errors {
+		msg += fmt.Sprintf(", %s: %s", f.Field, f.Message)
+	}
+	return msg
+}
+
+// Is matches the sentinel errors of the same status and code
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.StatusCode == e.StatusCode && t.Problem.Code == e.Problem.Code
+}
+
+// decodeError reads the problem+json body of res
+func decodeError(res *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+	e := &Error{StatusCode: res.StatusCode, body: body}
+
+	if err := json.Unmarshal(body, &e.Problem); err != nil || e.Problem.Code == "" {
+		// same codes as the server gives to errors without a type
+		code := strings.ReplaceAll(strings.ToLower(http.StatusText(res.StatusCode)), " ", "_")
+		e.Problem = Problem{
+			Type:   "urn:todo-app:problem:" + code,
+			Title:  http.StatusText(res.StatusCode),
+			Status: res.StatusCode,
+			Code:   code,
+		}
+	}
+	return e
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Healthz returns nil as long as the server answers
+func (c *Client) Healthz(ctx context.Context) error {
+	return c.call(ctx, request{method: http.MethodGet, path: "/healthz", raw: true}, nil)
+}
+
+// Readyz returns the checks of the server. When one of them fails, the report
+// is returned with an *Error of status 503.
+func (c *Client) Readyz(ctx context.Context) (*Report, error) {
+	var report Report
+	err := c.call(ctx, request{method: http.MethodGet, path: "/readyz", raw: true}, &report)
+
+	var e *Error
+	if errors.As(err, &e) && e.StatusCode == http.StatusServiceUnavailable {
+		if jsonErr := json.Unmarshal(e.body, &report); jsonErr != nil {
+			return nil, err
+		}
+		return &report, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Version returns the build of the server
+func (c *Client) Version(ctx context.Context) (*Version, error) {
+	var v Version
+	if err := c.call(ctx, request{method: http.MethodGet, path: "/version", raw: true}, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Lists returns the lists of the session, then the lists shared with it
+func (c *Client) Lists(ctx context.Context) ([]List, error) {
+	var res listsResponse
+	if err := c.call(ctx, request{method: http.MethodGet, path: "/user/lists", auth: true}, &res); err != nil {
+		return nil, err
+	}
+	return res.Lists, nil
+}
+
+// CreateList creates an empty list owned by the session
+func (c *Client) CreateList(ctx context.Context, name string) (*List, error) {
+	var l List
+	err := c.call(ctx, request{
+		method: http.MethodPost,
+		path:   "/user/lists",
+		body:   createListRequest{Name: name},
+		auth:   true,
+	}, &l)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// GetList returns a list owned by or shared with the session
+func (c *Client) GetList(ctx context.Context, id string) (*List, error) {
+	var l List
+	if err := c.call(ctx, request{method: http.MethodGet, path: listPath(id), auth: true}, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// AddItem appends an item to the list and returns the list
+func (c *Client) AddItem(ctx context.Context, id string, text string) (*List, error) {
+	var l List
+	err := c.call(ctx, request{
+		method: http.MethodPost,
+		path:   listPath(id) + "/items",
+		body:   addItemRequest{Text: text},
+		auth:   true,
+	}, &l)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// CheckItem checks off the item of the list, or unchecks it, and returns the list
+func (c *Client) CheckItem(ctx context.Context, id string, item string, done bool) (*List, error) {
+	var l List
+	err := c.call(ctx, request{
+		method: http.MethodPut,
+		path:   listPath(id) + "/items/" + url.PathEscape(item),
+		body:   checkItemRequest{Done: done},
+		auth:   true,
+	}, &l)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// ShareList shares the list with the user of email, only the owner can share it
+func (c *Client) ShareList(ctx context.Context, id string, email string) (*List, error) {
+	var l List
+	err := c.call(ctx, request{
+		method: http.MethodPut,
+		path:   listPath(id) + "/share",
+		body:   shareListRequest{Email: email},
+		auth:   true,
+	}, &l)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func listPath(id string) string {
+	return "/user/lists/" + url.PathEscape(id)
+}
@@ -0,0 +1,217 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// the types of the API, they mirror the ones of the server without depending
+// on its packages, TestWireTypes fails when they drift apart
+
+// authHeader carries the token of the session
+const authHeader = "x-auth-token"
+
+// Problem is the RFC 7807 body of every error response
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes why a request field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type User struct {
+	Email        string    `json:"email,omitempty"`
+	PassHash     string    `json:"pass_hash,omitempty"`
+	Salt         string    `json:"salt"`
+	Role         string    `json:"role"`
+	CreatedAt    time.Time `json:"created_at,omitempty"`
+	ValidEmail   bool      `json:"valid_email,omitempty"`
+	ActiveJWT    []string  `json:"active_jwt,omitempty"`
+	Notes        []string  `json:"notes,omitempty"`
+	SharedWithMe []string  `json:"shared_with_me,omitempty"`
+	// DeleteAt is set while the account is pending deletion
+	DeleteAt  *time.Time `json:"delete_at,omitempty"`
+	Suspended bool       `json:"suspended,omitempty"`
+	Revision  uint64     `json:"revision"`
+}
+
+// Summary is the view of a user shown to admins, without credentials or tokens
+type Summary struct {
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	ValidEmail bool       `json:"valid_email"`
+	Suspended  bool       `json:"suspended"`
+	Sessions   int        `json:"sessions"`
+	CreatedAt  time.Time  `json:"created_at"`
+	DeleteAt   *time.Time `json:"delete_at,omitempty"`
+}
+
+// Summary returns the view of u shown to admins
+func (u *User) Summary() Summary {
+	return Summary{
+		Email:      u.Email,
+		Role:       u.Role,
+		ValidEmail: u.ValidEmail,
+		Suspended:  u.Suspended,
+		Sessions:   len(u.ActiveJWT),
+		CreatedAt:  u.CreatedAt,
+		DeleteAt:   u.DeleteAt,
+	}
+}
+
+type Item struct {
+	ID        string    `json:"id"`
+	Text      string    `json:"text"`
+	Done      bool      `json:"done"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// List is owned by Owner and shared with the users in SharedWith, who can add
+// and check off items
+type List struct {
+	ID         string    `json:"id"`
+	Owner      string    `json:"owner"`
+	Name       string    `json:"name"`
+	Items      []Item    `json:"items"`
+	SharedWith []string  `json:"shared_with"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type ExportResponse struct {
+	ExportID string `json:"export_id"`
+}
+
+type DeleteUserResponse struct {
+	DeleteAt time.Time `json:"delete_at"`
+}
+
+// AdminCreateUserRequest creates a user without the email challenge
+type AdminCreateUserRequest struct {
+	Email      string `json:"email"`
+	Salt       string `json:"salt"`
+	HashedPass string `json:"hashed_pass"`
+	Admin      bool   `json:"admin"`
+	Verified   bool   `json:"verified"`
+}
+
+// MergeUsersRequest names the stored keys of the accounts to merge. Primary
+// keeps its credentials and role.
+type MergeUsersRequest struct {
+	Primary    string   `json:"primary"`
+	Duplicates []string `json:"duplicates"`
+}
+
+type Mail struct {
+	Subject string `json:"subject,omitempty"`
+	Link    string `json:"link,omitempty"`
+	To      string `json:"to,omitempty"`
+}
+
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type Version struct {
+	Module    string `json:"module,omitempty"`
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Runtime is the part of the config of the server that is reloaded without a restart
+type Runtime struct {
+	Level                string        `json:"level"`
+	ExportAsyncThreshold int           `json:"export_async_threshold"`
+	DeletionGracePeriod  time.Duration `json:"deletion_grace_period"`
+}
+
+// the bodies that are not exposed by the calls
+
+type loginRequest struct {
+	Email string `json:"email"`
+	Hash  string `json:"hash"`
+}
+
+type loginResponse struct {
+	Token string `json:"token"`
+}
+
+type userCreateRequest struct {
+	Email      string `json:"email,omitempty"`
+	Salt       string `json:"salt,omitempty"`
+	HashedPass string `json:"hashed_pass,omitempty"`
+}
+
+type modifyUserRequest struct {
+	Email string `json:"email,omitempty"`
+}
+
+type setPasswordRequest struct {
+	Email      string `json:"email"`
+	Salt       string `json:"salt"`
+	HashedPass string `json:"hashed_pass"`
+}
+
+type createListRequest struct {
+	Name string `json:"name"`
+}
+
+type addItemRequest struct {
+	Text string `json:"text"`
+}
+
+type checkItemRequest struct {
+	Done bool `json:"done"`
+}
+
+type shareListRequest struct {
+	Email string `json:"email"`
+}
+
+type listsResponse struct {
+	Lists []List `json:"lists"`
+}
+
+type listUsersResponse struct {
+	Users []Summary `json:"users"`
+}
+
+type revokeSessionsResponse struct {
+	Revoked int `json:"revoked"`
+}
+
+type duplicatesResponse struct {
+	Duplicates map[string][]string `json:"duplicates"`
+}
+
+type mailsResponse struct {
+	Mails []Mail `json:"mails"`
+}
+
+// HashPassword returns the hash of password that is sent to the server, users
+// are created and log in with it
+func HashPassword(salt string, password string) string {
+	sum := sha256.Sum256([]byte(salt + password))
+	return hex.EncodeToString(sum[:])
+}
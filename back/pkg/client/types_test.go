@@ -0,0 +1,117 @@
+package client
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/pzolo85/todo-app/back/internal/apperr"
+	"github.com/pzolo85/todo-app/back/internal/auth"
+	"github.com/pzolo85/todo-app/back/internal/config"
+	"github.com/pzolo85/todo-app/back/internal/health"
+	"github.com/pzolo85/todo-app/back/internal/mail"
+	"github.com/pzolo85/todo-app/back/internal/user"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// jsonFields returns the json tag and the kind of every encoded field of t, by name
+func jsonFields(t reflect.Type) map[string]string {
+	fields := map[string]string{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || !f.IsExported() {
+			continue
+		}
+		fields[f.Name] = tag + " " + f.Type.Kind().String()
+	}
+	return fields
+}
+
+// TestWireTypes checks that the types of the client encode like the ones of the server
+func TestWireTypes(t *testing.T) {
+	tests := []struct {
+		client any
+		server any
+	}{
+		{Problem{}, apperr.Problem{}},
+		{FieldError{}, apperr.FieldError{}},
+		{User{}, user.User{}},
+		{Summary{}, user.Summary{}},
+		{Item{}, user.Item{}},
+		{List{}, user.List{}},
+		{ExportResponse{}, user.ExportResponse{}},
+		{DeleteUserResponse{}, user.DeleteUserResponse{}},
+		{AdminCreateUserRequest{}, user.AdminCreateUserRequest{}},
+		{MergeUsersRequest{}, user.MergeUsersRequest{}},
+		{Mail{}, mail.Mail{}},
+		{CheckResult{}, health.CheckResult{}},
+		{Report{}, health.Report{}},
+		{Version{}, health.Version{}},
+		{Runtime{}, config.Runtime{}},
+		{loginRequest{}, auth.LoginRequest{}},
+		{loginResponse{}, auth.LoginResponse{}},
+		{userCreateRequest{}, user.UserCreateRequest{}},
+		{modifyUserRequest{}, user.ModifyUserRequest{}},
+		{setPasswordRequest{}, user.SetPasswordRequest{}},
+		{createListRequest{}, user.CreateListRequest{}},
+		{addItemRequest{}, user.AddItemRequest{}},
+		{checkItemRequest{}, user.CheckItemRequest{}},
+		{shareListRequest{}, user.ShareListRequest{}},
+		{listsResponse{}, user.ListsResponse{}},
+		{listUsersResponse{}, user.ListUsersResponse{}},
+		{revokeSessionsResponse{}, user.RevokeSessionsResponse{}},
+		{duplicatesResponse{}, user.DuplicatesResponse{}},
+		{mailsResponse{}, mail.Mails{}},
+	}
+	for _, tt := range tests {
+		server := reflect.TypeOf(tt.server)
+		t.Run(server.String(), func(t *testing.T) {
+			assert.Equal(t, jsonFields(server), jsonFields(reflect.TypeOf(tt.client)))
+		})
+	}
+
+	assert.Equal(t, auth.AuthHeader, authHeader)
+	assert.Equal(t, user.HashPassword("salt", "secret"), HashPassword("salt", "secret"))
+}
+
+// TestSentinelErrors checks that the errors of the client match the ones the server answers
+func TestSentinelErrors(t *testing.T) {
+	tests := []struct {
+		client *Error
+		server *apperr.Error
+	}{
+		{ErrInvalidBody, apperr.ErrInvalidBody},
+		{ErrValidation, apperr.Validation()},
+		{ErrMissingToken, apperr.ErrMissingAuth},
+		{ErrBadToken, apperr.ErrBadToken},
+		{ErrInvalidCredentials, auth.ErrInvalidCredentials},
+		{ErrRoleNotAllowed, auth.ErrRoleNotAllowed},
+		{ErrAccountNotValidated, auth.ErrAccountNotValidated},
+		{ErrSuspended, user.ErrSuspended},
+		{ErrUserNotFound, user.ErrNotFound},
+		{ErrUserExists, user.ErrExists},
+		{ErrUserConflict, user.ErrConflict},
+		{ErrNotDuplicate, user.ErrNotDuplicate},
+		{ErrExportNotFound, user.ErrExportNotFound},
+		{ErrListNotFound, user.ErrListNotFound},
+		{ErrItemNotFound, user.ErrItemNotFound},
+		{ErrNotListOwner, user.ErrNotListOwner},
+		{ErrShareWithOwner, user.ErrShareWithSelf},
+		{ErrDeletionNotConfirmed, user.ErrDeletionNotConfirmed},
+		{ErrInvalidChallenge, mail.ErrInvalidChallenge},
+		{ErrInvalidConfig, config.ErrInvalidConfig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.server.Code, func(t *testing.T) {
+			assert.Equal(t, tt.server.Status(), tt.client.StatusCode)
+			assert.Equal(t, tt.server.Code, tt.client.Problem.Code)
+		})
+	}
+
+	// a response matches by status and code
+	res := &Error{StatusCode: http.StatusNotFound, Problem: Problem{Status: http.StatusNotFound, Code: "user_not_found", Detail: "user not found"}}
+	assert.ErrorIs(t, res, ErrUserNotFound)
+	assert.NotErrorIs(t, res, ErrExportNotFound)
+}
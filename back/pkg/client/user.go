@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// CreateUser signs up a user, the server mails a challenge to validate the email
+func (c *Client) CreateUser(ctx context.Context, email string, salt string, hash string) (*User, error) {
+	var u User
+	err := c.call(ctx, request{
+		method: http.MethodPost,
+		path:   "/user/create",
+		body:   userCreateRequest{Email: email, Salt: salt, HashedPass: hash},
+	}, &u)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// ValidateUser validates the email with the challenge of the mail
+func (c *Client) ValidateUser(ctx context.Context, email string, challenge string) error {
+	return c.call(ctx, request{
+		method: http.MethodGet,
+		path:   "/user/validate",
+		query:  url.Values{"email": {email}, "challenge": {challenge}},
+	}, nil)
+}
+
+// ResendChallenge mails a new challenge to the user of the session
+func (c *Client) ResendChallenge(ctx context.Context) error {
+	return c.call(ctx, request{method: http.MethodGet, path: "/user/resend-challenge", auth: true}, nil)
+}
+
+// Info returns the account of the session
+func (c *Client) Info(ctx context.Context) (*User, error) {
+	var u User
+	if err := c.call(ctx, request{method: http.MethodGet, path: "/user/info", auth: true}, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// Export writes the zip of the data of the account to w. Large accounts are
+// built in the background, then nothing is written and the returned response
+// names the export the server mails a link to, see DownloadExport.
+func (c *Client) Export(ctx context.Context, w io.Writer) (*ExportResponse, error) {
+	res, err := c.send(ctx, request{method: http.MethodGet, path: "/user/export", auth: true})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusAccepted {
+		var exp ExportResponse
+		if err := json.NewDecoder(res.Body).Decode(&exp); err != nil {
+			return nil, fmt.Errorf("failed to decode response > %w", err)
+		}
+		return &exp, nil
+	}
+
+	if _, err := io.Copy(w, res.Body); err != nil {
+		return nil, fmt.Errorf("failed to download export > %w", err)
+	}
+	return nil, nil
+}
+
+// DownloadExport writes the zip of an export built in the background to w
+func (c *Client) DownloadExport(ctx context.Context, id string, w io.Writer) error {
+	return c.download(ctx, request{
+		method: http.MethodGet,
+		path:   "/user/export/" + url.PathEscape(id),
+		auth:   true,
+	}, w)
+}
+
+// DeleteAccount marks the account of the session for deletion, logging in
+// again before the returned time cancels it
+func (c *Client) DeleteAccount(ctx context.Context) (*DeleteUserResponse, error) {
+	var res DeleteUserResponse
+	err := c.call(ctx, request{
+		method: http.MethodDelete,
+		path:   "/user/",
+		query:  url.Values{"confirm": {"true"}},
+		auth:   true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
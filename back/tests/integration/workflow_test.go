@@ -2,126 +2,123 @@
 package integration
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
-	"os"
+	"context"
 	"testing"
+	"time"
 
-	"github.com/labstack/echo/v4"
-	"github.com/pzolo85/todo-app/back/internal/auth"
-	"github.com/pzolo85/todo-app/back/internal/config"
-	"github.com/pzolo85/todo-app/back/internal/mail"
-	"github.com/pzolo85/todo-app/back/internal/user"
-	"github.com/stretchr/testify/assert"
-)
+	"github.com/pzolo85/todo-app/back/internal/testutil"
+	"github.com/pzolo85/todo-app/back/pkg/client"
 
-var AdminToken string
-var cfg *config.Config
-var (
-	basePath  = "/api/v1"
-	adminPath = "/admin"
-	mailPath  = "/mail"
-	userPath  = "/user"
-	host      string
+	"github.com/stretchr/testify/assert"
 )
 
-func loadConfig() error {
-	if cfg != nil {
-		return nil
-	}
-	var err error
-	if cfg, err = config.Load(); err != nil {
-		return err
-	}
-
-	AdminToken = os.Getenv("I_ADMIN_TOKEN")
-	if AdminToken == "" {
-		return fmt.Errorf("admin token missing")
-	}
-
-	host = fmt.Sprintf("http://%s:%d", cfg.Address, cfg.Port)
-
-	return nil
-}
-
-func setAdmin(req *http.Request) {
-	req.Header.Add(auth.AuthHeader, AdminToken)
-}
-func setJSON(req *http.Request) {
-	req.Header.Add(echo.HeaderContentType, echo.MIMEApplicationJSON)
-}
-
 func Test_User(t *testing.T) {
-	assert.Nil(t, loadConfig())
+	ctx := context.Background()
+	srv := testutil.NewServer(t)
+	admin := srv.AdminClient()
 	email := "john@test.com"
+	hash := client.HashPassword("abc123", "secret")
+	c := srv.Client()
 
 	t.Run("create user", func(t *testing.T) {
-		reqBody := user.UserCreateRequest{
-			Email:      email,
-			Salt:       "abc123",
-			HashedPass: "abc123",
-		}
+		u, err := c.CreateUser(ctx, email, "abc123", hash)
+		assert.Nil(t, err)
+		assert.Equal(t, email, u.Email)
+		assert.False(t, u.ValidEmail)
+	})
 
-		reqBodyBytes, err := json.Marshal(reqBody)
+	t.Run("login before validating", func(t *testing.T) {
+		_, err := c.Login(ctx, email, hash)
 		assert.Nil(t, err)
-		reqBodyReader := bytes.NewReader(reqBodyBytes)
 
-		req, err := http.NewRequest(
-			http.MethodPost,
-			host+basePath+userPath+"/create",
-			reqBodyReader,
-		)
-		setJSON(req)
+		_, err = c.Info(ctx)
+		assert.ErrorIs(t, err, client.ErrAccountNotValidated)
+	})
+
+	t.Run("validate email", func(t *testing.T) {
+		challenge, ok := srv.Mails.Challenge(email)
+		assert.True(t, ok)
 
-		res, err := http.DefaultClient.Do(req)
+		// the challenge is also listed to admins
+		mails, err := admin.Mails(ctx)
 		assert.Nil(t, err)
+		assert.Len(t, mails, 1)
+		assert.Equal(t, email, mails[0].To)
 
-		assert.Equal(t, res.StatusCode, http.StatusOK)
+		assert.Nil(t, c.ValidateUser(ctx, email, challenge))
+		assert.ErrorIs(t, c.ValidateUser(ctx, email, challenge), client.ErrInvalidChallenge)
 
-		resByte, err := io.ReadAll(res.Body)
+		info, err := c.Info(ctx)
 		assert.Nil(t, err)
-		defer res.Body.Close()
+		assert.True(t, info.ValidEmail)
+	})
+
+	t.Run("admin endpoints", func(t *testing.T) {
+		_, err := c.ListUsers(ctx)
+		assert.ErrorIs(t, err, client.ErrRoleNotAllowed)
+
+		assert.Nil(t, admin.MakeAdmin(ctx, email))
+
+		users, err := c.ListUsers(ctx)
+		assert.Nil(t, err)
+		assert.Len(t, users, 1)
+		assert.Equal(t, "admin", users[0].Role)
+	})
 
-		var u user.User
-		err = json.Unmarshal(resByte, &u)
+	t.Run("helpers", func(t *testing.T) {
+		ana := srv.NewUser(t, "ana@test.com")
+		info, err := ana.Info(ctx)
 		assert.Nil(t, err)
+		assert.True(t, info.ValidEmail)
+		_, err = ana.ListUsers(ctx)
+		assert.ErrorIs(t, err, client.ErrRoleNotAllowed)
 
-		assert.Equal(t, email, u.Email)
+		bob := srv.NewAdmin(t, "bob@test.com")
+		users, err := bob.ListUsers(ctx)
+		assert.Nil(t, err)
+		assert.Len(t, users, 3)
 	})
+}
 
-	t.Run("validate email", func(t *testing.T) {
-		req, err := http.NewRequest(
-			http.MethodGet,
-			host+basePath+adminPath+mailPath+"/list",
-			nil,
-		)
+func Test_AccountDeletion(t *testing.T) {
+	ctx := context.Background()
+	srv := testutil.NewServer(t)
+	admin := srv.AdminClient()
+
+	t.Run("login cancels the deletion", func(t *testing.T) {
+		jon := srv.NewUser(t, "jon@test.com")
+		res, err := jon.DeleteAccount(ctx)
+		assert.Nil(t, err)
+
+		// the sessions were revoked, the client logs in again
+		_, err = srv.Client(client.WithToken(jon.Token())).Info(ctx)
+		assert.ErrorIs(t, err, client.ErrBadToken)
+		_, err = jon.Info(ctx)
 		assert.Nil(t, err)
-		setAdmin(req)
 
-		res, err := http.DefaultClient.Do(req)
+		srv.Services.PurgeJob.Purge(ctx, res.DeleteAt.Add(time.Second))
+		info, err := jon.Info(ctx)
 		assert.Nil(t, err)
+		assert.Equal(t, "jon@test.com", info.Email)
+	})
 
-		resByte, err := io.ReadAll(res.Body)
+	t.Run("purge deletes the account", func(t *testing.T) {
+		ana := srv.NewUser(t, "ana@test.com")
+		res, err := ana.DeleteAccount(ctx)
 		assert.Nil(t, err)
-		defer res.Body.Close()
 
-		var m mail.Mails
-		err = json.Unmarshal(resByte, &m)
+		srv.Services.PurgeJob.Purge(ctx, res.DeleteAt.Add(-time.Second))
+		users, err := admin.ListUsers(ctx)
 		assert.Nil(t, err)
+		assert.Len(t, users, 2)
 
-		for _, m := range m.Mails {
-			if m.To == email {
-				r, err := http.NewRequest(http.MethodGet, m.Link, nil)
-				assert.Nil(t, err)
-				resp, err := http.DefaultClient.Do(r)
-				assert.Equal(t, resp.StatusCode, http.StatusOK)
-				break
-			}
-		}
+		srv.Services.PurgeJob.Purge(ctx, res.DeleteAt.Add(time.Second))
+		users, err = admin.ListUsers(ctx)
+		assert.Nil(t, err)
+		assert.Len(t, users, 1)
+		assert.Equal(t, "jon@test.com", users[0].Email)
 
+		_, err = ana.Info(ctx)
+		assert.ErrorIs(t, err, client.ErrInvalidCredentials)
 	})
-
 }